@@ -2,10 +2,12 @@ package main
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/jym0818/webook/pkg/saramax"
 	"github.com/robfig/cron/v3"
 )
 
 type App struct {
-	web  *gin.Engine
-	cron *cron.Cron
+	web       *gin.Engine
+	cron      *cron.Cron
+	consumers []saramax.Consumer
 }
@@ -0,0 +1,44 @@
+package events
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/jym0818/webook/interactive/repository"
+	"github.com/jym0818/webook/pkg/saramax"
+	"go.uber.org/zap"
+	"time"
+)
+
+// UserDeletedEvent 和 webook 里面的 user.DeletedEvent 保持一致
+type UserDeletedEvent struct {
+	Uid int64
+}
+
+type UserDeletedConsumer struct {
+	client sarama.Client
+	repo   repository.InteractiveRepository
+}
+
+func (u *UserDeletedConsumer) Start() error {
+	cg, err := sarama.NewConsumerGroupFromClient("interactive_user_deleted", u.client)
+	if err != nil {
+		return err
+	}
+	go func() {
+		er := cg.Consume(context.Background(), []string{"user_deleted"}, saramax.NewHandler[UserDeletedEvent](u.Consume))
+		if er != nil {
+			zap.L().Error("退出了消费循环", zap.Error(er))
+		}
+	}()
+	return nil
+}
+
+func (u *UserDeletedConsumer) Consume(msg *sarama.ConsumerMessage, evt UserDeletedEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	return u.repo.DeleteUser(ctx, evt.Uid)
+}
+
+func NewUserDeletedConsumer(repo repository.InteractiveRepository, client sarama.Client) *UserDeletedConsumer {
+	return &UserDeletedConsumer{repo: repo, client: client}
+}
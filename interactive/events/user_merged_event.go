@@ -0,0 +1,46 @@
+package events
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/jym0818/webook/interactive/repository"
+	"github.com/jym0818/webook/pkg/saramax"
+	"go.uber.org/zap"
+	"time"
+)
+
+// UserMergedEvent 和 webook 里面的 user.MergedEvent 保持一致
+type UserMergedEvent struct {
+	From int64
+	To   int64
+}
+
+type UserMergedConsumer struct {
+	client sarama.Client
+	repo   repository.InteractiveRepository
+}
+
+func (u *UserMergedConsumer) Start() error {
+	// 和阅读事件用不同的消费者组，不然两边订阅的 topic 不一致会互相 rebalance
+	cg, err := sarama.NewConsumerGroupFromClient("interactive_user", u.client)
+	if err != nil {
+		return err
+	}
+	go func() {
+		er := cg.Consume(context.Background(), []string{"user_merged"}, saramax.NewHandler[UserMergedEvent](u.Consume))
+		if er != nil {
+			zap.L().Error("退出了消费循环", zap.Error(er))
+		}
+	}()
+	return nil
+}
+
+func (u *UserMergedConsumer) Consume(msg *sarama.ConsumerMessage, evt UserMergedEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	return u.repo.MergeUser(ctx, evt.From, evt.To)
+}
+
+func NewUserMergedConsumer(repo repository.InteractiveRepository, client sarama.Client) *UserMergedConsumer {
+	return &UserMergedConsumer{repo: repo, client: client}
+}
@@ -3,6 +3,8 @@ package ioc
 import (
 	grpc2 "github.com/jym0818/webook/interactive/grpc"
 	"github.com/jym0818/webook/pkg/grpcx"
+	"github.com/jym0818/webook/pkg/grpcx/interceptors/auth"
+	"github.com/jym0818/webook/pkg/jwtx"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 )
@@ -11,6 +13,8 @@ func InitGRPCxServer(intrServer *grpc2.InteractiveServiceServer) *grpcx.Server {
 	type Config struct {
 		Port      int      `yaml:"port"`
 		EtcdAddrs []string `yaml:"etcdAddrs"`
+		// JwksURL webook 的 /.well-known/jwks.json，需要校验用户权限的方法靠它验证 token
+		JwksURL string `yaml:"jwksURL"`
 	}
 
 	var cfg Config
@@ -21,7 +25,14 @@ func InitGRPCxServer(intrServer *grpc2.InteractiveServiceServer) *grpcx.Server {
 		panic(err)
 	}
 
-	server := grpc.NewServer()
+	var opts []grpc.ServerOption
+	if cfg.JwksURL != "" {
+		// 现在的方法都是给 webook 内部调用的，不需要用户权限。
+		// 以后加管理后台用的方法，在这里 Require 对应的权限
+		authBuilder := auth.NewInterceptorBuilder(jwtx.NewRemoteKeyset(cfg.JwksURL).Keyfunc)
+		opts = append(opts, grpc.ChainUnaryInterceptor(authBuilder.BuildUnary()))
+	}
+	server := grpc.NewServer(opts...)
 	intrServer.Register(server)
 
 	return &grpcx.Server{
@@ -2,6 +2,7 @@ package ioc
 
 import (
 	"github.com/IBM/sarama"
+	"github.com/jym0818/webook/interactive/events"
 	"github.com/jym0818/webook/pkg/saramax"
 	"github.com/spf13/viper"
 )
@@ -24,6 +25,7 @@ func InitKafka() sarama.Client {
 	return client
 }
 
-func NewConsumers(c1 saramax.Consumer) []saramax.Consumer {
-	return []saramax.Consumer{c1}
+func NewConsumers(c1 saramax.Consumer, merged *events.UserMergedConsumer,
+	deleted *events.UserDeletedConsumer) []saramax.Consumer {
+	return []saramax.Consumer{c1, merged, deleted}
 }
@@ -34,6 +34,7 @@ type InteractiveCache interface {
 	// 事实上，这里 liked 和 collected 是不需要缓存的
 	Get(ctx context.Context, biz string, bizId int64) (domain.Interactive, error)
 	Set(ctx context.Context, biz string, bizId int64, intr domain.Interactive) error
+	Del(ctx context.Context, biz string, bizId int64) error
 }
 
 type interactiveCache struct {
@@ -78,6 +79,10 @@ func (cache *interactiveCache) Set(ctx context.Context, biz string, bizId int64,
 	return cache.cmd.Expire(ctx, key, time.Minute*15).Err()
 }
 
+func (cache *interactiveCache) Del(ctx context.Context, biz string, bizId int64) error {
+	return cache.cmd.Del(ctx, cache.key(biz, bizId)).Err()
+}
+
 func (cache *interactiveCache) IncrCollectCntIfPresent(ctx context.Context,
 	biz string, bizId int64) error {
 	return cache.cmd.Eval(ctx, luaIncrCnt, []string{cache.key(biz, bizId), fieldCollectCnt}, 1).Err()
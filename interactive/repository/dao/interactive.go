@@ -19,6 +19,11 @@ type InteractiveDAO interface {
 	GetCollectionInfo(ctx context.Context, biz string, bizId, uid int64) (UserCollectionBiz, error)
 	InsertCollectionBiz(ctx context.Context, cb UserCollectionBiz) error
 	GetByIds(ctx context.Context, biz string, ids []int64) ([]Interactive, error)
+	// MergeUser 把 from 用户的点赞和收藏迁移到 to 用户，
+	// 涉及到的资源计数按合并之后的记录重新算，返回这些资源
+	MergeUser(ctx context.Context, from, to int64) ([]Interactive, error)
+	// DeleteUser 删除用户的点赞、收藏和收藏夹，计数跟着减，返回计数变了的资源
+	DeleteUser(ctx context.Context, uid int64) ([]Interactive, error)
 }
 
 type interactiveDAO struct {
@@ -39,6 +44,145 @@ func (dao *interactiveDAO) GetByIds(ctx context.Context, biz string, ids []int64
 	return res, err
 }
 
+func (dao *interactiveDAO) MergeUser(ctx context.Context, from, to int64) ([]Interactive, error) {
+	now := time.Now().UnixMilli()
+	// touched from 点赞、收藏过的资源，计数都要按合并之后的数据重新算
+	touched := map[Interactive]struct{}{}
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var likes []UserLikeBiz
+		err := tx.Where("uid = ?", from).Find(&likes).Error
+		if err != nil {
+			return err
+		}
+		for _, like := range likes {
+			touched[Interactive{Biz: like.Biz, BizId: like.BizId}] = struct{}{}
+			var dst UserLikeBiz
+			err = tx.Where("biz = ? AND biz_id = ? AND uid = ?", like.Biz, like.BizId, to).First(&dst).Error
+			switch err {
+			case gorm.ErrRecordNotFound:
+				err = tx.Model(&UserLikeBiz{}).Where("id = ?", like.Id).
+					Updates(map[string]any{"uid": to, "utime": now}).Error
+			case nil:
+				// 两个账号都有记录，保留 to 的，有一个点赞了就算点赞了
+				if like.Status == 1 && dst.Status != 1 {
+					err = tx.Model(&UserLikeBiz{}).Where("id = ?", dst.Id).
+						Updates(map[string]any{"status": 1, "utime": now}).Error
+				}
+				if err == nil {
+					err = tx.Delete(&UserLikeBiz{}, like.Id).Error
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		var cbs []UserCollectionBiz
+		err = tx.Where("uid = ?", from).Find(&cbs).Error
+		if err != nil {
+			return err
+		}
+		for _, cb := range cbs {
+			touched[Interactive{Biz: cb.Biz, BizId: cb.BizId}] = struct{}{}
+			var dst UserCollectionBiz
+			err = tx.Where("biz = ? AND biz_id = ? AND uid = ?", cb.Biz, cb.BizId, to).First(&dst).Error
+			switch err {
+			case gorm.ErrRecordNotFound:
+				err = tx.Model(&UserCollectionBiz{}).Where("id = ?", cb.Id).
+					Updates(map[string]any{"uid": to, "utime": now}).Error
+			case nil:
+				err = tx.Delete(&UserCollectionBiz{}, cb.Id).Error
+			}
+			if err != nil {
+				return err
+			}
+		}
+		for intr := range touched {
+			err = dao.recount(tx, intr.Biz, intr.BizId, now)
+			if err != nil {
+				return err
+			}
+		}
+		// 收藏夹整个归到 to 名下
+		return tx.Model(&Collection{}).Where("uid = ?", from).
+			Updates(map[string]any{"uid": to, "utime": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	changed := make([]Interactive, 0, len(touched))
+	for intr := range touched {
+		changed = append(changed, intr)
+	}
+	return changed, nil
+}
+
+// recount 按点赞、收藏的记录重新算计数，不在原来的计数上面加减，避免越算越偏
+func (dao *interactiveDAO) recount(tx *gorm.DB, biz string, bizId int64, now int64) error {
+	return tx.Model(&Interactive{}).
+		Where("biz = ? AND biz_id = ?", biz, bizId).
+		Updates(map[string]any{
+			"like_cnt": tx.Model(&UserLikeBiz{}).Select("COUNT(*)").
+				Where("biz = ? AND biz_id = ? AND status = ?", biz, bizId, 1),
+			"collect_cnt": tx.Model(&UserCollectionBiz{}).Select("COUNT(*)").
+				Where("biz = ? AND biz_id = ?", biz, bizId),
+			"utime": now,
+		}).Error
+}
+
+func (dao *interactiveDAO) DeleteUser(ctx context.Context, uid int64) ([]Interactive, error) {
+	now := time.Now().UnixMilli()
+	var changed []Interactive
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var likes []UserLikeBiz
+		err := tx.Where("uid = ? AND status = ?", uid, 1).Find(&likes).Error
+		if err != nil {
+			return err
+		}
+		for _, like := range likes {
+			changed = append(changed, Interactive{Biz: like.Biz, BizId: like.BizId})
+			err = tx.Model(&Interactive{}).
+				Where("biz = ? AND biz_id = ?", like.Biz, like.BizId).
+				Updates(map[string]any{
+					"like_cnt": gorm.Expr("like_cnt - 1"),
+					"utime":    now,
+				}).Error
+			if err != nil {
+				return err
+			}
+		}
+		// 取消了的点赞也是这个用户的数据，一起删掉
+		err = tx.Where("uid = ?", uid).Delete(&UserLikeBiz{}).Error
+		if err != nil {
+			return err
+		}
+
+		var cbs []UserCollectionBiz
+		err = tx.Where("uid = ?", uid).Find(&cbs).Error
+		if err != nil {
+			return err
+		}
+		for _, cb := range cbs {
+			changed = append(changed, Interactive{Biz: cb.Biz, BizId: cb.BizId})
+			err = tx.Model(&Interactive{}).
+				Where("biz = ? AND biz_id = ?", cb.Biz, cb.BizId).
+				Updates(map[string]any{
+					"collect_cnt": gorm.Expr("collect_cnt - 1"),
+					"utime":       now,
+				}).Error
+			if err != nil {
+				return err
+			}
+		}
+		err = tx.Where("uid = ?", uid).Delete(&UserCollectionBiz{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("uid = ?", uid).Delete(&Collection{}).Error
+	})
+	return changed, err
+}
+
 func (dao *interactiveDAO) GetLikeInfo(ctx context.Context, biz string, bizId, uid int64) (UserLikeBiz, error) {
 	var res UserLikeBiz
 	err := dao.db.WithContext(ctx).Where("biz=? AND biz_id = ? AND uid = ? AND status = ?", biz, bizId, uid, 1).First(&res).Error
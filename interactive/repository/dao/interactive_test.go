@@ -0,0 +1,94 @@
+package dao
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"sort"
+	"testing"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	// 内存数据库每个连接都是独立的
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, InitDB(db))
+	return db
+}
+
+func TestInteractiveDAO_MergeUser(t *testing.T) {
+	const from, to, other = 1, 2, 3
+	db := newTestDB(t)
+	likes := []UserLikeBiz{
+		// 1 两个人都点赞了
+		{Biz: "article", BizId: 1, Uid: from, Status: 1},
+		{Biz: "article", BizId: 1, Uid: to, Status: 1},
+		{Biz: "article", BizId: 1, Uid: other, Status: 1},
+		// 2 from 点赞了，to 点赞之后取消了
+		{Biz: "article", BizId: 2, Uid: from, Status: 1},
+		{Biz: "article", BizId: 2, Uid: to, Status: 0},
+		// 3 from 取消了，to 点赞了
+		{Biz: "article", BizId: 3, Uid: from, Status: 0},
+		{Biz: "article", BizId: 3, Uid: to, Status: 1},
+		// 4 只有 from 点赞了
+		{Biz: "article", BizId: 4, Uid: from, Status: 1},
+	}
+	require.NoError(t, db.Create(&likes).Error)
+	cbs := []UserCollectionBiz{
+		{Cid: 10, Biz: "article", BizId: 1, Uid: from},
+		{Cid: 20, Biz: "article", BizId: 1, Uid: to},
+		{Cid: 10, Biz: "article", BizId: 5, Uid: from},
+	}
+	require.NoError(t, db.Create(&cbs).Error)
+	require.NoError(t, db.Create(&[]Collection{{Id: 10, Uid: from}, {Id: 20, Uid: to}}).Error)
+	require.NoError(t, db.Create(&[]Interactive{
+		// 计数本来就偏了，合并之后也要和记录对上
+		{Biz: "article", BizId: 1, LikeCnt: 5, CollectCnt: 2},
+		{Biz: "article", BizId: 2, LikeCnt: 1},
+		{Biz: "article", BizId: 3, LikeCnt: 1},
+		{Biz: "article", BizId: 4, LikeCnt: 1},
+		{Biz: "article", BizId: 5, CollectCnt: 1},
+	}).Error)
+
+	changed, err := NewinteractiveDAO(db).MergeUser(context.Background(), from, to)
+	require.NoError(t, err)
+	ids := make([]int64, 0, len(changed))
+	for _, c := range changed {
+		ids = append(ids, c.BizId)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, ids)
+
+	var left int64
+	require.NoError(t, db.Model(&UserLikeBiz{}).Where("uid = ?", from).Count(&left).Error)
+	assert.Zero(t, left)
+	require.NoError(t, db.Model(&UserCollectionBiz{}).Where("uid = ?", from).Count(&left).Error)
+	assert.Zero(t, left)
+	require.NoError(t, db.Model(&Collection{}).Where("uid = ?", from).Count(&left).Error)
+	assert.Zero(t, left)
+
+	wantLiked := map[int64]uint8{1: 1, 2: 1, 3: 1, 4: 1}
+	for bizId, status := range wantLiked {
+		var like UserLikeBiz
+		require.NoError(t, db.Where("biz = ? AND biz_id = ? AND uid = ?", "article", bizId, to).First(&like).Error)
+		assert.Equal(t, status, like.Status, "biz_id %d", bizId)
+	}
+
+	wantCnt := map[int64][2]int64{
+		1: {2, 1},
+		2: {1, 0},
+		3: {1, 0},
+		4: {1, 0},
+		5: {0, 1},
+	}
+	for bizId, cnt := range wantCnt {
+		var intr Interactive
+		require.NoError(t, db.Where("biz = ? AND biz_id = ?", "article", bizId).First(&intr).Error)
+		assert.Equal(t, cnt, [2]int64{intr.LikeCnt, intr.CollectCnt}, "biz_id %d", bizId)
+	}
+}
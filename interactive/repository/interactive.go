@@ -18,6 +18,10 @@ type InteractiveRepository interface {
 	Liked(ctx context.Context, biz string, id int64, uid int64) (bool, error)
 	Collected(ctx context.Context, biz string, id int64, uid int64) (bool, error)
 	GetByIds(ctx context.Context, biz string, ids []int64) ([]domain.Interactive, error)
+	// MergeUser 账号合并，from 的点赞收藏迁移到 to
+	MergeUser(ctx context.Context, from, to int64) error
+	// DeleteUser 账号注销，清理点赞收藏
+	DeleteUser(ctx context.Context, uid int64) error
 }
 type interactiveRepository struct {
 	cache cache.InteractiveCache
@@ -40,6 +44,33 @@ func (repo *interactiveRepository) GetByIds(ctx context.Context, biz string, ids
 		return repo.toDomain(src)
 	}), nil
 }
+func (repo *interactiveRepository) MergeUser(ctx context.Context, from, to int64) error {
+	changed, err := repo.dao.MergeUser(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	return repo.delCache(ctx, changed)
+}
+
+func (repo *interactiveRepository) DeleteUser(ctx context.Context, uid int64) error {
+	changed, err := repo.dao.DeleteUser(ctx, uid)
+	if err != nil {
+		return err
+	}
+	return repo.delCache(ctx, changed)
+}
+
+// delCache 计数变了的直接删缓存，下次查询再加载
+func (repo *interactiveRepository) delCache(ctx context.Context, changed []dao.Interactive) error {
+	for _, intr := range changed {
+		err := repo.cache.Del(ctx, intr.Biz, intr.BizId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (repo *interactiveRepository) Liked(ctx context.Context, biz string, id int64, uid int64) (bool, error) {
 	_, err := repo.dao.GetLikeInfo(ctx, biz, id, uid)
 	switch err {
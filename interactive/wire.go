@@ -20,6 +20,8 @@ func InitApp() *App {
 		ioc.InitKafka,
 		ioc.NewConsumers,
 		events.NewReadEventArticleConsumer,
+		events.NewUserMergedConsumer,
+		events.NewUserDeletedConsumer,
 		repository.NewinteractiveRepository,
 		cache.NewinteractiveCache,
 		dao.NewinteractiveDAO,
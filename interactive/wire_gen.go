@@ -29,7 +29,9 @@ func InitApp() *App {
 	server := ioc.InitGRPCxServer(interactiveServiceServer)
 	client := ioc.InitKafka()
 	consumer := events.NewReadEventArticleConsumer(interactiveRepository, client)
-	v := ioc.NewConsumers(consumer)
+	userMergedConsumer := events.NewUserMergedConsumer(interactiveRepository, client)
+	userDeletedConsumer := events.NewUserDeletedConsumer(interactiveRepository, client)
+	v := ioc.NewConsumers(consumer, userMergedConsumer, userDeletedConsumer)
 	app := &App{
 		server:    server,
 		consumers: v,
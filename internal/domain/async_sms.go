@@ -0,0 +1,38 @@
+package domain
+
+import "time"
+
+type AsyncSmsStatus uint8
+
+const (
+	AsyncSmsStatusUnknown AsyncSmsStatus = iota
+	// AsyncSmsStatusWaiting 等待重试
+	AsyncSmsStatusWaiting
+	// AsyncSmsStatusSuccess 重试成功了
+	AsyncSmsStatusSuccess
+	// AsyncSmsStatusFailed 重试次数用完了、过期了或者遇到了重试也没用的错误，留给运维排查
+	AsyncSmsStatusFailed
+)
+
+func (s AsyncSmsStatus) ToUint8() uint8 {
+	return uint8(s)
+}
+
+// AsyncSms 同步发送失败，转成异步重试的短信
+type AsyncSms struct {
+	Id      int64
+	Tpl     string
+	Args    []string
+	Numbers []string
+	// Attempts 已经发送了几次，包括第一次同步发送
+	Attempts    int
+	MaxAttempts int
+	Status      AsyncSmsStatus
+	// LastErr 最后一次发送失败的原因
+	LastErr string
+	// NextTime 下一次重试的时间
+	NextTime time.Time
+	// ExpireTime 过了这个时间就不再发送了，比如验证码已经失效了
+	ExpireTime time.Time
+	Ctime      time.Time
+}
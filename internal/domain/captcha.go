@@ -0,0 +1,8 @@
+package domain
+
+// Captcha 图形验证码，答案只保存在 Redis 里面
+type Captcha struct {
+	Id string
+	// Image PNG 格式
+	Image []byte
+}
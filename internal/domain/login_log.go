@@ -0,0 +1,43 @@
+package domain
+
+import "time"
+
+type LoginAction string
+
+const (
+	LoginActionLogin   LoginAction = "login"
+	LoginActionRefresh LoginAction = "refresh"
+	LoginActionLogout  LoginAction = "logout"
+)
+
+// LoginLog 登录审计日志，只追加不修改
+type LoginLog struct {
+	Id int64
+	// Uid 登录失败的时候可能不知道是哪个用户，这个时候是 0
+	Uid    int64
+	Action LoginAction
+	// Method password、sms、2fa、wechat 或者第三方登录的名字，刷新和退出登录没有
+	Method string
+	// Account 登录时输入的邮箱或者手机号，方便排查撞库
+	Account   string
+	IP        string
+	UserAgent string
+	Ssid      string
+	Success   bool
+	// Code 返回给前端的错误码，成功是 200
+	Code  int
+	Ctime time.Time
+}
+
+// LoginLogQuery 零值的条件不生效
+type LoginLogQuery struct {
+	Uid     int64
+	Action  LoginAction
+	Method  string
+	Account string
+	IP      string
+	// OnlyFailed 只看失败的
+	OnlyFailed bool
+	Start      time.Time
+	End        time.Time
+}
@@ -0,0 +1,11 @@
+package domain
+
+// TOTP 用户绑定的动态口令
+type TOTP struct {
+	Uid    int64
+	Secret string
+	// Enabled 扫码之后输入一次验证码确认了才算启用
+	Enabled bool
+	// LastCounter 最后一次验证通过的周期，同一个验证码不能用两次
+	LastCounter int64
+}
@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// OAuth2Info 第三方平台返回的用户信息
+type OAuth2Info struct {
+	// Provider 平台的名字，比如说 github
+	Provider string
+	// Subject 用户在这个平台上的唯一 ID
+	Subject string
+	Email   string
+	// EmailVerified 平台不保证邮箱属于这个用户的时候，不能用来关联账号
+	EmailVerified bool
+	Nickname      string
+	Avatar        string
+}
+
+// OAuth2Binding 账号绑定的第三方登录
+type OAuth2Binding struct {
+	Uid      int64
+	Provider string
+	Subject  string
+	Email    string
+	Nickname string
+	Ctime    time.Time
+}
@@ -0,0 +1,51 @@
+package domain
+
+import "slices"
+
+// Role 角色，持久化的是用户有哪些角色，角色有哪些权限写死在代码里面
+type Role string
+
+const (
+	RoleAdmin  Role = "admin"
+	RoleEditor Role = "editor"
+)
+
+// 权限的命名是 资源:动作
+const (
+	PermArticleModerate = "article:moderate"
+	PermUserRead        = "user:read"
+	PermUserManage      = "user:manage"
+	PermRoleManage      = "role:manage"
+)
+
+var rolePermissions = map[Role][]string{
+	RoleAdmin: {
+		PermArticleModerate,
+		PermUserRead,
+		PermUserManage,
+		PermRoleManage,
+	},
+	RoleEditor: {
+		PermArticleModerate,
+		PermUserRead,
+	},
+}
+
+// Valid 是不是已经定义了的角色
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Permissions 多个角色的权限合在一起，去重
+func Permissions(roles []Role) []string {
+	var res []string
+	for _, r := range roles {
+		for _, p := range rolePermissions[r] {
+			if !slices.Contains(res, p) {
+				res = append(res, p)
+			}
+		}
+	}
+	return res
+}
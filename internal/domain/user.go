@@ -11,4 +11,85 @@ type User struct {
 	Utime      time.Time
 	WechatInfo WechatInfo
 	Nickname   string
+	Status     UserStatus
+
+	// 个人资料
+	Birthday time.Time
+	AboutMe  string
+	// Avatar 头像的 URL
+	Avatar string
+
+	// DeactivateTime 申请注销的时间，冷静期过了之后才会真的删除
+	DeactivateTime time.Time
+
+	// BanUntil 封禁到什么时候，零值代表没有封禁
+	BanUntil  time.Time
+	BanReason string
+}
+
+// BanForever 永久封禁
+var BanForever = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// Banned 现在是不是被封禁了
+func (u User) Banned() bool {
+	return time.Now().Before(u.BanUntil)
+}
+
+// UserQuery 管理后台查询用户，零值的条件不生效
+type UserQuery struct {
+	Id    int64
+	Email string
+	Phone string
+	// Nickname 前缀匹配
+	Nickname   string
+	CtimeStart time.Time
+	CtimeEnd   time.Time
+}
+
+// DeletedUserNickname 注销之后，文章作者显示成这个
+const DeletedUserNickname = "已注销用户"
+
+type UserStatus uint8
+
+const (
+	// UserStatusUnknown 老数据没有这个字段，统一当作已激活处理
+	UserStatusUnknown UserStatus = iota
+	// UserStatusActive 已激活
+	UserStatusActive
+	// UserStatusUnverified 邮箱注册，还没有完成验证
+	UserStatusUnverified
+	// UserStatusMerged 已经被合并到别的账号里面了，不能再登录
+	UserStatusMerged
+	// UserStatusDeactivated 申请了注销，冷静期内登录可以恢复
+	UserStatusDeactivated
+	// UserStatusDeleted 已经注销，个人信息都抹掉了
+	UserStatusDeleted
+)
+
+func (s UserStatus) ToUint8() uint8 {
+	return uint8(s)
+}
+
+// LoginMethod 账号上可以绑定的登录方式
+type LoginMethod string
+
+const (
+	LoginMethodPhone  LoginMethod = "phone"
+	LoginMethodEmail  LoginMethod = "email"
+	LoginMethodWechat LoginMethod = "wechat"
+)
+
+// LoginMethods 账号上已经绑定的登录方式
+func (u User) LoginMethods() []LoginMethod {
+	var res []LoginMethod
+	if u.Phone != "" {
+		res = append(res, LoginMethodPhone)
+	}
+	if u.Email != "" {
+		res = append(res, LoginMethodEmail)
+	}
+	if u.WechatInfo.OpenID != "" {
+		res = append(res, LoginMethodWechat)
+	}
+	return res
 }
@@ -1,6 +1,25 @@
 package domain
 
+import "time"
+
 type WechatInfo struct {
 	OpenID  string
 	UnionID string
 }
+
+// WechatToken 微信授权之后拿到的 token，access_token 两个小时过期，refresh_token 三十天过期
+type WechatToken struct {
+	OpenID        string
+	UnionID       string
+	AccessToken   string
+	RefreshToken  string
+	Scope         string
+	AccessExpire  time.Time
+	RefreshExpire time.Time
+}
+
+// WechatProfile 微信上的昵称和头像
+type WechatProfile struct {
+	Nickname string
+	Avatar   string
+}
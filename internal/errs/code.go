@@ -1,5 +1,15 @@
 package errs
 
+// 通用的错误码，没有区分模块，一般是 ginx 兜底用的
+const (
+	// Success 成功，为了兼容老的前端和 HTTP 的 200 保持一致
+	Success      = 200
+	InvalidInput = 400001
+	// InvalidFields 字段校验没有通过，Data 里面是每个字段的错误
+	InvalidFields       = 400002
+	InternalServerError = 500001
+)
+
 // 用户模块
 const (
 	// UserInvalidInput 用户模块输入错误，这是一个含糊的错误
@@ -8,6 +18,24 @@ const (
 	// UserInvalidOrPassword 用户不存在或者密码错误，这个你要小心，
 	// 防止有人跟你过不去
 	UserInvalidOrPassword = 401002
+	// UserNotActivated 邮箱注册之后还没有完成验证
+	UserNotActivated = 401003
+	// UserIdentityConflict 要绑定的手机号、邮箱或者微信已经属于别的账号，
+	// 这个时候 Data 里面会带上合并账号的凭证
+	UserIdentityConflict = 401004
+	// UserLastLoginMethod 不能解绑最后一种登录方式
+	UserLastLoginMethod = 401005
+	// UserLoginLocked 登录失败次数太多，暂时锁定
+	UserLoginLocked = 401006
+	// UserMFARequired 密码正确，但是开启了两步验证，Data 里面是换 token 用的临时凭证
+	UserMFARequired = 401007
+	// UserDeleted 账号已经注销了
+	UserDeleted = 401008
+	// UserBanned 账号被封禁了
+	UserBanned = 401009
+	// UserCaptchaRequired 触发了风控，要先通过图形验证码。
+	// 前端收到之后调用 /captcha 获取新的图形验证码，带上 captcha_id 和 captcha_answer 重试
+	UserCaptchaRequired = 401010
 )
 
 const (
@@ -0,0 +1,52 @@
+package user
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/repository"
+	"github.com/jym0818/webook/pkg/saramax"
+	"go.uber.org/zap"
+	"time"
+)
+
+// LoginLogConsumer 把登录消息写到 MySQL 的审计日志里面
+type LoginLogConsumer struct {
+	client sarama.Client
+	repo   repository.LoginLogRepository
+}
+
+func (c *LoginLogConsumer) Start() error {
+	cg, err := sarama.NewConsumerGroupFromClient("webook_login_log", c.client)
+	if err != nil {
+		return err
+	}
+	go func() {
+		er := cg.Consume(context.Background(), []string{topicUserLogin}, saramax.NewHandler[LoginEvent](c.Consume))
+		if er != nil {
+			zap.L().Error("退出了消费循环", zap.Error(er))
+		}
+	}()
+	return nil
+}
+
+func (c *LoginLogConsumer) Consume(msg *sarama.ConsumerMessage, evt LoginEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return c.repo.Create(ctx, domain.LoginLog{
+		Uid:       evt.Uid,
+		Action:    domain.LoginAction(evt.Action),
+		Method:    evt.Method,
+		Account:   evt.Account,
+		IP:        evt.IP,
+		UserAgent: evt.UserAgent,
+		Ssid:      evt.Ssid,
+		Success:   evt.Success,
+		Code:      evt.Code,
+		Ctime:     time.UnixMilli(evt.Ctime),
+	})
+}
+
+func NewLoginLogConsumer(repo repository.LoginLogRepository, client sarama.Client) *LoginLogConsumer {
+	return &LoginLogConsumer{repo: repo, client: client}
+}
@@ -0,0 +1,77 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/IBM/sarama"
+)
+
+const (
+	topicUserMerged  = "user_merged"
+	topicUserDeleted = "user_deleted"
+	topicUserLogin   = "user_login"
+)
+
+type Producer interface {
+	ProduceMergedEvent(ctx context.Context, evt MergedEvent) error
+	ProduceDeletedEvent(ctx context.Context, evt DeletedEvent) error
+	ProduceLoginEvent(ctx context.Context, evt LoginEvent) error
+}
+
+type KafkaProducer struct {
+	producer sarama.SyncProducer
+}
+
+func (k *KafkaProducer) ProduceMergedEvent(ctx context.Context, evt MergedEvent) error {
+	return k.produce(topicUserMerged, evt)
+}
+
+func (k *KafkaProducer) ProduceDeletedEvent(ctx context.Context, evt DeletedEvent) error {
+	return k.produce(topicUserDeleted, evt)
+}
+
+func (k *KafkaProducer) ProduceLoginEvent(ctx context.Context, evt LoginEvent) error {
+	return k.produce(topicUserLogin, evt)
+}
+
+func (k *KafkaProducer) produce(topic string, evt any) error {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	_, _, err = k.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(data),
+	})
+	return err
+}
+
+func NewKafkaProducer(producer sarama.SyncProducer) Producer {
+	return &KafkaProducer{producer: producer}
+}
+
+// MergedEvent From 账号被合并到了 To 账号
+type MergedEvent struct {
+	From int64
+	To   int64
+}
+
+// DeletedEvent 账号注销了，别的服务要清理这个用户的数据
+type DeletedEvent struct {
+	Uid int64
+}
+
+// LoginEvent 登录、刷新、退出登录，成功失败都有，消费者写到审计日志里面
+type LoginEvent struct {
+	Uid       int64
+	Action    string
+	Method    string
+	Account   string
+	IP        string
+	UserAgent string
+	Ssid      string
+	Success   bool
+	Code      int
+	// Ctime 发生的时间，毫秒数
+	Ctime int64
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/repository/dao"
+	"time"
+)
+
+type AsyncSmsRepository interface {
+	Add(ctx context.Context, s domain.AsyncSms) error
+	// PreemptWaiting 抢占到时间了的短信，lease 之内别的实例不会再抢到
+	PreemptWaiting(ctx context.Context, lease time.Duration, limit int) ([]domain.AsyncSms, error)
+	// ReportSuccess 和 ReportFinalFailure 之后不会再发送，参数会被清掉
+	ReportSuccess(ctx context.Context, id int64) error
+	ReportFinalFailure(ctx context.Context, id int64, lastErr string) error
+	// ReportFailure 记录一次失败，nextTime 重试
+	ReportFailure(ctx context.Context, id int64, lastErr string, nextTime time.Time) error
+}
+
+type asyncSmsRepository struct {
+	dao dao.AsyncSmsDAO
+}
+
+func NewasyncSmsRepository(dao dao.AsyncSmsDAO) AsyncSmsRepository {
+	return &asyncSmsRepository{dao: dao}
+}
+
+func (repo *asyncSmsRepository) Add(ctx context.Context, s domain.AsyncSms) error {
+	args, err := json.Marshal(s.Args)
+	if err != nil {
+		return err
+	}
+	numbers, err := json.Marshal(s.Numbers)
+	if err != nil {
+		return err
+	}
+	return repo.dao.Insert(ctx, dao.AsyncSms{
+		Tpl:         s.Tpl,
+		Args:        string(args),
+		Numbers:     string(numbers),
+		Attempts:    s.Attempts,
+		MaxAttempts: s.MaxAttempts,
+		Status:      domain.AsyncSmsStatusWaiting.ToUint8(),
+		NextTime:    s.NextTime.UnixMilli(),
+		ExpireTime:  s.ExpireTime.UnixMilli(),
+		LastErr:     repo.truncate(s.LastErr),
+	})
+}
+
+func (repo *asyncSmsRepository) PreemptWaiting(ctx context.Context, lease time.Duration, limit int) ([]domain.AsyncSms, error) {
+	ss, err := repo.dao.Preempt(ctx, time.Now().UnixMilli(), lease.Milliseconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.AsyncSms, 0, len(ss))
+	for _, s := range ss {
+		d := domain.AsyncSms{
+			Id:          s.Id,
+			Tpl:         s.Tpl,
+			Attempts:    s.Attempts,
+			MaxAttempts: s.MaxAttempts,
+			Status:      domain.AsyncSmsStatus(s.Status),
+			LastErr:     s.LastErr,
+			NextTime:    time.UnixMilli(s.NextTime),
+			ExpireTime:  time.UnixMilli(s.ExpireTime),
+			Ctime:       time.UnixMilli(s.Ctime),
+		}
+		// 解析不了的数据也交给上层，发送失败之后按失败处理
+		_ = json.Unmarshal([]byte(s.Args), &d.Args)
+		_ = json.Unmarshal([]byte(s.Numbers), &d.Numbers)
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+func (repo *asyncSmsRepository) ReportSuccess(ctx context.Context, id int64) error {
+	return repo.dao.MarkSuccess(ctx, id)
+}
+
+func (repo *asyncSmsRepository) ReportFinalFailure(ctx context.Context, id int64, lastErr string) error {
+	return repo.dao.MarkFinalFailed(ctx, id, repo.truncate(lastErr))
+}
+
+func (repo *asyncSmsRepository) ReportFailure(ctx context.Context, id int64, lastErr string, nextTime time.Time) error {
+	return repo.dao.MarkFailed(ctx, id, repo.truncate(lastErr), nextTime.UnixMilli())
+}
+
+// truncate 错误信息可能很长，超过字段长度 MySQL 会报错
+func (repo *asyncSmsRepository) truncate(msg string) string {
+	const maxLen = 512
+	r := []rune(msg)
+	if len(r) > maxLen {
+		return string(r[:maxLen])
+	}
+	return msg
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+type CaptchaCache interface {
+	Set(ctx context.Context, id, answer string, expiration time.Duration) error
+	// Verify 不管对错，答案都只能用一次，防止被反复猜
+	Verify(ctx context.Context, id, answer string) (bool, error)
+}
+
+type captchaCache struct {
+	cmd redis.Cmdable
+}
+
+func NewcaptchaCache(cmd redis.Cmdable) CaptchaCache {
+	return &captchaCache{cmd: cmd}
+}
+
+func (c *captchaCache) Set(ctx context.Context, id, answer string, expiration time.Duration) error {
+	return c.cmd.Set(ctx, c.key(id), answer, expiration).Err()
+}
+
+func (c *captchaCache) Verify(ctx context.Context, id, answer string) (bool, error) {
+	val, err := c.cmd.GetDel(ctx, c.key(id)).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return val == answer, nil
+}
+
+func (c *captchaCache) key(id string) string {
+	return fmt.Sprintf("captcha:%s", id)
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var (
+	ErrMagicLinkSendTooMany = errors.New("发送登录链接太频繁")
+	ErrMagicLinkNotFound    = errors.New("登录链接不存在或者已经用过了")
+)
+
+// magicLinkInterval 同一个邮箱两次发送登录链接的最小间隔
+const magicLinkInterval = time.Minute
+
+type MagicLinkCache interface {
+	// Set 同一个邮箱一分钟内只能发一次
+	Set(ctx context.Context, id, email string, expiration time.Duration) error
+	// GetDel 每个链接只能用一次
+	GetDel(ctx context.Context, id string) (string, error)
+}
+
+type magicLinkCache struct {
+	cmd redis.Cmdable
+}
+
+func NewmagicLinkCache(cmd redis.Cmdable) MagicLinkCache {
+	return &magicLinkCache{cmd: cmd}
+}
+
+func (c *magicLinkCache) Set(ctx context.Context, id, email string, expiration time.Duration) error {
+	ok, err := c.cmd.SetNX(ctx, c.sendKey(email), id, magicLinkInterval).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrMagicLinkSendTooMany
+	}
+	return c.cmd.Set(ctx, c.key(id), email, expiration).Err()
+}
+
+func (c *magicLinkCache) GetDel(ctx context.Context, id string) (string, error) {
+	email, err := c.cmd.GetDel(ctx, c.key(id)).Result()
+	if err == redis.Nil {
+		return "", ErrMagicLinkNotFound
+	}
+	return email, err
+}
+
+func (c *magicLinkCache) key(id string) string {
+	return fmt.Sprintf("user:magic_link:%s", id)
+}
+
+func (c *magicLinkCache) sendKey(email string) string {
+	return fmt.Sprintf("user:magic_link:send:%s", email)
+}
@@ -12,6 +12,7 @@ import (
 type UserCache interface {
 	Set(ctx context.Context, user domain.User) error
 	Get(ctx context.Context, uid int64) (domain.User, error)
+	Del(ctx context.Context, uid int64) error
 }
 
 type userCache struct {
@@ -28,6 +29,10 @@ func (cache *userCache) Set(ctx context.Context, user domain.User) error {
 	return cache.cmd.Set(ctx, key, u, cache.expiration).Err()
 }
 
+func (cache *userCache) Del(ctx context.Context, uid int64) error {
+	return cache.cmd.Del(ctx, cache.key(uid)).Err()
+}
+
 func (cache *userCache) key(uid int64) string {
 	return fmt.Sprintf("user:info:%d", uid)
 }
@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"github.com/jym0818/webook/internal/repository/cache"
+	"time"
+)
+
+type CaptchaRepository interface {
+	Store(ctx context.Context, id, answer string, expiration time.Duration) error
+	Verify(ctx context.Context, id, answer string) (bool, error)
+}
+
+type captchaRepository struct {
+	cache cache.CaptchaCache
+}
+
+func NewcaptchaRepository(cache cache.CaptchaCache) CaptchaRepository {
+	return &captchaRepository{cache: cache}
+}
+
+func (repo *captchaRepository) Store(ctx context.Context, id, answer string, expiration time.Duration) error {
+	return repo.cache.Set(ctx, id, answer, expiration)
+}
+
+func (repo *captchaRepository) Verify(ctx context.Context, id, answer string) (bool, error) {
+	return repo.cache.Verify(ctx, id, answer)
+}
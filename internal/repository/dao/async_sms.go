@@ -0,0 +1,108 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type AsyncSmsDAO interface {
+	Insert(ctx context.Context, s AsyncSms) error
+	// Preempt 取出到时间了的短信，同时把 next_time 往后推 lease 毫秒，
+	// 别的实例在这段时间里面不会再取到，发送的时候进程挂了，过了 lease 会重新被取出来
+	Preempt(ctx context.Context, now int64, lease int64, limit int) ([]AsyncSms, error)
+	// MarkSuccess 和 MarkFinalFailed 之后不会再发送了，顺便清掉参数，参数里面可能有验证码
+	MarkSuccess(ctx context.Context, id int64) error
+	MarkFinalFailed(ctx context.Context, id int64, lastErr string) error
+	// MarkFailed 记录一次失败，nextTime 重试
+	MarkFailed(ctx context.Context, id int64, lastErr string, nextTime int64) error
+}
+
+type asyncSmsDAO struct {
+	db *gorm.DB
+}
+
+func NewasyncSmsDAO(db *gorm.DB) AsyncSmsDAO {
+	return &asyncSmsDAO{db: db}
+}
+
+func (dao *asyncSmsDAO) Insert(ctx context.Context, s AsyncSms) error {
+	now := time.Now().UnixMilli()
+	s.Ctime = now
+	s.Utime = now
+	return dao.db.WithContext(ctx).Create(&s).Error
+}
+
+func (dao *asyncSmsDAO) Preempt(ctx context.Context, now int64, lease int64, limit int) ([]AsyncSms, error) {
+	var res []AsyncSms
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("status = ? AND next_time <= ?", asyncSmsStatusWaiting, now).
+			Order("next_time").Limit(limit).Find(&res).Error
+		if err != nil || len(res) == 0 {
+			return err
+		}
+		ids := make([]int64, 0, len(res))
+		for _, s := range res {
+			ids = append(ids, s.Id)
+		}
+		return tx.Model(&AsyncSms{}).Where("id IN ?", ids).Updates(map[string]any{
+			"next_time": now + lease,
+			"utime":     now,
+		}).Error
+	})
+	return res, err
+}
+
+func (dao *asyncSmsDAO) MarkSuccess(ctx context.Context, id int64) error {
+	return dao.db.WithContext(ctx).Model(&AsyncSms{}).Where("id = ?", id).Updates(map[string]any{
+		"attempts": gorm.Expr("attempts + 1"),
+		"status":   asyncSmsStatusSuccess,
+		"args":     "",
+		"utime":    time.Now().UnixMilli(),
+	}).Error
+}
+
+func (dao *asyncSmsDAO) MarkFinalFailed(ctx context.Context, id int64, lastErr string) error {
+	return dao.db.WithContext(ctx).Model(&AsyncSms{}).Where("id = ?", id).Updates(map[string]any{
+		"attempts": gorm.Expr("attempts + 1"),
+		"status":   asyncSmsStatusFailed,
+		"args":     "",
+		"last_err": lastErr,
+		"utime":    time.Now().UnixMilli(),
+	}).Error
+}
+
+func (dao *asyncSmsDAO) MarkFailed(ctx context.Context, id int64, lastErr string, nextTime int64) error {
+	return dao.db.WithContext(ctx).Model(&AsyncSms{}).Where("id = ?", id).Updates(map[string]any{
+		"attempts":  gorm.Expr("attempts + 1"),
+		"last_err":  lastErr,
+		"next_time": nextTime,
+		"utime":     time.Now().UnixMilli(),
+	}).Error
+}
+
+// 和 domain.AsyncSmsStatus 保持一致
+const (
+	asyncSmsStatusWaiting uint8 = 1
+	asyncSmsStatusSuccess uint8 = 2
+	asyncSmsStatusFailed  uint8 = 3
+)
+
+// AsyncSms 运维可以按 status = 3 查最终失败的短信
+type AsyncSms struct {
+	Id  int64  `gorm:"primaryKey,autoIncrement"`
+	Tpl string `gorm:"type:varchar(64)"`
+	// Args 和 Numbers 都是 JSON 数组，发送成功或者最终失败之后 Args 会被清空
+	Args        string `gorm:"type:varchar(1024)"`
+	Numbers     string `gorm:"type:varchar(4096)"`
+	Attempts    int
+	MaxAttempts int
+	Status      uint8 `gorm:"index:idx_status_next_time"`
+	NextTime    int64 `gorm:"index:idx_status_next_time"`
+	ExpireTime  int64
+	LastErr     string `gorm:"type:varchar(512)"`
+	Ctime       int64
+	Utime       int64
+}
@@ -5,6 +5,28 @@ import (
 )
 
 func InitDB(db *gorm.DB) error {
-	err := db.AutoMigrate(&User{}, &Article{}, &PublishedArticle{})
-	return err
+	err := db.AutoMigrate(&User{}, &Article{}, &PublishedArticle{},
+		&UserTOTP{}, &UserRecoveryCode{}, &UserOAuthBinding{}, &WechatToken{}, &UserRole{}, &LoginLog{}, &AsyncSms{},
+		&UserPhoneConflict{})
+	if err != nil {
+		return err
+	}
+	return migrateUserTimeToMilli(db)
+}
+
+// legacySecondsLimit 小于这个值的时间戳是秒，毫秒时间戳小于这个值的只有 1973 年之前
+const legacySecondsLimit = 100_000_000_000
+
+// migrateUserTimeToMilli 早期的 users 表 ctime、utime 存的是秒，现在统一是毫秒，
+// 不迁移的话按注册时间筛选用户的时候会漏掉老数据。只改还是秒的行，重复执行没有影响
+func migrateUserTimeToMilli(db *gorm.DB) error {
+	for _, col := range []string{"ctime", "utime"} {
+		err := db.Model(&User{}).
+			Where(col+" > 0 AND "+col+" < ?", legacySecondsLimit).
+			Update(col, gorm.Expr(col+" * 1000")).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,85 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+// LoginLogDAO 只有插入和查询，审计日志不允许修改
+type LoginLogDAO interface {
+	Insert(ctx context.Context, l LoginLog) error
+	Search(ctx context.Context, q LoginLogQuery, offset int, limit int) ([]LoginLog, error)
+}
+
+type LoginLogQuery struct {
+	Uid        int64
+	Action     string
+	Method     string
+	Account    string
+	IP         string
+	OnlyFailed bool
+	Start      int64
+	End        int64
+}
+
+type loginLogDAO struct {
+	db *gorm.DB
+}
+
+func NewloginLogDAO(db *gorm.DB) LoginLogDAO {
+	return &loginLogDAO{db: db}
+}
+
+func (dao *loginLogDAO) Insert(ctx context.Context, l LoginLog) error {
+	// Ctime 是事情发生的时间，消息可能晚一点才到
+	if l.Ctime == 0 {
+		l.Ctime = time.Now().UnixMilli()
+	}
+	return dao.db.WithContext(ctx).Create(&l).Error
+}
+
+func (dao *loginLogDAO) Search(ctx context.Context, q LoginLogQuery, offset int, limit int) ([]LoginLog, error) {
+	db := dao.db.WithContext(ctx).Model(&LoginLog{})
+	if q.Uid > 0 {
+		db = db.Where("uid = ?", q.Uid)
+	}
+	if q.Action != "" {
+		db = db.Where("action = ?", q.Action)
+	}
+	if q.Method != "" {
+		db = db.Where("method = ?", q.Method)
+	}
+	if q.Account != "" {
+		db = db.Where("account = ?", q.Account)
+	}
+	if q.IP != "" {
+		db = db.Where("ip = ?", q.IP)
+	}
+	if q.OnlyFailed {
+		db = db.Where("success = ?", false)
+	}
+	if q.Start > 0 {
+		db = db.Where("ctime >= ?", q.Start)
+	}
+	if q.End > 0 {
+		db = db.Where("ctime < ?", q.End)
+	}
+	var res []LoginLog
+	err := db.Order("ctime DESC, id DESC").Offset(offset).Limit(limit).Find(&res).Error
+	return res, err
+}
+
+type LoginLog struct {
+	Id        int64  `gorm:"primaryKey,autoIncrement"`
+	Uid       int64  `gorm:"index:idx_uid_ctime"`
+	Action    string `gorm:"type:varchar(16)"`
+	Method    string `gorm:"type:varchar(32)"`
+	Account   string `gorm:"type:varchar(128);index"`
+	IP        string `gorm:"type:varchar(64);index"`
+	UserAgent string `gorm:"type:varchar(512)"`
+	Ssid      string `gorm:"type:varchar(64)"`
+	Success   bool
+	Code      int
+	Ctime     int64 `gorm:"index:idx_uid_ctime"`
+}
@@ -0,0 +1,132 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var ErrMFANotFound = gorm.ErrRecordNotFound
+
+type MFADAO interface {
+	// UpsertTOTP 重新开始绑定，会覆盖掉还没有启用的密钥
+	UpsertTOTP(ctx context.Context, t UserTOTP) error
+	FindTOTP(ctx context.Context, uid int64) (UserTOTP, error)
+	// EnableTOTP 启用的同时写入恢复码，恢复码存的是哈希
+	EnableTOTP(ctx context.Context, uid int64, counter int64, codeHashes []string) error
+	DeleteTOTP(ctx context.Context, uid int64) error
+	// UpdateLastCounter 只有 counter 比之前的大才会更新，返回是否更新成功
+	UpdateLastCounter(ctx context.Context, uid int64, counter int64) (bool, error)
+	// UseRecoveryCode 返回是否找到了还没有用过的恢复码
+	UseRecoveryCode(ctx context.Context, uid int64, codeHash string) (bool, error)
+}
+
+type mfaDAO struct {
+	db *gorm.DB
+}
+
+func NewmfaDAO(db *gorm.DB) MFADAO {
+	return &mfaDAO{db: db}
+}
+
+func (dao *mfaDAO) UpsertTOTP(ctx context.Context, t UserTOTP) error {
+	now := time.Now().UnixMilli()
+	t.Ctime = now
+	t.Utime = now
+	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]any{
+			"secret":       t.Secret,
+			"enabled":      false,
+			"last_counter": 0,
+			"utime":        now,
+		}),
+	}).Create(&t).Error
+}
+
+func (dao *mfaDAO) FindTOTP(ctx context.Context, uid int64) (UserTOTP, error) {
+	var res UserTOTP
+	err := dao.db.WithContext(ctx).Where("uid = ?", uid).First(&res).Error
+	return res, err
+}
+
+func (dao *mfaDAO) EnableTOTP(ctx context.Context, uid int64, counter int64, codeHashes []string) error {
+	now := time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&UserTOTP{}).Where("uid = ?", uid).Updates(map[string]any{
+			"enabled":      true,
+			"last_counter": counter,
+			"utime":        now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		// 重新绑定的时候，老的恢复码全部作废
+		err = tx.Where("uid = ?", uid).Delete(&UserRecoveryCode{}).Error
+		if err != nil {
+			return err
+		}
+		codes := make([]UserRecoveryCode, 0, len(codeHashes))
+		for _, h := range codeHashes {
+			codes = append(codes, UserRecoveryCode{
+				Uid:      uid,
+				CodeHash: h,
+				Ctime:    now,
+				Utime:    now,
+			})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (dao *mfaDAO) DeleteTOTP(ctx context.Context, uid int64) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("uid = ?", uid).Delete(&UserTOTP{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("uid = ?", uid).Delete(&UserRecoveryCode{}).Error
+	})
+}
+
+func (dao *mfaDAO) UpdateLastCounter(ctx context.Context, uid int64, counter int64) (bool, error) {
+	res := dao.db.WithContext(ctx).Model(&UserTOTP{}).
+		Where("uid = ? AND last_counter < ?", uid, counter).
+		Updates(map[string]any{
+			"last_counter": counter,
+			"utime":        time.Now().UnixMilli(),
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (dao *mfaDAO) UseRecoveryCode(ctx context.Context, uid int64, codeHash string) (bool, error) {
+	res := dao.db.WithContext(ctx).Model(&UserRecoveryCode{}).
+		Where("uid = ? AND code_hash = ? AND used = ?", uid, codeHash, false).
+		Updates(map[string]any{
+			"used":  true,
+			"utime": time.Now().UnixMilli(),
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+type UserTOTP struct {
+	Id      int64  `gorm:"primaryKey,autoIncrement"`
+	Uid     int64  `gorm:"uniqueIndex"`
+	Secret  string `gorm:"type:varchar(64)"`
+	Enabled bool
+	// LastCounter 最后一次验证通过的周期
+	LastCounter int64
+	Ctime       int64
+	Utime       int64
+}
+
+// UserRecoveryCode 丢了手机的时候用来登录，每个只能用一次
+type UserRecoveryCode struct {
+	Id  int64 `gorm:"primaryKey,autoIncrement"`
+	Uid int64 `gorm:"index:uid_code"`
+	// CodeHash 恢复码本身是高熵的随机串，SHA-256 就够了
+	CodeHash string `gorm:"type:varchar(64);index:uid_code"`
+	Used     bool
+	Ctime    int64
+	Utime    int64
+}
@@ -0,0 +1,93 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+var ErrOAuth2BindingNotFound = gorm.ErrRecordNotFound
+
+type OAuth2BindingDAO interface {
+	FindBySubject(ctx context.Context, provider, subject string) (UserOAuthBinding, error)
+	FindByUid(ctx context.Context, uid int64) ([]UserOAuthBinding, error)
+	// Insert 这个第三方账号已经绑定了别人的时候返回 ErrUserDuplicate
+	Insert(ctx context.Context, b UserOAuthBinding) error
+	// InsertWithUser 第一次用第三方账号登录，同时创建用户和绑定关系，返回新用户的 ID
+	InsertWithUser(ctx context.Context, u User, b UserOAuthBinding) (int64, error)
+	Delete(ctx context.Context, uid int64, provider string) error
+}
+
+type oauth2BindingDAO struct {
+	db *gorm.DB
+}
+
+func Newoauth2BindingDAO(db *gorm.DB) OAuth2BindingDAO {
+	return &oauth2BindingDAO{db: db}
+}
+
+func (dao *oauth2BindingDAO) FindBySubject(ctx context.Context, provider, subject string) (UserOAuthBinding, error) {
+	var res UserOAuthBinding
+	err := dao.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).
+		First(&res).Error
+	return res, err
+}
+
+func (dao *oauth2BindingDAO) FindByUid(ctx context.Context, uid int64) ([]UserOAuthBinding, error) {
+	var res []UserOAuthBinding
+	err := dao.db.WithContext(ctx).Where("uid = ?", uid).Order("id").Find(&res).Error
+	return res, err
+}
+
+func (dao *oauth2BindingDAO) Insert(ctx context.Context, b UserOAuthBinding) error {
+	now := time.Now().UnixMilli()
+	b.Ctime = now
+	b.Utime = now
+	err := dao.db.WithContext(ctx).Create(&b).Error
+	if isDuplicate(err) {
+		return ErrUserDuplicate
+	}
+	return err
+}
+
+func (dao *oauth2BindingDAO) InsertWithUser(ctx context.Context, u User, b UserOAuthBinding) (int64, error) {
+	now := time.Now().UnixMilli()
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		u.Ctime = now
+		u.Utime = now
+		err := tx.Create(&u).Error
+		if err != nil {
+			return err
+		}
+		b.Uid = u.Id
+		b.Ctime = now
+		b.Utime = now
+		return tx.Create(&b).Error
+	})
+	if isDuplicate(err) {
+		return 0, ErrUserDuplicate
+	}
+	return u.Id, err
+}
+
+func (dao *oauth2BindingDAO) Delete(ctx context.Context, uid int64, provider string) error {
+	return dao.db.WithContext(ctx).Where("uid = ? AND provider = ?", uid, provider).
+		Delete(&UserOAuthBinding{}).Error
+}
+
+// UserOAuthBinding 一个第三方账号只能绑定一个用户，(provider, subject) 唯一
+type UserOAuthBinding struct {
+	Id       int64  `gorm:"primaryKey,autoIncrement"`
+	Uid      int64  `gorm:"index"`
+	Provider string `gorm:"type:varchar(32);uniqueIndex:provider_subject"`
+	Subject  string `gorm:"type:varchar(128);uniqueIndex:provider_subject"`
+	// Email Nickname 绑定的时候第三方平台返回的，只用来展示
+	Email    string `gorm:"type:varchar(256)"`
+	Nickname string `gorm:"type:varchar(128)"`
+	Ctime    int64
+	Utime    int64
+}
+
+func (UserOAuthBinding) TableName() string {
+	return "user_oauth_bindings"
+}
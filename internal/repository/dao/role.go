@@ -0,0 +1,50 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type RoleDAO interface {
+	FindByUid(ctx context.Context, uid int64) ([]UserRole, error)
+	// Insert 已经有这个角色的时候什么也不做
+	Insert(ctx context.Context, r UserRole) error
+	Delete(ctx context.Context, uid int64, role string) error
+}
+
+type roleDAO struct {
+	db *gorm.DB
+}
+
+func NewroleDAO(db *gorm.DB) RoleDAO {
+	return &roleDAO{db: db}
+}
+
+func (dao *roleDAO) FindByUid(ctx context.Context, uid int64) ([]UserRole, error) {
+	var res []UserRole
+	err := dao.db.WithContext(ctx).Where("uid = ?", uid).Order("id").Find(&res).Error
+	return res, err
+}
+
+func (dao *roleDAO) Insert(ctx context.Context, r UserRole) error {
+	now := time.Now().UnixMilli()
+	r.Ctime = now
+	r.Utime = now
+	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&r).Error
+}
+
+func (dao *roleDAO) Delete(ctx context.Context, uid int64, role string) error {
+	return dao.db.WithContext(ctx).Where("uid = ? AND role = ?", uid, role).
+		Delete(&UserRole{}).Error
+}
+
+type UserRole struct {
+	Id    int64  `gorm:"primaryKey,autoIncrement"`
+	Uid   int64  `gorm:"uniqueIndex:uid_role"`
+	Role  string `gorm:"type:varchar(32);uniqueIndex:uid_role"`
+	Ctime int64
+	Utime int64
+}
@@ -6,10 +6,15 @@ import (
 	"errors"
 	"github.com/go-sql-driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
 	"time"
 )
 
 var ErrUserDuplicateEmail = errors.New("邮件冲突")
+
+// ErrUserDuplicate 更新手机号、邮箱、微信的时候，和别的账号冲突了
+var ErrUserDuplicate = errors.New("用户信息冲突")
 var ErrUserNotFound = gorm.ErrRecordNotFound
 
 type UserDAO interface {
@@ -18,6 +23,45 @@ type UserDAO interface {
 	FindById(ctx context.Context, uid int64) (User, error)
 	FindByPhone(ctx context.Context, phone string) (User, error)
 	FindByWechat(ctx context.Context, openId string) (User, error)
+	UpdateStatus(ctx context.Context, uid int64, status uint8) error
+	UpdatePassword(ctx context.Context, uid int64, password string) error
+	UpdateStatusAndPassword(ctx context.Context, uid int64, status uint8, password string) error
+	// UpdateNonZeroFields 只更新非零值的字段
+	UpdateNonZeroFields(ctx context.Context, user User) error
+	// UpdateIdentity 更新手机号、邮箱、微信这一类带唯一索引的字段，值为 nil 就是解绑
+	UpdateIdentity(ctx context.Context, uid int64, fields map[string]any) error
+	// Merge 把 from 账号合并到 to 账号，包括登录方式和文章，from 账号会被标记为 status
+	Merge(ctx context.Context, from, to int64, status uint8) error
+	// Deactivate 申请注销，只是改状态
+	Deactivate(ctx context.Context, uid int64, status uint8) error
+	// FindDeactivated 找出 deactivateTime 在 before 之前申请注销的账号
+	FindDeactivated(ctx context.Context, status uint8, before int64, limit int) ([]User, error)
+	// Delete 真的注销账号。user 这一行会保留下来，不然文章找不到作者，
+	// 但是登录方式会被释放，个人资料会被抹掉，改成 deleted 里面的昵称和状态。
+	// 只有状态还是 expect 的时候才会删除，防止和冷静期内的登录并发，这个时候返回 ErrUserNotFound。
+	// withdraw 不为 0 的时候，文章都改成这个状态。
+	// 同一个事务里面会标记 PurgeEventPending，注销的消息发出去之后再清掉
+	Delete(ctx context.Context, uid int64, expect uint8, deleted User, withdraw uint8) error
+	// FindPurgeEventPending 找出已经注销了，但是注销的消息还没有发出去的账号
+	FindPurgeEventPending(ctx context.Context, limit int) ([]int64, error)
+	ClearPurgeEventPending(ctx context.Context, uid int64) error
+	// UpdateBan until 为 0 就是解封
+	UpdateBan(ctx context.Context, uid int64, until int64, reason string) error
+	Search(ctx context.Context, q UserQuery, offset int, limit int) ([]User, error)
+	// FindUnnormalizedPhones 找出手机号还不是 E.164 格式的老数据，按 id 分批
+	FindUnnormalizedPhones(ctx context.Context, startId int64, limit int) ([]User, error)
+	// UpsertPhoneConflict 同一个账号同一个号码只保留一行，重复迁移只会更新 owner
+	UpsertPhoneConflict(ctx context.Context, c UserPhoneConflict) error
+}
+
+// UserQuery 零值的条件不生效，时间是毫秒数
+type UserQuery struct {
+	Id         int64
+	Email      string
+	Phone      string
+	Nickname   string
+	CtimeStart int64
+	CtimeEnd   int64
 }
 
 type userDAO struct {
@@ -26,7 +70,7 @@ type userDAO struct {
 
 func (dao *userDAO) FindByWechat(ctx context.Context, openID string) (User, error) {
 	var u User
-	err := dao.db.WithContext(ctx).Where("openID = ?", openID).First(&u).Error
+	err := dao.db.WithContext(ctx).Where("wechat_open_id = ?", openID).First(&u).Error
 	//无需检查错误，找不到会返回ErrRecordNotFound和空结构体
 	return u, err
 }
@@ -48,12 +92,268 @@ func (dao *userDAO) FindByPhone(ctx context.Context, phone string) (User, error)
 	err := dao.db.WithContext(ctx).Where("phone= ?", phone).First(&user).Error
 	return user, err
 }
+
+func (dao *userDAO) UpdateStatus(ctx context.Context, uid int64, status uint8) error {
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", uid).
+		Updates(map[string]any{
+			"status": status,
+			"utime":  time.Now().UnixMilli(),
+		}).Error
+}
+
+func (dao *userDAO) UpdatePassword(ctx context.Context, uid int64, password string) error {
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", uid).
+		Updates(map[string]any{
+			"password": password,
+			"utime":    time.Now().UnixMilli(),
+		}).Error
+}
+
+func (dao *userDAO) UpdateStatusAndPassword(ctx context.Context, uid int64, status uint8, password string) error {
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", uid).
+		Updates(map[string]any{
+			"status":   status,
+			"password": password,
+			"utime":    time.Now().UnixMilli(),
+		}).Error
+}
+
+func (dao *userDAO) UpdateNonZeroFields(ctx context.Context, user User) error {
+	user.Utime = time.Now().UnixMilli()
+	// 用结构体更新的时候，GORM 会忽略零值
+	return dao.db.WithContext(ctx).Model(&user).Where("id = ?", user.Id).Updates(&user).Error
+}
+
+func (dao *userDAO) UpdateIdentity(ctx context.Context, uid int64, fields map[string]any) error {
+	fields["utime"] = time.Now().UnixMilli()
+	err := dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", uid).Updates(fields).Error
+	if isDuplicate(err) {
+		return ErrUserDuplicate
+	}
+	return err
+}
+
+func (dao *userDAO) Merge(ctx context.Context, from, to int64, status uint8) error {
+	now := time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var src, dst User
+		err := tx.Where("id = ?", from).First(&src).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("id = ?", to).First(&dst).Error
+		if err != nil {
+			return err
+		}
+		// 目标账号已经有的，以目标账号为准
+		updates := map[string]any{"utime": now}
+		if !dst.Email.Valid && src.Email.Valid {
+			updates["email"] = src.Email
+			updates["password"] = src.Password
+		}
+		if !dst.Phone.Valid && src.Phone.Valid {
+			updates["phone"] = src.Phone
+		}
+		if !dst.WechatOpenID.Valid && src.WechatOpenID.Valid {
+			updates["wechat_open_id"] = src.WechatOpenID
+			updates["wechat_union_id"] = src.WechatUnionID
+		}
+		if dst.Nickname == "" && src.Nickname != "" {
+			updates["nickname"] = src.Nickname
+		}
+		// 先清空原账号的登录方式，不然唯一索引会冲突
+		err = tx.Model(&User{}).Where("id = ?", from).Updates(map[string]any{
+			"email":           nil,
+			"phone":           nil,
+			"wechat_open_id":  nil,
+			"wechat_union_id": nil,
+			"status":          status,
+			"utime":           now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&User{}).Where("id = ?", to).Updates(updates).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&UserOAuthBinding{}).Where("uid = ?", from).
+			Updates(map[string]any{"uid": to, "utime": now}).Error
+		if err != nil {
+			return err
+		}
+		// 文章归到目标账号下面，utime 不动，不然会影响热榜
+		err = tx.Model(&Article{}).Where("author_id = ?", from).
+			Update("author_id", to).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&PublishedArticle{}).Where("author_id = ?", from).
+			Update("author_id", to).Error
+	})
+}
+
+func (dao *userDAO) Deactivate(ctx context.Context, uid int64, status uint8) error {
+	now := time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", uid).
+		Updates(map[string]any{
+			"status":          status,
+			"deactivate_time": now,
+			"utime":           now,
+		}).Error
+}
+
+func (dao *userDAO) FindDeactivated(ctx context.Context, status uint8, before int64, limit int) ([]User, error) {
+	var res []User
+	err := dao.db.WithContext(ctx).
+		Where("status = ? AND deactivate_time < ?", status, before).
+		Order("id").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (dao *userDAO) FindPurgeEventPending(ctx context.Context, limit int) ([]int64, error) {
+	var res []int64
+	err := dao.db.WithContext(ctx).Model(&User{}).
+		Where("purge_event_pending = ?", true).
+		Order("id").Limit(limit).Pluck("id", &res).Error
+	return res, err
+}
+
+func (dao *userDAO) ClearPurgeEventPending(ctx context.Context, uid int64) error {
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", uid).
+		Update("purge_event_pending", false).Error
+}
+
+func (dao *userDAO) Delete(ctx context.Context, uid int64, expect uint8, deleted User, withdraw uint8) error {
+	now := time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var u User
+		err := tx.Where("id = ? AND status = ?", uid, expect).First(&u).Error
+		if err != nil {
+			return err
+		}
+		res := tx.Model(&User{}).Where("id = ? AND status = ?", uid, expect).
+			Updates(map[string]any{
+				"email":           nil,
+				"phone":           nil,
+				"wechat_open_id":  nil,
+				"wechat_union_id": nil,
+				"password":        "",
+				"nickname":        deleted.Nickname,
+				"birthday":        0,
+				"about_me":        "",
+				"avatar":          "",
+				"status":          deleted.Status,
+				// 和抹掉个人信息在一个事务里面，消息没发出去也不会丢
+				"purge_event_pending": true,
+				"utime":               now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		if u.WechatOpenID.Valid {
+			err = tx.Where("open_id = ?", u.WechatOpenID.String).Delete(&WechatToken{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		for _, m := range []any{&UserOAuthBinding{}, &UserTOTP{}, &UserRecoveryCode{}, &UserRole{}} {
+			err = tx.Where("uid = ?", uid).Delete(m).Error
+			if err != nil {
+				return err
+			}
+		}
+		if withdraw == 0 {
+			return nil
+		}
+		for _, m := range []any{&Article{}, &PublishedArticle{}} {
+			err = tx.Model(m).Where("author_id = ?", uid).
+				Updates(map[string]any{"status": withdraw, "utime": now}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (dao *userDAO) UpdateBan(ctx context.Context, uid int64, until int64, reason string) error {
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", uid).
+		Updates(map[string]any{
+			"ban_until":  until,
+			"ban_reason": reason,
+			"utime":      time.Now().UnixMilli(),
+		}).Error
+}
+
+func (dao *userDAO) Search(ctx context.Context, q UserQuery, offset int, limit int) ([]User, error) {
+	db := dao.db.WithContext(ctx).Model(&User{})
+	if q.Id > 0 {
+		db = db.Where("id = ?", q.Id)
+	}
+	if q.Email != "" {
+		db = db.Where("email = ?", q.Email)
+	}
+	if q.Phone != "" {
+		db = db.Where("phone = ?", q.Phone)
+	}
+	if q.Nickname != "" {
+		// 只支持前缀匹配，不然用不上索引
+		db = db.Where("nickname LIKE ?", escapeLike(q.Nickname)+"%")
+	}
+	if q.CtimeStart > 0 {
+		db = db.Where("ctime >= ?", q.CtimeStart)
+	}
+	if q.CtimeEnd > 0 {
+		db = db.Where("ctime < ?", q.CtimeEnd)
+	}
+	var res []User
+	err := db.Order("id DESC").Offset(offset).Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (dao *userDAO) FindUnnormalizedPhones(ctx context.Context, startId int64, limit int) ([]User, error) {
+	var res []User
+	err := dao.db.WithContext(ctx).
+		Where("id > ? AND phone IS NOT NULL AND phone NOT LIKE ?", startId, "+%").
+		Order("id").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (dao *userDAO) UpsertPhoneConflict(ctx context.Context, c UserPhoneConflict) error {
+	now := time.Now().UnixMilli()
+	c.Ctime = now
+	c.Utime = now
+	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]any{
+			"owner_id": c.OwnerId,
+			"utime":    now,
+		}),
+	}).Create(&c).Error
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func isDuplicate(err error) bool {
+	if me, ok := err.(*mysql.MySQLError); ok {
+		const uniqueIndexErrNo uint16 = 1062
+		return me.Number == uniqueIndexErrNo
+	}
+	return false
+}
+
 func NewuserDAO(db *gorm.DB) UserDAO {
 	return &userDAO{db: db}
 }
 
 func (dao *userDAO) Insert(ctx context.Context, user User) error {
-	now := time.Now().Unix()
+	// 和别的地方一样用毫秒，之前这里用的是秒
+	now := time.Now().UnixMilli()
 	user.Ctime = now
 	user.Utime = now
 	err := dao.db.WithContext(ctx).Create(&user).Error
@@ -76,5 +376,34 @@ type User struct {
 	WechatUnionID sql.NullString
 	WechatOpenID  sql.NullString `gorm:"unique"`
 	//openID 一定是唯一的
-	Nickname string
+	Nickname string `gorm:"index"`
+	// 0 是老数据，当作已激活
+	Status uint8
+
+	// Birthday 毫秒数，0 代表没有设置
+	Birthday int64
+	AboutMe  string `gorm:"type:varchar(4096)"`
+	Avatar   string `gorm:"type:varchar(1024)"`
+
+	// DeactivateTime 申请注销的毫秒数
+	DeactivateTime int64 `gorm:"index"`
+
+	// BanUntil 封禁到什么时候的毫秒数，0 代表没有封禁
+	BanUntil  int64
+	BanReason string `gorm:"type:varchar(1024)"`
+
+	// PurgeEventPending 注销之后还没有通知 interactive 服务清理点赞收藏
+	PurgeEventPending bool `gorm:"index"`
+}
+
+// UserPhoneConflict 迁移成 E.164 之后手机号和别的账号重复了，
+// 留给客服联系用户合并账号，合并之后删掉
+type UserPhoneConflict struct {
+	Id  int64 `gorm:"primaryKey,autoIncrement"`
+	Uid int64 `gorm:"uniqueIndex:uid_phone"`
+	// Phone 迁移之后的号码，Uid 账号里面还是老格式
+	Phone   string `gorm:"type:varchar(32);uniqueIndex:uid_phone"`
+	OwnerId int64  `gorm:"index"`
+	Ctime   int64
+	Utime   int64
 }
@@ -0,0 +1,61 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var ErrWechatTokenNotFound = gorm.ErrRecordNotFound
+
+type WechatTokenDAO interface {
+	Upsert(ctx context.Context, t WechatToken) error
+	FindByOpenID(ctx context.Context, openID string) (WechatToken, error)
+}
+
+type wechatTokenDAO struct {
+	db *gorm.DB
+}
+
+func NewwechatTokenDAO(db *gorm.DB) WechatTokenDAO {
+	return &wechatTokenDAO{db: db}
+}
+
+func (dao *wechatTokenDAO) Upsert(ctx context.Context, t WechatToken) error {
+	now := time.Now().UnixMilli()
+	t.Ctime = now
+	t.Utime = now
+	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]any{
+			"union_id":       t.UnionID,
+			"access_token":   t.AccessToken,
+			"refresh_token":  t.RefreshToken,
+			"scope":          t.Scope,
+			"access_expire":  t.AccessExpire,
+			"refresh_expire": t.RefreshExpire,
+			"utime":          now,
+		}),
+	}).Create(&t).Error
+}
+
+func (dao *wechatTokenDAO) FindByOpenID(ctx context.Context, openID string) (WechatToken, error) {
+	var res WechatToken
+	err := dao.db.WithContext(ctx).Where("open_id = ?", openID).First(&res).Error
+	return res, err
+}
+
+// WechatToken 调用微信接口要用的 token，按照 openid 保存
+type WechatToken struct {
+	Id           int64  `gorm:"primaryKey,autoIncrement"`
+	OpenID       string `gorm:"type:varchar(128);uniqueIndex"`
+	UnionID      string `gorm:"type:varchar(128)"`
+	AccessToken  string `gorm:"type:varchar(512)"`
+	RefreshToken string `gorm:"type:varchar(512)"`
+	Scope        string `gorm:"type:varchar(128)"`
+	// AccessExpire RefreshExpire 毫秒数
+	AccessExpire  int64
+	RefreshExpire int64
+	Ctime         int64
+	Utime         int64
+}
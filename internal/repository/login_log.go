@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/repository/dao"
+	"time"
+)
+
+type LoginLogRepository interface {
+	Create(ctx context.Context, l domain.LoginLog) error
+	Search(ctx context.Context, q domain.LoginLogQuery, offset int, limit int) ([]domain.LoginLog, error)
+}
+
+type loginLogRepository struct {
+	dao dao.LoginLogDAO
+}
+
+func NewloginLogRepository(dao dao.LoginLogDAO) LoginLogRepository {
+	return &loginLogRepository{dao: dao}
+}
+
+func (repo *loginLogRepository) Create(ctx context.Context, l domain.LoginLog) error {
+	return repo.dao.Insert(ctx, dao.LoginLog{
+		Uid:       l.Uid,
+		Action:    string(l.Action),
+		Method:    l.Method,
+		Account:   l.Account,
+		IP:        l.IP,
+		UserAgent: l.UserAgent,
+		Ssid:      l.Ssid,
+		Success:   l.Success,
+		Code:      l.Code,
+		Ctime:     repo.toMilli(l.Ctime),
+	})
+}
+
+func (repo *loginLogRepository) Search(ctx context.Context, q domain.LoginLogQuery, offset int, limit int) ([]domain.LoginLog, error) {
+	ls, err := repo.dao.Search(ctx, dao.LoginLogQuery{
+		Uid:        q.Uid,
+		Action:     string(q.Action),
+		Method:     q.Method,
+		Account:    q.Account,
+		IP:         q.IP,
+		OnlyFailed: q.OnlyFailed,
+		Start:      repo.toMilli(q.Start),
+		End:        repo.toMilli(q.End),
+	}, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.LoginLog, 0, len(ls))
+	for _, l := range ls {
+		res = append(res, domain.LoginLog{
+			Id:        l.Id,
+			Uid:       l.Uid,
+			Action:    domain.LoginAction(l.Action),
+			Method:    l.Method,
+			Account:   l.Account,
+			IP:        l.IP,
+			UserAgent: l.UserAgent,
+			Ssid:      l.Ssid,
+			Success:   l.Success,
+			Code:      l.Code,
+			Ctime:     time.UnixMilli(l.Ctime),
+		})
+	}
+	return res, nil
+}
+
+func (repo *loginLogRepository) toMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"github.com/jym0818/webook/internal/repository/cache"
+	"time"
+)
+
+var (
+	ErrMagicLinkSendTooMany = cache.ErrMagicLinkSendTooMany
+	ErrMagicLinkNotFound    = cache.ErrMagicLinkNotFound
+)
+
+type MagicLinkRepository interface {
+	Store(ctx context.Context, id, email string, expiration time.Duration) error
+	// Consume 返回链接对应的邮箱，之后这个链接就失效了
+	Consume(ctx context.Context, id string) (string, error)
+}
+
+type magicLinkRepository struct {
+	cache cache.MagicLinkCache
+}
+
+func NewmagicLinkRepository(cache cache.MagicLinkCache) MagicLinkRepository {
+	return &magicLinkRepository{cache: cache}
+}
+
+func (repo *magicLinkRepository) Store(ctx context.Context, id, email string, expiration time.Duration) error {
+	return repo.cache.Set(ctx, id, email, expiration)
+}
+
+func (repo *magicLinkRepository) Consume(ctx context.Context, id string) (string, error) {
+	return repo.cache.GetDel(ctx, id)
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/repository/dao"
+)
+
+var ErrMFANotFound = dao.ErrMFANotFound
+
+type MFARepository interface {
+	SaveTOTP(ctx context.Context, t domain.TOTP) error
+	FindTOTP(ctx context.Context, uid int64) (domain.TOTP, error)
+	EnableTOTP(ctx context.Context, uid int64, counter int64, codeHashes []string) error
+	DeleteTOTP(ctx context.Context, uid int64) error
+	UpdateLastCounter(ctx context.Context, uid int64, counter int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, uid int64, codeHash string) (bool, error)
+}
+
+type mfaRepository struct {
+	dao dao.MFADAO
+}
+
+func NewmfaRepository(dao dao.MFADAO) MFARepository {
+	return &mfaRepository{dao: dao}
+}
+
+func (repo *mfaRepository) SaveTOTP(ctx context.Context, t domain.TOTP) error {
+	return repo.dao.UpsertTOTP(ctx, dao.UserTOTP{
+		Uid:    t.Uid,
+		Secret: t.Secret,
+	})
+}
+
+func (repo *mfaRepository) FindTOTP(ctx context.Context, uid int64) (domain.TOTP, error) {
+	t, err := repo.dao.FindTOTP(ctx, uid)
+	if err != nil {
+		return domain.TOTP{}, err
+	}
+	return domain.TOTP{
+		Uid:         t.Uid,
+		Secret:      t.Secret,
+		Enabled:     t.Enabled,
+		LastCounter: t.LastCounter,
+	}, nil
+}
+
+func (repo *mfaRepository) EnableTOTP(ctx context.Context, uid int64, counter int64, codeHashes []string) error {
+	return repo.dao.EnableTOTP(ctx, uid, counter, codeHashes)
+}
+
+func (repo *mfaRepository) DeleteTOTP(ctx context.Context, uid int64) error {
+	return repo.dao.DeleteTOTP(ctx, uid)
+}
+
+func (repo *mfaRepository) UpdateLastCounter(ctx context.Context, uid int64, counter int64) (bool, error) {
+	return repo.dao.UpdateLastCounter(ctx, uid, counter)
+}
+
+func (repo *mfaRepository) UseRecoveryCode(ctx context.Context, uid int64, codeHash string) (bool, error) {
+	return repo.dao.UseRecoveryCode(ctx, uid, codeHash)
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/repository/dao"
+	"time"
+)
+
+var ErrOAuth2BindingNotFound = dao.ErrOAuth2BindingNotFound
+
+type OAuth2BindingRepository interface {
+	FindBySubject(ctx context.Context, provider, subject string) (domain.OAuth2Binding, error)
+	FindByUid(ctx context.Context, uid int64) ([]domain.OAuth2Binding, error)
+	Bind(ctx context.Context, uid int64, info domain.OAuth2Info) error
+	// CreateUser 用第三方账号的信息创建一个新用户，返回新用户的 ID
+	CreateUser(ctx context.Context, info domain.OAuth2Info) (int64, error)
+	Unbind(ctx context.Context, uid int64, provider string) error
+}
+
+type oauth2BindingRepository struct {
+	dao dao.OAuth2BindingDAO
+}
+
+func Newoauth2BindingRepository(dao dao.OAuth2BindingDAO) OAuth2BindingRepository {
+	return &oauth2BindingRepository{dao: dao}
+}
+
+func (repo *oauth2BindingRepository) FindBySubject(ctx context.Context, provider, subject string) (domain.OAuth2Binding, error) {
+	b, err := repo.dao.FindBySubject(ctx, provider, subject)
+	if err != nil {
+		return domain.OAuth2Binding{}, err
+	}
+	return repo.toDomain(b), nil
+}
+
+func (repo *oauth2BindingRepository) FindByUid(ctx context.Context, uid int64) ([]domain.OAuth2Binding, error) {
+	bs, err := repo.dao.FindByUid(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.OAuth2Binding, 0, len(bs))
+	for _, b := range bs {
+		res = append(res, repo.toDomain(b))
+	}
+	return res, nil
+}
+
+func (repo *oauth2BindingRepository) Bind(ctx context.Context, uid int64, info domain.OAuth2Info) error {
+	b := repo.toEntity(info)
+	b.Uid = uid
+	return repo.dao.Insert(ctx, b)
+}
+
+func (repo *oauth2BindingRepository) CreateUser(ctx context.Context, info domain.OAuth2Info) (int64, error) {
+	// 第三方平台的邮箱不一定可信，不写到用户的邮箱字段里面，不然就能用来找回密码了
+	return repo.dao.InsertWithUser(ctx, dao.User{
+		Nickname: info.Nickname,
+		Avatar:   info.Avatar,
+		Status:   domain.UserStatusActive.ToUint8(),
+	}, repo.toEntity(info))
+}
+
+func (repo *oauth2BindingRepository) Unbind(ctx context.Context, uid int64, provider string) error {
+	return repo.dao.Delete(ctx, uid, provider)
+}
+
+func (repo *oauth2BindingRepository) toEntity(info domain.OAuth2Info) dao.UserOAuthBinding {
+	return dao.UserOAuthBinding{
+		Provider: info.Provider,
+		Subject:  info.Subject,
+		Email:    info.Email,
+		Nickname: info.Nickname,
+	}
+}
+
+func (repo *oauth2BindingRepository) toDomain(b dao.UserOAuthBinding) domain.OAuth2Binding {
+	return domain.OAuth2Binding{
+		Uid:      b.Uid,
+		Provider: b.Provider,
+		Subject:  b.Subject,
+		Email:    b.Email,
+		Nickname: b.Nickname,
+		Ctime:    time.UnixMilli(b.Ctime),
+	}
+}
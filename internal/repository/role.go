@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/repository/dao"
+)
+
+type RoleRepository interface {
+	FindByUid(ctx context.Context, uid int64) ([]domain.Role, error)
+	Grant(ctx context.Context, uid int64, role domain.Role) error
+	Revoke(ctx context.Context, uid int64, role domain.Role) error
+}
+
+type roleRepository struct {
+	dao dao.RoleDAO
+}
+
+func NewroleRepository(dao dao.RoleDAO) RoleRepository {
+	return &roleRepository{dao: dao}
+}
+
+func (repo *roleRepository) FindByUid(ctx context.Context, uid int64) ([]domain.Role, error) {
+	rs, err := repo.dao.FindByUid(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Role, 0, len(rs))
+	for _, r := range rs {
+		res = append(res, domain.Role(r.Role))
+	}
+	return res, nil
+}
+
+func (repo *roleRepository) Grant(ctx context.Context, uid int64, role domain.Role) error {
+	return repo.dao.Insert(ctx, dao.UserRole{Uid: uid, Role: string(role)})
+}
+
+func (repo *roleRepository) Revoke(ctx context.Context, uid int64, role domain.Role) error {
+	return repo.dao.Delete(ctx, uid, string(role))
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"github.com/jym0818/webook/internal/domain"
 	"github.com/jym0818/webook/internal/repository/cache"
 	"github.com/jym0818/webook/internal/repository/dao"
@@ -11,6 +12,7 @@ import (
 
 var ErrUserDuplicateEmail = dao.ErrUserDuplicateEmail
 var ErrUserNotFound = dao.ErrUserNotFound
+var ErrUserDuplicate = dao.ErrUserDuplicate
 
 type UserRepository interface {
 	Create(ctx context.Context, user domain.User) error
@@ -18,6 +20,35 @@ type UserRepository interface {
 	FindById(ctx context.Context, uid int64) (domain.User, error)
 	FindByPhone(ctx context.Context, phone string) (domain.User, error)
 	FindByWechat(ctx context.Context, openId string) (domain.User, error)
+	UpdateStatus(ctx context.Context, uid int64, status domain.UserStatus) error
+	UpdatePassword(ctx context.Context, uid int64, password string) error
+	// UpdateStatusAndPassword 在一个 UPDATE 里面同时改状态和密码，password 是已经加密过的
+	UpdateStatusAndPassword(ctx context.Context, uid int64, status domain.UserStatus, password string) error
+	// UpdateNonZeroFields 更新个人资料，零值的字段不会被更新
+	UpdateNonZeroFields(ctx context.Context, user domain.User) error
+
+	BindPhone(ctx context.Context, uid int64, phone string) error
+	// BindEmail password 是已经加密过的
+	BindEmail(ctx context.Context, uid int64, email string, password string) error
+	BindWechat(ctx context.Context, uid int64, info domain.WechatInfo) error
+	Unbind(ctx context.Context, uid int64, method domain.LoginMethod) error
+	Merge(ctx context.Context, from, to int64) error
+
+	Deactivate(ctx context.Context, uid int64) error
+	// FindDeactivated 找出在 before 之前申请注销的账号
+	FindDeactivated(ctx context.Context, before time.Time, limit int) ([]domain.User, error)
+	// Delete 注销账号，账号已经不是申请注销的状态了会返回 ErrUserNotFound
+	Delete(ctx context.Context, uid int64, withdrawArticles bool) error
+	// FindPurgeEventPending 注销了但是消息还没有发出去的账号
+	FindPurgeEventPending(ctx context.Context, limit int) ([]int64, error)
+	ClearPurgeEventPending(ctx context.Context, uid int64) error
+
+	// UpdateBan until 传零值就是解封
+	UpdateBan(ctx context.Context, uid int64, until time.Time, reason string) error
+	Search(ctx context.Context, q domain.UserQuery, offset int, limit int) ([]domain.User, error)
+	FindUnnormalizedPhones(ctx context.Context, startId int64, limit int) ([]domain.User, error)
+	// SavePhoneConflict phone 已经是 owner 的了，uid 没办法迁移过去
+	SavePhoneConflict(ctx context.Context, uid int64, owner int64, phone string) error
 }
 
 type userRepository struct {
@@ -62,6 +93,197 @@ func (repo *userRepository) FindByPhone(ctx context.Context, phone string) (doma
 	return repo.toDomain(user), nil
 }
 
+func (repo *userRepository) UpdateStatus(ctx context.Context, uid int64, status domain.UserStatus) error {
+	err := repo.dao.UpdateStatus(ctx, uid, status.ToUint8())
+	if err != nil {
+		return err
+	}
+	return repo.cache.Del(ctx, uid)
+}
+
+func (repo *userRepository) UpdatePassword(ctx context.Context, uid int64, password string) error {
+	err := repo.dao.UpdatePassword(ctx, uid, password)
+	if err != nil {
+		return err
+	}
+	return repo.cache.Del(ctx, uid)
+}
+
+func (repo *userRepository) UpdateStatusAndPassword(ctx context.Context, uid int64, status domain.UserStatus, password string) error {
+	err := repo.dao.UpdateStatusAndPassword(ctx, uid, status.ToUint8(), password)
+	if err != nil {
+		return err
+	}
+	return repo.cache.Del(ctx, uid)
+}
+
+func (repo *userRepository) UpdateNonZeroFields(ctx context.Context, user domain.User) error {
+	// 不能直接用 toEntity，零值的 Ctime 转过去不是 0
+	err := repo.dao.UpdateNonZeroFields(ctx, dao.User{
+		Id:       user.Id,
+		Nickname: user.Nickname,
+		Birthday: repo.toMilli(user.Birthday),
+		AboutMe:  user.AboutMe,
+		Avatar:   user.Avatar,
+	})
+	if err != nil {
+		return err
+	}
+	// 删除缓存，下一次查询的时候会重新加载，文章详情里面的作者名字也就是新的了
+	return repo.cache.Del(ctx, user.Id)
+}
+
+func (repo *userRepository) BindPhone(ctx context.Context, uid int64, phone string) error {
+	return repo.updateIdentity(ctx, uid, map[string]any{
+		"phone": phone,
+	})
+}
+
+func (repo *userRepository) BindEmail(ctx context.Context, uid int64, email string, password string) error {
+	return repo.updateIdentity(ctx, uid, map[string]any{
+		"email":    email,
+		"password": password,
+	})
+}
+
+func (repo *userRepository) BindWechat(ctx context.Context, uid int64, info domain.WechatInfo) error {
+	return repo.updateIdentity(ctx, uid, map[string]any{
+		"wechat_open_id": info.OpenID,
+		"wechat_union_id": sql.NullString{
+			String: info.UnionID,
+			Valid:  info.UnionID != "",
+		},
+	})
+}
+
+func (repo *userRepository) Unbind(ctx context.Context, uid int64, method domain.LoginMethod) error {
+	var fields map[string]any
+	switch method {
+	case domain.LoginMethodPhone:
+		fields = map[string]any{"phone": nil}
+	case domain.LoginMethodEmail:
+		// 密码是跟着邮箱走的
+		fields = map[string]any{"email": nil, "password": ""}
+	case domain.LoginMethodWechat:
+		fields = map[string]any{"wechat_open_id": nil, "wechat_union_id": nil}
+	default:
+		return fmt.Errorf("未知的登录方式 %s", method)
+	}
+	return repo.updateIdentity(ctx, uid, fields)
+}
+
+func (repo *userRepository) Merge(ctx context.Context, from, to int64) error {
+	err := repo.dao.Merge(ctx, from, to, domain.UserStatusMerged.ToUint8())
+	if err != nil {
+		return err
+	}
+	// 文章列表第一页的缓存会短暂不一致，等它过期就可以
+	err = repo.cache.Del(ctx, from)
+	if err != nil {
+		return err
+	}
+	return repo.cache.Del(ctx, to)
+}
+
+func (repo *userRepository) Deactivate(ctx context.Context, uid int64) error {
+	err := repo.dao.Deactivate(ctx, uid, domain.UserStatusDeactivated.ToUint8())
+	if err != nil {
+		return err
+	}
+	return repo.cache.Del(ctx, uid)
+}
+
+func (repo *userRepository) FindDeactivated(ctx context.Context, before time.Time, limit int) ([]domain.User, error) {
+	us, err := repo.dao.FindDeactivated(ctx, domain.UserStatusDeactivated.ToUint8(), before.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.User, 0, len(us))
+	for _, u := range us {
+		res = append(res, repo.toDomain(u))
+	}
+	return res, nil
+}
+
+func (repo *userRepository) Delete(ctx context.Context, uid int64, withdrawArticles bool) error {
+	var withdraw uint8
+	if withdrawArticles {
+		withdraw = domain.ArticleStatusPrivate.ToUint8()
+	}
+	err := repo.dao.Delete(ctx, uid, domain.UserStatusDeactivated.ToUint8(), dao.User{
+		Nickname: domain.DeletedUserNickname,
+		Status:   domain.UserStatusDeleted.ToUint8(),
+	}, withdraw)
+	if err != nil {
+		return err
+	}
+	// 文章的缓存等它自己过期
+	return repo.cache.Del(ctx, uid)
+}
+
+func (repo *userRepository) FindPurgeEventPending(ctx context.Context, limit int) ([]int64, error) {
+	return repo.dao.FindPurgeEventPending(ctx, limit)
+}
+
+func (repo *userRepository) ClearPurgeEventPending(ctx context.Context, uid int64) error {
+	return repo.dao.ClearPurgeEventPending(ctx, uid)
+}
+
+func (repo *userRepository) UpdateBan(ctx context.Context, uid int64, until time.Time, reason string) error {
+	err := repo.dao.UpdateBan(ctx, uid, repo.toMilli(until), reason)
+	if err != nil {
+		return err
+	}
+	return repo.cache.Del(ctx, uid)
+}
+
+func (repo *userRepository) Search(ctx context.Context, q domain.UserQuery, offset int, limit int) ([]domain.User, error) {
+	us, err := repo.dao.Search(ctx, dao.UserQuery{
+		Id:         q.Id,
+		Email:      q.Email,
+		Phone:      q.Phone,
+		Nickname:   q.Nickname,
+		CtimeStart: repo.toMilli(q.CtimeStart),
+		CtimeEnd:   repo.toMilli(q.CtimeEnd),
+	}, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.User, 0, len(us))
+	for _, u := range us {
+		res = append(res, repo.toDomain(u))
+	}
+	return res, nil
+}
+
+func (repo *userRepository) FindUnnormalizedPhones(ctx context.Context, startId int64, limit int) ([]domain.User, error) {
+	us, err := repo.dao.FindUnnormalizedPhones(ctx, startId, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.User, 0, len(us))
+	for _, u := range us {
+		res = append(res, repo.toDomain(u))
+	}
+	return res, nil
+}
+
+func (repo *userRepository) SavePhoneConflict(ctx context.Context, uid int64, owner int64, phone string) error {
+	return repo.dao.UpsertPhoneConflict(ctx, dao.UserPhoneConflict{
+		Uid:     uid,
+		Phone:   phone,
+		OwnerId: owner,
+	})
+}
+
+func (repo *userRepository) updateIdentity(ctx context.Context, uid int64, fields map[string]any) error {
+	err := repo.dao.UpdateIdentity(ctx, uid, fields)
+	if err != nil {
+		return err
+	}
+	return repo.cache.Del(ctx, uid)
+}
+
 func NewuserRepository(dao dao.UserDAO, cache cache.UserCache) UserRepository {
 	return &userRepository{dao: dao, cache: cache}
 }
@@ -93,6 +315,10 @@ func (repo *userRepository) toEntity(user domain.User) dao.User {
 			Valid:  user.WechatInfo.UnionID != "",
 		},
 		Nickname: user.Nickname,
+		Status:   user.Status.ToUint8(),
+		Birthday: repo.toMilli(user.Birthday),
+		AboutMe:  user.AboutMe,
+		Avatar:   user.Avatar,
 	}
 }
 
@@ -109,7 +335,29 @@ func (repo *userRepository) toDomain(user dao.User) domain.User {
 			UnionID: user.WechatUnionID.String,
 		},
 		Nickname: user.Nickname,
+		Status:   domain.UserStatus(user.Status),
+		Birthday: repo.fromMilli(user.Birthday),
+		AboutMe:  user.AboutMe,
+		Avatar:   user.Avatar,
+
+		DeactivateTime: repo.fromMilli(user.DeactivateTime),
+		BanUntil:       repo.fromMilli(user.BanUntil),
+		BanReason:      user.BanReason,
+	}
+}
+
+func (repo *userRepository) toMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func (repo *userRepository) fromMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
 	}
+	return time.UnixMilli(ms)
 }
 
 func (repo *userRepository) FindByWechat(ctx context.Context, openId string) (domain.User, error) {
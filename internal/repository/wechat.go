@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/repository/dao"
+	"time"
+)
+
+var ErrWechatTokenNotFound = dao.ErrWechatTokenNotFound
+
+type WechatTokenRepository interface {
+	Save(ctx context.Context, t domain.WechatToken) error
+	FindByOpenID(ctx context.Context, openID string) (domain.WechatToken, error)
+}
+
+type wechatTokenRepository struct {
+	dao dao.WechatTokenDAO
+}
+
+func NewwechatTokenRepository(dao dao.WechatTokenDAO) WechatTokenRepository {
+	return &wechatTokenRepository{dao: dao}
+}
+
+func (repo *wechatTokenRepository) Save(ctx context.Context, t domain.WechatToken) error {
+	return repo.dao.Upsert(ctx, dao.WechatToken{
+		OpenID:        t.OpenID,
+		UnionID:       t.UnionID,
+		AccessToken:   t.AccessToken,
+		RefreshToken:  t.RefreshToken,
+		Scope:         t.Scope,
+		AccessExpire:  t.AccessExpire.UnixMilli(),
+		RefreshExpire: t.RefreshExpire.UnixMilli(),
+	})
+}
+
+func (repo *wechatTokenRepository) FindByOpenID(ctx context.Context, openID string) (domain.WechatToken, error) {
+	t, err := repo.dao.FindByOpenID(ctx, openID)
+	if err != nil {
+		return domain.WechatToken{}, err
+	}
+	return domain.WechatToken{
+		OpenID:        t.OpenID,
+		UnionID:       t.UnionID,
+		AccessToken:   t.AccessToken,
+		RefreshToken:  t.RefreshToken,
+		Scope:         t.Scope,
+		AccessExpire:  time.UnixMilli(t.AccessExpire),
+		RefreshExpire: time.UnixMilli(t.RefreshExpire),
+	}, nil
+}
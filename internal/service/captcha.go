@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/repository"
+	"github.com/jym0818/webook/pkg/captcha"
+	"strings"
+	"time"
+)
+
+// captchaExpiration 图形验证码的有效期
+const captchaExpiration = time.Minute * 5
+
+type CaptchaService interface {
+	Generate(ctx context.Context) (domain.Captcha, error)
+	// Verify 每个验证码只能校验一次，答错了要重新获取
+	Verify(ctx context.Context, id, answer string) (bool, error)
+}
+
+type captchaService struct {
+	repo repository.CaptchaRepository
+}
+
+func NewcaptchaService(repo repository.CaptchaRepository) CaptchaService {
+	return &captchaService{repo: repo}
+}
+
+func (svc *captchaService) Generate(ctx context.Context) (domain.Captcha, error) {
+	question, answer := captcha.Arithmetic()
+	img, err := captcha.Render(question)
+	if err != nil {
+		return domain.Captcha{}, err
+	}
+	id := uuid.New().String()
+	err = svc.repo.Store(ctx, id, answer, captchaExpiration)
+	if err != nil {
+		return domain.Captcha{}, err
+	}
+	return domain.Captcha{Id: id, Image: img}, nil
+}
+
+func (svc *captchaService) Verify(ctx context.Context, id, answer string) (bool, error) {
+	if id == "" || answer == "" {
+		return false, nil
+	}
+	return svc.repo.Verify(ctx, id, strings.TrimSpace(answer))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/jym0818/webook/internal/repository"
+	"github.com/jym0818/webook/internal/service/email"
 	"github.com/jym0818/webook/internal/service/sms"
 	"math/rand"
 )
@@ -16,14 +17,22 @@ var (
 
 const tpl = "123456"
 
+const (
+	emailSubject = "webook 验证码"
+	emailTpl     = "您的验证码是 %s，10 分钟内有效，请勿泄露给他人。"
+)
+
 type CodeService interface {
 	Send(ctx context.Context, biz, phone string) error
+	// SendEmail 通过邮件发送验证码，校验的时候同样使用 Verify
+	SendEmail(ctx context.Context, biz, email string) error
 	Verify(ctx context.Context, biz string, phone string, code string) (bool, error)
 }
 
 type codeService struct {
-	repo   repository.CodeRepository
-	smsSvc sms.Service
+	repo     repository.CodeRepository
+	smsSvc   sms.Service
+	emailSvc email.Service
 }
 
 func (svc *codeService) Verify(ctx context.Context, biz string, phone string, code string) (bool, error) {
@@ -39,12 +48,18 @@ func (svc *codeService) Send(ctx context.Context, biz, phone string) error {
 		return err
 	}
 	//发送
-	err = svc.smsSvc.Send(ctx, tpl, []string{code}, phone)
+	// 限流或者服务商失败的时候，异步发送会存下来重试，这里返回的错误说明连重试都没有办法安排
+	return svc.smsSvc.Send(ctx, tpl, []string{code}, phone)
+}
 
+func (svc *codeService) SendEmail(ctx context.Context, biz, email string) error {
+	code := svc.generate()
+	// 和短信共用一套 lua 脚本，key 里面的 phone 换成了 email
+	err := svc.repo.Store(ctx, biz, email, code)
 	if err != nil {
-		//记录日志就可以了
+		return err
 	}
-	return nil
+	return svc.emailSvc.Send(ctx, emailSubject, fmt.Sprintf(emailTpl, code), email)
 }
 
 func (svc *codeService) generate() string {
@@ -52,9 +67,10 @@ func (svc *codeService) generate() string {
 	return fmt.Sprintf("%06d", code)
 }
 
-func NewcodeService(repo repository.CodeRepository, smsSvc sms.Service) CodeService {
+func NewcodeService(repo repository.CodeRepository, smsSvc sms.Service, emailSvc email.Service) CodeService {
 	return &codeService{
-		repo:   repo,
-		smsSvc: smsSvc,
+		repo:     repo,
+		smsSvc:   smsSvc,
+		emailSvc: emailSvc,
 	}
 }
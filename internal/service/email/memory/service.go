@@ -0,0 +1,18 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/jym0818/webook/internal/service/email"
+)
+
+type Service struct{}
+
+func (s *Service) Send(ctx context.Context, subject string, content string, to ...string) error {
+	fmt.Println(subject, content, to)
+	return nil
+}
+
+func NewService() email.Service {
+	return &Service{}
+}
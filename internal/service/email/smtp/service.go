@@ -0,0 +1,41 @@
+package smtp
+
+import (
+	"context"
+	"fmt"
+	"github.com/jym0818/webook/internal/service/email"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+type Service struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewService(host string, port int, username, password, from string) email.Service {
+	return &Service{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		from: from,
+		auth: smtp.PlainAuth("", username, password, host),
+	}
+}
+
+func (s *Service) Send(ctx context.Context, subject string, content string, to ...string) error {
+	// net/smtp 不支持 ctx，只能在发送前检查一下是否已经超时
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("From: %s\r\n", s.from))
+	sb.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(to, ",")))
+	sb.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(content)
+	return smtp.SendMail(s.addr, s.auth, s.from, to, []byte(sb.String()))
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/events/user"
+	"github.com/jym0818/webook/internal/repository"
+	"go.uber.org/zap"
+	"time"
+)
+
+type LoginLogService interface {
+	// Record 异步记录，不影响登录本身。消息发不出去的时候直接写数据库
+	Record(ctx context.Context, l domain.LoginLog)
+	// List 用户自己查看登录历史
+	List(ctx context.Context, uid int64, offset int, limit int) ([]domain.LoginLog, error)
+	// Search 管理后台用的
+	Search(ctx context.Context, q domain.LoginLogQuery, offset int, limit int) ([]domain.LoginLog, error)
+}
+
+const (
+	// recordTimeout 发消息加上写数据库兜底的总时间
+	recordTimeout = time.Second * 3
+	// maxRecording 同时在后台记录的日志数量，超过了就在请求里面同步记录，
+	// kafka 卡住的时候不会无限开 goroutine
+	maxRecording = 1024
+)
+
+type loginLogService struct {
+	repo     repository.LoginLogRepository
+	producer user.Producer
+	limiter  chan struct{}
+}
+
+func NewloginLogService(repo repository.LoginLogRepository, producer user.Producer) LoginLogService {
+	return &loginLogService{repo: repo, producer: producer,
+		limiter: make(chan struct{}, maxRecording)}
+}
+
+func (svc *loginLogService) Record(ctx context.Context, l domain.LoginLog) {
+	if l.Ctime.IsZero() {
+		l.Ctime = time.Now()
+	}
+	select {
+	case svc.limiter <- struct{}{}:
+		go func() {
+			defer func() { <-svc.limiter }()
+			svc.record(l)
+		}()
+	default:
+		svc.record(l)
+	}
+}
+
+func (svc *loginLogService) record(l domain.LoginLog) {
+	// 请求结束之后 ctx 就取消了，不能用它
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+	err := svc.producer.ProduceLoginEvent(ctx, user.LoginEvent{
+		Uid:       l.Uid,
+		Action:    string(l.Action),
+		Method:    l.Method,
+		Account:   l.Account,
+		IP:        l.IP,
+		UserAgent: l.UserAgent,
+		Ssid:      l.Ssid,
+		Success:   l.Success,
+		Code:      l.Code,
+		Ctime:     l.Ctime.UnixMilli(),
+	})
+	if err == nil {
+		return
+	}
+	zap.L().Warn("发送登录日志失败，直接写数据库", zap.Error(err),
+		zap.Int64("uid", l.Uid), zap.String("action", string(l.Action)))
+	err = svc.repo.Create(ctx, l)
+	if err != nil {
+		zap.L().Error("记录登录日志失败", zap.Error(err),
+			zap.Int64("uid", l.Uid), zap.String("action", string(l.Action)))
+	}
+}
+
+func (svc *loginLogService) List(ctx context.Context, uid int64, offset int, limit int) ([]domain.LoginLog, error) {
+	return svc.repo.Search(ctx, domain.LoginLogQuery{Uid: uid}, offset, limit)
+}
+
+func (svc *loginLogService) Search(ctx context.Context, q domain.LoginLogQuery, offset int, limit int) ([]domain.LoginLog, error) {
+	return svc.repo.Search(ctx, q, offset, limit)
+}
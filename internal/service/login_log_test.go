@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/events/user"
+	"github.com/jym0818/webook/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type memLoginLogRepo struct {
+	repository.LoginLogRepository
+	logs []domain.LoginLog
+}
+
+func (r *memLoginLogRepo) Create(ctx context.Context, l domain.LoginLog) error {
+	r.logs = append(r.logs, l)
+	return nil
+}
+
+type loginProducer struct {
+	user.Producer
+	err    error
+	events []user.LoginEvent
+}
+
+func (p *loginProducer) ProduceLoginEvent(ctx context.Context, evt user.LoginEvent) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("没有超时时间")
+	}
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, evt)
+	return nil
+}
+
+func TestLoginLogService_record(t *testing.T) {
+	testCases := []struct {
+		name       string
+		produceErr error
+		wantEvents int
+		wantLogs   int
+	}{
+		{name: "发送成功", wantEvents: 1},
+		{name: "发送失败直接写数据库", produceErr: errors.New("kafka 挂了"), wantLogs: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &memLoginLogRepo{}
+			producer := &loginProducer{err: tc.produceErr}
+			svc := NewloginLogService(repo, producer).(*loginLogService)
+			svc.record(domain.LoginLog{Uid: 1, Action: domain.LoginActionLogin, Code: 200, Success: true})
+			assert.Len(t, producer.events, tc.wantEvents)
+			assert.Len(t, repo.logs, tc.wantLogs)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/jym0818/webook/internal/repository"
+	"github.com/jym0818/webook/internal/service/email"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMagicLinkSendTooMany = repository.ErrMagicLinkSendTooMany
+	ErrInvalidMagicLink     = errors.New("登录链接无效或者已经过期")
+)
+
+// MagicLinkExpiration 登录链接的有效期
+const MagicLinkExpiration = time.Minute * 15
+
+const (
+	magicLinkSubject = "登录 webook"
+	magicLinkTpl     = "点击下面的链接登录 webook，15 分钟内有效，只能使用一次。如果不是您本人操作，请忽略这封邮件。\n\n%s"
+)
+
+// MagicLinkService 邮件登录链接。链接里面的 token 格式是 id.签名，
+// 签名不对的直接拒绝，不用查 Redis
+type MagicLinkService interface {
+	// Send 不管邮箱有没有注册都会发，不然可以用来探测邮箱有没有注册
+	Send(ctx context.Context, email string) error
+	// Verify 返回链接对应的邮箱，每个链接只能用一次
+	Verify(ctx context.Context, token string) (string, error)
+}
+
+type magicLinkService struct {
+	repo     repository.MagicLinkRepository
+	emailSvc email.Service
+	key      []byte
+	// baseURL 前端的登录页面，token 拼在 query 里面
+	baseURL string
+}
+
+func NewmagicLinkService(repo repository.MagicLinkRepository, emailSvc email.Service,
+	key []byte, baseURL string) MagicLinkService {
+	return &magicLinkService{
+		repo:     repo,
+		emailSvc: emailSvc,
+		key:      key,
+		baseURL:  baseURL,
+	}
+}
+
+func (svc *magicLinkService) Send(ctx context.Context, email string) error {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	id := base64.RawURLEncoding.EncodeToString(buf)
+	link, err := svc.link(id + "." + svc.sign(id))
+	if err != nil {
+		return err
+	}
+	err = svc.repo.Store(ctx, id, email, MagicLinkExpiration)
+	if err != nil {
+		return err
+	}
+	return svc.emailSvc.Send(ctx, magicLinkSubject, fmt.Sprintf(magicLinkTpl, link), email)
+}
+
+func (svc *magicLinkService) Verify(ctx context.Context, token string) (string, error) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(svc.sign(id))) {
+		return "", ErrInvalidMagicLink
+	}
+	email, err := svc.repo.Consume(ctx, id)
+	if err == repository.ErrMagicLinkNotFound {
+		return "", ErrInvalidMagicLink
+	}
+	return email, err
+}
+
+func (svc *magicLinkService) sign(id string) string {
+	mac := hmac.New(sha256.New, svc.key)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (svc *magicLinkService) link(token string) (string, error) {
+	u, err := url.Parse(svc.baseURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"github.com/jym0818/webook/internal/repository"
+	"github.com/jym0818/webook/pkg/totp"
+	"strings"
+	"time"
+)
+
+const (
+	totpIssuer        = "webook"
+	recoveryCodeCount = 10
+)
+
+var ErrMFAAlreadyEnabled = errors.New("已经开启了两步验证")
+var ErrMFANotEnrolled = errors.New("还没有开始绑定两步验证")
+var ErrInvalidMFACode = errors.New("两步验证码错误")
+
+type MFAService interface {
+	// EnrollTOTP 生成新的密钥，返回密钥和 otpauth 链接，要调用 ConfirmTOTP 之后才会生效
+	EnrollTOTP(ctx context.Context, uid int64, account string) (secret string, uri string, err error)
+	// ConfirmTOTP 用户输入一次验证码，确认手机上已经绑定好了。返回恢复码明文，只会给用户看这一次
+	ConfirmTOTP(ctx context.Context, uid int64, code string) ([]string, error)
+	Enabled(ctx context.Context, uid int64) (bool, error)
+	// Verify 校验动态口令或者恢复码，同一个动态口令和恢复码都只能用一次
+	Verify(ctx context.Context, uid int64, code string) error
+	// DisableTOTP 关闭之前要先校验一次验证码
+	DisableTOTP(ctx context.Context, uid int64, code string) error
+}
+
+type mfaService struct {
+	repo repository.MFARepository
+}
+
+func NewmfaService(repo repository.MFARepository) MFAService {
+	return &mfaService{repo: repo}
+}
+
+func (svc *mfaService) EnrollTOTP(ctx context.Context, uid int64, account string) (string, string, error) {
+	t, err := svc.repo.FindTOTP(ctx, uid)
+	if err == nil && t.Enabled {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+	if err != nil && err != repository.ErrMFANotFound {
+		return "", "", err
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	t.Uid = uid
+	t.Secret = secret
+	err = svc.repo.SaveTOTP(ctx, t)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, totp.URI(totpIssuer, account, secret), nil
+}
+
+func (svc *mfaService) ConfirmTOTP(ctx context.Context, uid int64, code string) ([]string, error) {
+	t, err := svc.repo.FindTOTP(ctx, uid)
+	if err == repository.ErrMFANotFound {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	counter, ok := totp.Validate(t.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		c, er := newRecoveryCode()
+		if er != nil {
+			return nil, er
+		}
+		codes = append(codes, c)
+		hashes = append(hashes, hashRecoveryCode(c))
+	}
+	err = svc.repo.EnableTOTP(ctx, uid, counter, hashes)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (svc *mfaService) Enabled(ctx context.Context, uid int64) (bool, error) {
+	t, err := svc.repo.FindTOTP(ctx, uid)
+	if err == repository.ErrMFANotFound {
+		return false, nil
+	}
+	return t.Enabled, err
+}
+
+func (svc *mfaService) Verify(ctx context.Context, uid int64, code string) error {
+	t, err := svc.repo.FindTOTP(ctx, uid)
+	if err == repository.ErrMFANotFound {
+		return ErrMFANotEnrolled
+	}
+	if err != nil {
+		return err
+	}
+	if !t.Enabled {
+		return ErrMFANotEnrolled
+	}
+	code = strings.TrimSpace(code)
+	if counter, ok := totp.Validate(t.Secret, code, time.Now()); ok {
+		// 只有比上一次用过的周期大才算数，防止验证码被截获之后重放
+		ok, err = svc.repo.UpdateLastCounter(ctx, uid, counter)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+	// 不是动态口令，那就试一下恢复码
+	ok, err := svc.repo.UseRecoveryCode(ctx, uid, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (svc *mfaService) DisableTOTP(ctx context.Context, uid int64, code string) error {
+	err := svc.Verify(ctx, uid, code)
+	if err != nil {
+		return err
+	}
+	return svc.repo.DeleteTOTP(ctx, uid)
+}
+
+// newRecoveryCode 80 位随机数，显示成 xxxx-xxxx-xxxx-xxxx 方便抄写
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, 10)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	s := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+	return s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16], nil
+}
+
+// hashRecoveryCode 用户输入的时候可能不带横线，统一去掉再算
+func hashRecoveryCode(code string) string {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
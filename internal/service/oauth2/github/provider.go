@@ -0,0 +1,112 @@
+package github
+
+import (
+	"context"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/service/oauth2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const name = "github"
+
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// 下面几个不配置就用 GitHub 的地址，测试的时候可以指向本地的假服务
+	AuthURL  string
+	TokenURL string
+	APIURL   string
+}
+
+type provider struct {
+	cfg    Config
+	client *http.Client
+}
+
+func NewProvider(cfg Config) oauth2.Provider {
+	if cfg.AuthURL == "" {
+		cfg.AuthURL = "https://github.com/login/oauth/authorize"
+	}
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = "https://github.com/login/oauth/access_token"
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://api.github.com"
+	}
+	return &provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Second * 5},
+	}
+}
+
+func (p *provider) Name() string {
+	return name
+}
+
+func (p *provider) AuthURL(ctx context.Context, state string) (string, error) {
+	v := url.Values{}
+	v.Set("client_id", p.cfg.ClientID)
+	v.Set("redirect_uri", p.cfg.RedirectURL)
+	v.Set("scope", "read:user user:email")
+	v.Set("state", state)
+	return p.cfg.AuthURL + "?" + v.Encode(), nil
+}
+
+func (p *provider) Exchange(ctx context.Context, code string) (oauth2.Token, error) {
+	v := url.Values{}
+	v.Set("client_id", p.cfg.ClientID)
+	v.Set("client_secret", p.cfg.ClientSecret)
+	v.Set("redirect_uri", p.cfg.RedirectURL)
+	v.Set("code", code)
+	return oauth2.ExchangeCode(ctx, p.client, p.cfg.TokenURL, v)
+}
+
+func (p *provider) UserInfo(ctx context.Context, token oauth2.Token) (domain.OAuth2Info, error) {
+	var u user
+	err := oauth2.GetJSON(ctx, p.client, p.cfg.APIURL+"/user", token, &u)
+	if err != nil {
+		return domain.OAuth2Info{}, err
+	}
+	info := domain.OAuth2Info{
+		Provider: name,
+		// login 是可以改的，只有 id 不会变
+		Subject:  strconv.FormatInt(u.Id, 10),
+		Nickname: u.Name,
+		Avatar:   u.AvatarURL,
+	}
+	if info.Nickname == "" {
+		info.Nickname = u.Login
+	}
+	// /user 里面的是公开邮箱，没有验证过，要去 /user/emails 找验证过的主邮箱
+	var emails []email
+	err = oauth2.GetJSON(ctx, p.client, p.cfg.APIURL+"/user/emails", token, &emails)
+	if err != nil {
+		// 没有给 user:email 权限，不影响登录
+		return info, nil
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			info.Email = e.Email
+			info.EmailVerified = true
+			break
+		}
+	}
+	return info, nil
+}
+
+type user struct {
+	Id        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type email struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
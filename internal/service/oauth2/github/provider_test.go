@@ -0,0 +1,147 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/service/oauth2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// newFakeGitHub 模拟 GitHub 的 token 接口和 API，emails 为 nil 的时候 /user/emails 返回 403
+func newFakeGitHub(t *testing.T, emails []email) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
+		assert.Equal(t, "client", r.PostForm.Get("client_id"))
+		assert.Equal(t, "secret", r.PostForm.Get("client_secret"))
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("code") != "good-code" {
+			// GitHub 换 token 失败的时候也是 200
+			_, _ = w.Write([]byte(`{"error":"bad_verification_code","error_description":"The code passed is incorrect or expired."}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"gho_token","token_type":"bearer","scope":"read:user,user:email"}`))
+	})
+	auth := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer gho_token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("/user", auth(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":         int64(583231),
+			"login":      "octocat",
+			"name":       "",
+			"avatar_url": "https://avatars.githubusercontent.com/u/583231",
+			// 公开邮箱没有验证过，不能用
+			"email": "public@example.com",
+		})
+	}))
+	mux.HandleFunc("/user/emails", auth(func(w http.ResponseWriter, r *http.Request) {
+		if emails == nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(emails)
+	}))
+	return httptest.NewServer(mux)
+}
+
+func newTestProvider(srv *httptest.Server) oauth2.Provider {
+	return NewProvider(Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/oauth2/github/callback",
+		AuthURL:      srv.URL + "/login/oauth/authorize",
+		TokenURL:     srv.URL + "/login/oauth/access_token",
+		APIURL:       srv.URL,
+	})
+}
+
+func TestProvider_AuthURL(t *testing.T) {
+	p := NewProvider(Config{ClientID: "client", RedirectURL: "http://localhost/cb"})
+	u, err := p.AuthURL(context.Background(), "state-123")
+	require.NoError(t, err)
+	parsed, err := url.Parse(u)
+	require.NoError(t, err)
+	assert.Equal(t, "github.com", parsed.Host)
+	assert.Equal(t, "client", parsed.Query().Get("client_id"))
+	assert.Equal(t, "state-123", parsed.Query().Get("state"))
+	assert.Equal(t, "read:user user:email", parsed.Query().Get("scope"))
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	srv := newFakeGitHub(t, nil)
+	defer srv.Close()
+	p := newTestProvider(srv)
+
+	token, err := p.Exchange(context.Background(), "good-code")
+	require.NoError(t, err)
+	assert.Equal(t, "gho_token", token.AccessToken)
+
+	_, err = p.Exchange(context.Background(), "bad-code")
+	assert.ErrorContains(t, err, "bad_verification_code")
+}
+
+func TestProvider_UserInfo(t *testing.T) {
+	testCases := []struct {
+		name   string
+		emails []email
+		want   domain.OAuth2Info
+	}{
+		{
+			name: "只用验证过的主邮箱",
+			emails: []email{
+				{Email: "other@example.com", Primary: false, Verified: true},
+				{Email: "octocat@example.com", Primary: true, Verified: true},
+			},
+			want: domain.OAuth2Info{Email: "octocat@example.com", EmailVerified: true},
+		},
+		{
+			name: "主邮箱没有验证",
+			emails: []email{
+				{Email: "octocat@example.com", Primary: true, Verified: false},
+				{Email: "other@example.com", Primary: false, Verified: true},
+			},
+		},
+		{
+			// 用户没有给 user:email 权限
+			name: "拿不到邮箱",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeGitHub(t, tc.emails)
+			defer srv.Close()
+			p := newTestProvider(srv)
+
+			info, err := p.UserInfo(context.Background(), oauth2.Token{AccessToken: "gho_token"})
+			require.NoError(t, err)
+			tc.want.Provider = "github"
+			tc.want.Subject = "583231"
+			// 没有 name 的时候用 login
+			tc.want.Nickname = "octocat"
+			tc.want.Avatar = "https://avatars.githubusercontent.com/u/583231"
+			assert.Equal(t, tc.want, info)
+		})
+	}
+}
+
+func TestProvider_UserInfo_Unauthorized(t *testing.T) {
+	srv := newFakeGitHub(t, nil)
+	defer srv.Close()
+	p := newTestProvider(srv)
+	_, err := p.UserInfo(context.Background(), oauth2.Token{AccessToken: "revoked"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,176 @@
+// Package oidc 通用的 OpenID Connect 登录，接口地址通过 discovery 拿到
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/service/oauth2"
+	"github.com/jym0818/webook/pkg/jwtx"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Name 路由和绑定关系里面用的名字，比如说 google
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes 不配置就是 openid email profile
+	Scopes []string
+}
+
+type provider struct {
+	cfg    Config
+	client *http.Client
+
+	// discovery 第一次用到的时候才去拉，不然对方挂了我们也启动不了
+	mu     sync.Mutex
+	meta   *metadata
+	keyset *jwtx.RemoteKeyset
+}
+
+func NewProvider(cfg Config) oauth2.Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Second * 5},
+	}
+}
+
+func (p *provider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *provider) AuthURL(ctx context.Context, state string) (string, error) {
+	meta, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.cfg.ClientID)
+	v.Set("redirect_uri", p.cfg.RedirectURL)
+	v.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	v.Set("state", state)
+	return meta.AuthorizationEndpoint + "?" + v.Encode(), nil
+}
+
+func (p *provider) Exchange(ctx context.Context, code string) (oauth2.Token, error) {
+	meta, _, err := p.discover(ctx)
+	if err != nil {
+		return oauth2.Token{}, err
+	}
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("client_id", p.cfg.ClientID)
+	v.Set("client_secret", p.cfg.ClientSecret)
+	v.Set("redirect_uri", p.cfg.RedirectURL)
+	v.Set("code", code)
+	return oauth2.ExchangeCode(ctx, p.client, meta.TokenEndpoint, v)
+}
+
+func (p *provider) UserInfo(ctx context.Context, token oauth2.Token) (domain.OAuth2Info, error) {
+	meta, keyset, err := p.discover(ctx)
+	if err != nil {
+		return domain.OAuth2Info{}, err
+	}
+	var c claims
+	if token.IDToken != "" {
+		// id_token 是直接从 token 接口拿到的，但还是要验签，防止中间人
+		_, err = jwt.ParseWithClaims(token.IDToken, &c, keyset.Keyfunc,
+			jwt.WithIssuer(p.cfg.Issuer),
+			jwt.WithAudience(p.cfg.ClientID),
+			jwt.WithExpirationRequired())
+		if err != nil {
+			return domain.OAuth2Info{}, fmt.Errorf("oidc: id_token 校验失败 %w", err)
+		}
+	} else {
+		if meta.UserinfoEndpoint == "" {
+			return domain.OAuth2Info{}, errors.New("oidc: 没有 id_token 也没有 userinfo 接口")
+		}
+		err = oauth2.GetJSON(ctx, p.client, meta.UserinfoEndpoint, token, &c)
+		if err != nil {
+			return domain.OAuth2Info{}, err
+		}
+	}
+	if c.Subject == "" {
+		return domain.OAuth2Info{}, errors.New("oidc: 没有返回 sub")
+	}
+	nickname := c.Name
+	if nickname == "" {
+		nickname = c.PreferredUsername
+	}
+	return domain.OAuth2Info{
+		Provider:      p.cfg.Name,
+		Subject:       c.Subject,
+		Email:         c.Email,
+		EmailVerified: c.EmailVerified,
+		Nickname:      nickname,
+		Avatar:        c.Picture,
+	}, nil
+}
+
+func (p *provider) discover(ctx context.Context) (*metadata, *jwtx.RemoteKeyset, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, p.keyset, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		p.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("oidc: discovery 失败 %d", resp.StatusCode)
+	}
+	var meta metadata
+	err = json.NewDecoder(resp.Body).Decode(&meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	// OpenID Connect Discovery 4.3，issuer 必须和配置的一致
+	if strings.TrimSuffix(meta.Issuer, "/") != p.cfg.Issuer {
+		return nil, nil, fmt.Errorf("oidc: issuer 不一致 %s", meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JwksURI == "" {
+		return nil, nil, errors.New("oidc: discovery 缺少必要的接口地址")
+	}
+	p.meta = &meta
+	p.keyset = jwtx.NewRemoteKeyset(meta.JwksURI)
+	return p.meta, p.keyset, nil
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+type claims struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Picture           string `json:"picture"`
+	jwt.RegisteredClaims
+}
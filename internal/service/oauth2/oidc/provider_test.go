@@ -0,0 +1,205 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/service/oauth2"
+	"github.com/jym0818/webook/pkg/jwtx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeIdP 本地的假授权服务器，issuer 为空的时候用自己的地址
+type fakeIdP struct {
+	*httptest.Server
+	keys *jwtx.Keyring
+	// issuer discovery 里面返回的 issuer
+	issuer string
+	// noUserinfo 为 true 的时候 discovery 里面没有 userinfo 接口
+	noUserinfo bool
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keys, err := jwtx.NewKeyring(jwtx.Key{Kid: "k1", Method: jwt.SigningMethodEdDSA, Private: priv})
+	require.NoError(t, err)
+	idp := &fakeIdP{keys: keys}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := idp.issuer
+		if issuer == "" {
+			issuer = idp.URL
+		}
+		meta := metadata{
+			Issuer:                issuer,
+			AuthorizationEndpoint: idp.URL + "/authorize",
+			TokenEndpoint:         idp.URL + "/token",
+			JwksURI:               idp.URL + "/jwks",
+		}
+		if !idp.noUserinfo {
+			meta.UserinfoEndpoint = idp.URL + "/userinfo"
+		}
+		_ = json.NewEncoder(w).Encode(meta)
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(idp.keys.JWKS())
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "authorization_code", r.PostForm.Get("grant_type"))
+		if r.PostForm.Get("code") != "good-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"at","token_type":"Bearer","expires_in":3600,"id_token":"` +
+			idp.idToken(t, idp.URL, "client", time.Hour) + `"}`))
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"sub":"u-2","email":"u2@example.com","email_verified":false,"preferred_username":"u2"}`))
+	})
+	idp.Server = httptest.NewServer(mux)
+	return idp
+}
+
+func (idp *fakeIdP) idToken(t *testing.T, issuer string, aud string, exp time.Duration) string {
+	token, err := idp.keys.Sign(claims{
+		Email:         "u1@example.com",
+		EmailVerified: true,
+		Name:          "User One",
+		Picture:       "https://example.com/u1.png",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   "u-1",
+			Audience:  jwt.ClaimStrings{aud},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(exp)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+	require.NoError(t, err)
+	return token
+}
+
+func (idp *fakeIdP) provider() oauth2.Provider {
+	return NewProvider(Config{
+		Name:         "fake",
+		Issuer:       idp.URL + "/",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/oauth2/fake/callback",
+	})
+}
+
+func TestProvider_AuthURL(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.Close()
+
+	u, err := idp.provider().AuthURL(context.Background(), "state-123")
+	require.NoError(t, err)
+	parsed, err := url.Parse(u)
+	require.NoError(t, err)
+	assert.Equal(t, idp.URL+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+	assert.Equal(t, "openid email profile", parsed.Query().Get("scope"))
+	assert.Equal(t, "state-123", parsed.Query().Get("state"))
+}
+
+func TestProvider_Discovery_IssuerMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.Close()
+	// 返回别人的 issuer，可能是配置错了，也可能是被劫持了
+	idp.issuer = "https://evil.example.com"
+
+	_, err := idp.provider().AuthURL(context.Background(), "state")
+	assert.ErrorContains(t, err, "issuer 不一致")
+}
+
+func TestProvider_ExchangeAndIDToken(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.Close()
+	p := idp.provider()
+
+	_, err := p.Exchange(context.Background(), "bad-code")
+	assert.ErrorContains(t, err, "invalid_grant")
+
+	token, err := p.Exchange(context.Background(), "good-code")
+	require.NoError(t, err)
+	info, err := p.UserInfo(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, domain.OAuth2Info{
+		Provider:      "fake",
+		Subject:       "u-1",
+		Email:         "u1@example.com",
+		EmailVerified: true,
+		Nickname:      "User One",
+		Avatar:        "https://example.com/u1.png",
+	}, info)
+}
+
+func TestProvider_IDTokenValidation(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.Close()
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	// kid 一样，但是私钥不是 IdP 的
+	forger, err := jwtx.NewKeyring(jwtx.Key{Kid: "k1", Method: jwt.SigningMethodEdDSA, Private: otherPriv})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		idToken func() string
+	}{
+		{name: "签名不对", idToken: func() string {
+			return (&fakeIdP{keys: forger}).idToken(t, idp.URL, "client", time.Hour)
+		}},
+		{name: "audience 不对", idToken: func() string {
+			return idp.idToken(t, idp.URL, "other-client", time.Hour)
+		}},
+		{name: "issuer 不对", idToken: func() string {
+			return idp.idToken(t, "https://evil.example.com", "client", time.Hour)
+		}},
+		{name: "过期了", idToken: func() string {
+			return idp.idToken(t, idp.URL, "client", -time.Minute)
+		}},
+	}
+	p := idp.provider()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := p.UserInfo(context.Background(), oauth2.Token{AccessToken: "at", IDToken: tc.idToken()})
+			assert.ErrorContains(t, err, "id_token 校验失败")
+		})
+	}
+}
+
+func TestProvider_UserinfoFallback(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.Close()
+
+	// 没有 id_token 的时候去 userinfo 接口拿
+	info, err := idp.provider().UserInfo(context.Background(), oauth2.Token{AccessToken: "at"})
+	require.NoError(t, err)
+	assert.Equal(t, domain.OAuth2Info{
+		Provider: "fake",
+		Subject:  "u-2",
+		Email:    "u2@example.com",
+		Nickname: "u2",
+	}, info)
+
+	idp.noUserinfo = true
+	_, err = idp.provider().UserInfo(context.Background(), oauth2.Token{AccessToken: "at"})
+	assert.ErrorContains(t, err, "没有 id_token 也没有 userinfo 接口")
+}
@@ -0,0 +1,79 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// tokenResponse RFC 6749 5.1 和 5.2 定义的返回值
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	IDToken      string `json:"id_token"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// ExchangeCode 按照标准的授权码模式去 endpoint 换 token，各个平台都可以用
+func ExchangeCode(ctx context.Context, client *http.Client, endpoint string, form url.Values) (Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// GitHub 默认返回的是表单格式，要明确要 JSON
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+	var res tokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return Token{}, fmt.Errorf("oauth2: 解析 token 失败 %d %w", resp.StatusCode, err)
+	}
+	if res.Error != "" {
+		return Token{}, fmt.Errorf("oauth2: 换 token 失败 %s %s", res.Error, res.ErrorDescription)
+	}
+	if res.AccessToken == "" {
+		return Token{}, fmt.Errorf("oauth2: 没有返回 access_token %d", resp.StatusCode)
+	}
+	t := Token{
+		AccessToken:  res.AccessToken,
+		RefreshToken: res.RefreshToken,
+		TokenType:    res.TokenType,
+		IDToken:      res.IDToken,
+	}
+	if res.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+	return t, nil
+}
+
+// GetJSON 带着 access token 调用资源接口
+func GetJSON(ctx context.Context, client *http.Client, endpoint string, token Token, val any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oauth2: 请求 %s 失败 %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(val)
+}
@@ -0,0 +1,48 @@
+// Package oauth2 第三方登录的抽象，微信之外的平台都实现 Provider
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"github.com/jym0818/webook/internal/domain"
+	"time"
+)
+
+var ErrProviderNotFound = errors.New("oauth2: 不支持的登录方式")
+
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	TokenType    string
+	Expiry       time.Time
+	// IDToken 只有 OIDC 才有
+	IDToken string
+}
+
+type Provider interface {
+	// Name 用在路由 /oauth2/:provider 里面，也是绑定关系里面的 provider
+	Name() string
+	// AuthURL 跳转到第三方平台授权的地址
+	AuthURL(ctx context.Context, state string) (string, error)
+	// Exchange 用回调里面的 code 换 token
+	Exchange(ctx context.Context, code string) (Token, error)
+	UserInfo(ctx context.Context, token Token) (domain.OAuth2Info, error)
+}
+
+type Providers map[string]Provider
+
+func NewProviders(ps ...Provider) Providers {
+	res := make(Providers, len(ps))
+	for _, p := range ps {
+		res[p.Name()] = p
+	}
+	return res
+}
+
+func (ps Providers) Get(name string) (Provider, error) {
+	p, ok := ps[name]
+	if !ok {
+		return nil, ErrProviderNotFound
+	}
+	return p, nil
+}
@@ -3,44 +3,97 @@ package wechat
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/repository"
 	"net/http"
 	"net/url"
+	"time"
 )
 
-var redirectURI = url.PathEscape("https://meoying.com/oauth2/wechat/callback")
+// ErrTokenExpired refresh_token 也过期了，只能让用户重新扫码授权
+var ErrTokenExpired = errors.New("微信授权已过期")
+
+const (
+	// refreshExpiration 微信文档规定 refresh_token 有效期是 30 天
+	refreshExpiration = time.Hour * 24 * 30
+	// expireAdvance 提前一点刷新，防止拿到手的时候刚好过期
+	expireAdvance = time.Minute * 5
+)
+
+// 微信接口的错误码
+const (
+	errCodeInvalidAccessToken = 40001
+	errCodeAccessTokenExpired = 42001
+	errCodeRefreshExpired     = 42002
+	errCodeInvalidRefresh     = 40030
+)
 
 type Service interface {
 	AuthURL(ctx context.Context, state string) (string, error)
-	VerifyCode(ctx context.Context, code string, state string) (domain.WechatInfo, error)
+	// VerifyCode 用 code 换 token，token 会保存下来，后面拉取用户资料要用
+	VerifyCode(ctx context.Context, code string) (domain.WechatInfo, error)
+	// Profile 拉取微信上的昵称和头像，access_token 过期了会自动刷新
+	Profile(ctx context.Context, openID string) (domain.WechatProfile, error)
+}
+
+type Config struct {
+	AppID       string
+	AppSecret   string
+	RedirectURI string
+	// 下面两个不配置就用微信的地址，测试的时候可以指向本地的假服务
+	OpenURL string
+	APIURL  string
 }
 
 type service struct {
-	appId     string
-	appSecret string
-	client    *http.Client
+	cfg    Config
+	repo   repository.WechatTokenRepository
+	client *http.Client
 }
 
-func (svc *service) VerifyCode(ctx context.Context, code string, state string) (domain.WechatInfo, error) {
-	const targetPattern = "https://api.weixin.qq.com/sns/oauth2/access_token?appid=%s&secret=%s&code=%s&grant_type=authorization_code"
-	target := fmt.Sprintf(targetPattern, svc.appId, redirectURI, code)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
-	if err != nil {
-		return domain.WechatInfo{}, err
+func Newservice(cfg Config, repo repository.WechatTokenRepository) Service {
+	if cfg.OpenURL == "" {
+		cfg.OpenURL = "https://open.weixin.qq.com"
 	}
-	resp, err := svc.client.Do(req)
-	if err != nil {
-		return domain.WechatInfo{}, err
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://api.weixin.qq.com"
 	}
-	decoder := json.NewDecoder(resp.Body)
+	return &service{
+		cfg:    cfg,
+		repo:   repo,
+		client: &http.Client{Timeout: time.Second * 5},
+	}
+}
+
+func (svc *service) AuthURL(ctx context.Context, state string) (string, error) {
+	v := url.Values{}
+	v.Set("appid", svc.cfg.AppID)
+	v.Set("redirect_uri", svc.cfg.RedirectURI)
+	v.Set("response_type", "code")
+	v.Set("scope", "snsapi_login")
+	v.Set("state", state)
+	return svc.cfg.OpenURL + "/connect/qrconnect?" + v.Encode() + "#wechat_redirect", nil
+}
+
+func (svc *service) VerifyCode(ctx context.Context, code string) (domain.WechatInfo, error) {
+	v := url.Values{}
+	v.Set("appid", svc.cfg.AppID)
+	v.Set("secret", svc.cfg.AppSecret)
+	v.Set("code", code)
+	v.Set("grant_type", "authorization_code")
 	var res Result
-	err = decoder.Decode(&res)
+	err := svc.get(ctx, "/sns/oauth2/access_token", v, &res)
 	if err != nil {
 		return domain.WechatInfo{}, err
 	}
 	if res.ErrCode != 0 {
-		return domain.WechatInfo{}, fmt.Errorf("微信返回错误信息:%s", res.ErrMsg)
+		return domain.WechatInfo{}, fmt.Errorf("微信返回错误信息:%d %s", res.ErrCode, res.ErrMsg)
+	}
+	err = svc.repo.Save(ctx, svc.toToken(res))
+	if err != nil {
+		return domain.WechatInfo{}, err
 	}
 	return domain.WechatInfo{
 		OpenID:  res.OpenId,
@@ -48,20 +101,112 @@ func (svc *service) VerifyCode(ctx context.Context, code string, state string) (
 	}, nil
 }
 
-func (svc *service) AuthURL(ctx context.Context, state string) (string, error) {
-	const urlPattern = "https://open.weixin.qq.com/connect/qrconnect?appid=%s&redirect_uri=%s&response_type=code&scope=snsapi_login&state=%s#wechat_redirect"
-	return fmt.Sprintf(urlPattern, svc.appId, redirectURI, state), nil
+func (svc *service) Profile(ctx context.Context, openID string) (domain.WechatProfile, error) {
+	t, err := svc.token(ctx, openID)
+	if err != nil {
+		return domain.WechatProfile{}, err
+	}
+	res, err := svc.userInfo(ctx, t)
+	if res.ErrCode == errCodeInvalidAccessToken || res.ErrCode == errCodeAccessTokenExpired {
+		// 本地记录的过期时间不准，强制刷新一次再试
+		t, err = svc.refresh(ctx, t)
+		if err != nil {
+			return domain.WechatProfile{}, err
+		}
+		res, err = svc.userInfo(ctx, t)
+	}
+	if err != nil {
+		return domain.WechatProfile{}, err
+	}
+	if res.ErrCode != 0 {
+		return domain.WechatProfile{}, fmt.Errorf("微信返回错误信息:%d %s", res.ErrCode, res.ErrMsg)
+	}
+	return domain.WechatProfile{
+		Nickname: res.Nickname,
+		Avatar:   res.HeadImgURL,
+	}, nil
+}
 
+func (svc *service) userInfo(ctx context.Context, t domain.WechatToken) (UserInfoResult, error) {
+	v := url.Values{}
+	v.Set("access_token", t.AccessToken)
+	v.Set("openid", t.OpenID)
+	var res UserInfoResult
+	err := svc.get(ctx, "/sns/userinfo", v, &res)
+	return res, err
 }
 
-func Newservice(appId string, appSecret string) Service {
-	return &service{
-		appId:     appId,
-		appSecret: appSecret,
-		client:    http.DefaultClient,
+// token 拿到可以用的 access_token，快过期了就先刷新
+func (svc *service) token(ctx context.Context, openID string) (domain.WechatToken, error) {
+	t, err := svc.repo.FindByOpenID(ctx, openID)
+	if err == repository.ErrWechatTokenNotFound {
+		return domain.WechatToken{}, ErrTokenExpired
+	}
+	if err != nil {
+		return domain.WechatToken{}, err
+	}
+	if time.Now().Add(expireAdvance).Before(t.AccessExpire) {
+		return t, nil
+	}
+	return svc.refresh(ctx, t)
+}
+
+func (svc *service) refresh(ctx context.Context, t domain.WechatToken) (domain.WechatToken, error) {
+	if time.Now().After(t.RefreshExpire) {
+		return domain.WechatToken{}, ErrTokenExpired
+	}
+	v := url.Values{}
+	v.Set("appid", svc.cfg.AppID)
+	v.Set("grant_type", "refresh_token")
+	v.Set("refresh_token", t.RefreshToken)
+	var res Result
+	err := svc.get(ctx, "/sns/oauth2/refresh_token", v, &res)
+	if err != nil {
+		return domain.WechatToken{}, err
+	}
+	if res.ErrCode == errCodeRefreshExpired || res.ErrCode == errCodeInvalidRefresh {
+		return domain.WechatToken{}, ErrTokenExpired
+	}
+	if res.ErrCode != 0 {
+		return domain.WechatToken{}, fmt.Errorf("微信返回错误信息:%d %s", res.ErrCode, res.ErrMsg)
+	}
+	nt := svc.toToken(res)
+	// 刷新接口不返回 unionid，refresh_token 的有效期也不会延长
+	nt.UnionID = t.UnionID
+	nt.RefreshExpire = t.RefreshExpire
+	err = svc.repo.Save(ctx, nt)
+	return nt, err
+}
+
+func (svc *service) toToken(res Result) domain.WechatToken {
+	now := time.Now()
+	return domain.WechatToken{
+		OpenID:        res.OpenId,
+		UnionID:       res.UnionId,
+		AccessToken:   res.AccessToken,
+		RefreshToken:  res.RefreshToken,
+		Scope:         res.Scope,
+		AccessExpire:  now.Add(time.Duration(res.ExpiresIn) * time.Second),
+		RefreshExpire: now.Add(refreshExpiration),
 	}
 }
 
+func (svc *service) get(ctx context.Context, path string, v url.Values, val any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, svc.cfg.APIURL+path+"?"+v.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := svc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("请求微信接口 %s 失败 %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(val)
+}
+
 // 根据腾讯文档的返回数据定义的结构体
 type Result struct {
 	ErrCode int64  `json:"errcode"`
@@ -70,7 +215,18 @@ type Result struct {
 	AccessToken  string `json:"access_token"`
 	ExpiresIn    int64  `json:"expires_in"`
 	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
 
 	UnionId string `json:"unionid"`
 	OpenId  string `json:"openid"`
 }
+
+type UserInfoResult struct {
+	ErrCode int64  `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+
+	OpenId     string `json:"openid"`
+	UnionId    string `json:"unionid"`
+	Nickname   string `json:"nickname"`
+	HeadImgURL string `json:"headimgurl"`
+}
@@ -0,0 +1,221 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type memTokenRepo struct {
+	tokens map[string]domain.WechatToken
+}
+
+func (r *memTokenRepo) Save(ctx context.Context, t domain.WechatToken) error {
+	r.tokens[t.OpenID] = t
+	return nil
+}
+
+func (r *memTokenRepo) FindByOpenID(ctx context.Context, openID string) (domain.WechatToken, error) {
+	t, ok := r.tokens[openID]
+	if !ok {
+		return domain.WechatToken{}, repository.ErrWechatTokenNotFound
+	}
+	return t, nil
+}
+
+// fakeWechat 模拟微信开放平台，微信的接口出错的时候 HTTP 状态码也是 200，错误在 errcode 里面
+type fakeWechat struct {
+	*httptest.Server
+	// validAccess 现在有效的 access_token
+	validAccess string
+	// refreshErr 刷新接口返回的错误码
+	refreshErr int64
+	refreshCnt int
+}
+
+func newFakeWechat(t *testing.T) *fakeWechat {
+	f := &fakeWechat{validAccess: "at-1"}
+	write := func(w http.ResponseWriter, val any) {
+		require.NoError(t, json.NewEncoder(w).Encode(val))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sns/oauth2/access_token", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "appid", q.Get("appid"))
+		assert.Equal(t, "secret", q.Get("secret"))
+		assert.Equal(t, "authorization_code", q.Get("grant_type"))
+		if q.Get("code") != "good-code" {
+			write(w, map[string]any{"errcode": 40029, "errmsg": "invalid code"})
+			return
+		}
+		write(w, map[string]any{
+			"access_token":  "at-1",
+			"expires_in":    7200,
+			"refresh_token": "rt-1",
+			"openid":        "openid-1",
+			"unionid":       "unionid-1",
+			"scope":         "snsapi_login",
+		})
+	})
+	mux.HandleFunc("/sns/oauth2/refresh_token", func(w http.ResponseWriter, r *http.Request) {
+		f.refreshCnt++
+		if f.refreshErr != 0 {
+			write(w, map[string]any{"errcode": f.refreshErr, "errmsg": "refresh_token expired"})
+			return
+		}
+		assert.Equal(t, "rt-1", r.URL.Query().Get("refresh_token"))
+		f.validAccess = "at-2"
+		// 刷新接口不返回 unionid
+		write(w, map[string]any{
+			"access_token":  "at-2",
+			"expires_in":    7200,
+			"refresh_token": "rt-1",
+			"openid":        "openid-1",
+			"scope":         "snsapi_login",
+		})
+	})
+	mux.HandleFunc("/sns/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_token") != f.validAccess {
+			write(w, map[string]any{"errcode": 42001, "errmsg": "access_token expired"})
+			return
+		}
+		write(w, map[string]any{
+			"openid":     "openid-1",
+			"unionid":    "unionid-1",
+			"nickname":   "微信用户",
+			"headimgurl": "https://thirdwx.qlogo.cn/1.png",
+		})
+	})
+	f.Server = httptest.NewServer(mux)
+	return f
+}
+
+func newTestService(f *fakeWechat, repo *memTokenRepo) Service {
+	return Newservice(Config{
+		AppID:       "appid",
+		AppSecret:   "secret",
+		RedirectURI: "http://localhost/oauth2/wechat/callback",
+		OpenURL:     f.URL,
+		APIURL:      f.URL,
+	}, repo)
+}
+
+func TestService_AuthURL(t *testing.T) {
+	svc := Newservice(Config{AppID: "appid", RedirectURI: "http://localhost/cb"}, nil)
+	u, err := svc.AuthURL(context.Background(), "state-123")
+	require.NoError(t, err)
+	parsed, err := url.Parse(u)
+	require.NoError(t, err)
+	assert.Equal(t, "open.weixin.qq.com", parsed.Host)
+	assert.Equal(t, "snsapi_login", parsed.Query().Get("scope"))
+	assert.Equal(t, "state-123", parsed.Query().Get("state"))
+	assert.Equal(t, "wechat_redirect", parsed.Fragment)
+}
+
+func TestService_VerifyCode(t *testing.T) {
+	f := newFakeWechat(t)
+	defer f.Close()
+	repo := &memTokenRepo{tokens: map[string]domain.WechatToken{}}
+	svc := newTestService(f, repo)
+
+	_, err := svc.VerifyCode(context.Background(), "bad-code")
+	assert.ErrorContains(t, err, "40029")
+	assert.Empty(t, repo.tokens)
+
+	info, err := svc.VerifyCode(context.Background(), "good-code")
+	require.NoError(t, err)
+	assert.Equal(t, domain.WechatInfo{OpenID: "openid-1", UnionID: "unionid-1"}, info)
+	token := repo.tokens["openid-1"]
+	assert.Equal(t, "at-1", token.AccessToken)
+	assert.Equal(t, "rt-1", token.RefreshToken)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), token.AccessExpire, time.Minute)
+}
+
+func TestService_Profile(t *testing.T) {
+	want := domain.WechatProfile{Nickname: "微信用户", Avatar: "https://thirdwx.qlogo.cn/1.png"}
+	valid := domain.WechatToken{
+		OpenID:        "openid-1",
+		UnionID:       "unionid-1",
+		AccessToken:   "at-1",
+		RefreshToken:  "rt-1",
+		AccessExpire:  time.Now().Add(time.Hour),
+		RefreshExpire: time.Now().Add(24 * time.Hour),
+	}
+
+	t.Run("access_token 有效", func(t *testing.T) {
+		f := newFakeWechat(t)
+		defer f.Close()
+		repo := &memTokenRepo{tokens: map[string]domain.WechatToken{"openid-1": valid}}
+		p, err := newTestService(f, repo).Profile(context.Background(), "openid-1")
+		require.NoError(t, err)
+		assert.Equal(t, want, p)
+		assert.Equal(t, 0, f.refreshCnt)
+	})
+
+	t.Run("本地记录快过期了，先刷新", func(t *testing.T) {
+		f := newFakeWechat(t)
+		defer f.Close()
+		token := valid
+		token.AccessExpire = time.Now().Add(time.Minute)
+		repo := &memTokenRepo{tokens: map[string]domain.WechatToken{"openid-1": token}}
+		p, err := newTestService(f, repo).Profile(context.Background(), "openid-1")
+		require.NoError(t, err)
+		assert.Equal(t, want, p)
+		assert.Equal(t, 1, f.refreshCnt)
+		saved := repo.tokens["openid-1"]
+		assert.Equal(t, "at-2", saved.AccessToken)
+		// 刷新之后 unionid 和 refresh_token 的有效期保持不变
+		assert.Equal(t, "unionid-1", saved.UnionID)
+		assert.Equal(t, token.RefreshExpire, saved.RefreshExpire)
+	})
+
+	t.Run("本地记录没过期，微信说过期了", func(t *testing.T) {
+		f := newFakeWechat(t)
+		defer f.Close()
+		f.validAccess = "at-other"
+		repo := &memTokenRepo{tokens: map[string]domain.WechatToken{"openid-1": valid}}
+		p, err := newTestService(f, repo).Profile(context.Background(), "openid-1")
+		require.NoError(t, err)
+		assert.Equal(t, want, p)
+		assert.Equal(t, 1, f.refreshCnt)
+	})
+
+	t.Run("refresh_token 失效", func(t *testing.T) {
+		f := newFakeWechat(t)
+		defer f.Close()
+		f.refreshErr = errCodeRefreshExpired
+		token := valid
+		token.AccessExpire = time.Now().Add(-time.Minute)
+		repo := &memTokenRepo{tokens: map[string]domain.WechatToken{"openid-1": token}}
+		_, err := newTestService(f, repo).Profile(context.Background(), "openid-1")
+		assert.Equal(t, ErrTokenExpired, err)
+	})
+
+	t.Run("refresh_token 本地记录过期", func(t *testing.T) {
+		f := newFakeWechat(t)
+		defer f.Close()
+		token := valid
+		token.AccessExpire = time.Now().Add(-time.Minute)
+		token.RefreshExpire = time.Now().Add(-time.Minute)
+		repo := &memTokenRepo{tokens: map[string]domain.WechatToken{"openid-1": token}}
+		_, err := newTestService(f, repo).Profile(context.Background(), "openid-1")
+		assert.Equal(t, ErrTokenExpired, err)
+		assert.Equal(t, 0, f.refreshCnt)
+	})
+
+	t.Run("没有保存过 token", func(t *testing.T) {
+		f := newFakeWechat(t)
+		defer f.Close()
+		repo := &memTokenRepo{tokens: map[string]domain.WechatToken{}}
+		_, err := newTestService(f, repo).Profile(context.Background(), "openid-1")
+		assert.Equal(t, ErrTokenExpired, err)
+	})
+}
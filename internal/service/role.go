@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/repository"
+)
+
+var ErrUnknownRole = errors.New("未定义的角色")
+
+type RoleService interface {
+	Roles(ctx context.Context, uid int64) ([]domain.Role, error)
+	Grant(ctx context.Context, uid int64, role domain.Role) error
+	Revoke(ctx context.Context, uid int64, role domain.Role) error
+}
+
+type roleService struct {
+	repo repository.RoleRepository
+}
+
+func NewroleService(repo repository.RoleRepository) RoleService {
+	return &roleService{repo: repo}
+}
+
+func (svc *roleService) Roles(ctx context.Context, uid int64) ([]domain.Role, error) {
+	rs, err := svc.repo.FindByUid(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	// 代码里面已经删掉的角色，数据库里面可能还有
+	res := rs[:0]
+	for _, r := range rs {
+		if r.Valid() {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+func (svc *roleService) Grant(ctx context.Context, uid int64, role domain.Role) error {
+	if !role.Valid() {
+		return ErrUnknownRole
+	}
+	return svc.repo.Grant(ctx, uid, role)
+}
+
+func (svc *roleService) Revoke(ctx context.Context, uid int64, role domain.Role) error {
+	return svc.repo.Revoke(ctx, uid, role)
+}
@@ -0,0 +1,207 @@
+package aliyun
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/jym0818/webook/internal/service/sms"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultEndpoint 阿里云短信的公网地址
+const DefaultEndpoint = "https://dysmsapi.aliyuncs.com/"
+
+// 阿里云常见的错误码，完整的见阿里云短信的文档
+const (
+	CodeOK = "OK"
+	// CodeBusinessLimit 同一个号码触发了阿里云的流控
+	CodeBusinessLimit     = "isv.BUSINESS_LIMIT_CONTROL"
+	CodeDayLimit          = "isv.DAY_LIMIT_CONTROL"
+	CodeThrottling        = "Throttling"
+	CodeSystemError       = "isp.SYSTEM_ERROR"
+	CodeMobileIllegal     = "isv.MOBILE_NUMBER_ILLEGAL"
+	CodeTemplateIllegal   = "isv.SMS_TEMPLATE_ILLEGAL"
+	CodeSignatureIllegal  = "isv.SMS_SIGNATURE_ILLEGAL"
+	CodeMissingParameters = "isv.TEMPLATE_MISSING_PARAMETERS"
+	CodeInvalidJSONParam  = "isv.INVALID_JSON_PARAM"
+)
+
+// codeErrs 阿里云的错误码转成 sms 包里面的错误，没有列出来的不做转换
+var codeErrs = map[string]error{
+	CodeBusinessLimit:     sms.ErrProviderLimited,
+	CodeDayLimit:          sms.ErrProviderLimited,
+	CodeThrottling:        sms.ErrProviderLimited,
+	CodeSystemError:       sms.ErrProviderUnavailable,
+	CodeMobileIllegal:     sms.ErrInvalidNumber,
+	CodeTemplateIllegal:   sms.ErrInvalidTemplate,
+	CodeSignatureIllegal:  sms.ErrInvalidTemplate,
+	CodeMissingParameters: sms.ErrInvalidTemplate,
+	CodeInvalidJSONParam:  sms.ErrInvalidTemplate,
+}
+
+// Template 阿里云的模板参数是 JSON，要知道每个位置上的参数叫什么
+type Template struct {
+	// Code 阿里云的模板 CODE，比如 SMS_123456789
+	Code string
+	// Params 按 args 的顺序排列的参数名，比如 ["code"]
+	Params []string
+}
+
+// Error 阿里云返回的 Code 不是 OK，可以用 errors.Is 判断是 sms 包里面的哪一种错误
+type Error struct {
+	Code      string
+	Message   string
+	RequestId string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("阿里云发送短信失败 %s, %s, request id %s", e.Code, e.Message, e.RequestId)
+}
+
+func (e *Error) Unwrap() error {
+	return codeErrs[e.Code]
+}
+
+type Service struct {
+	client       *http.Client
+	endpoint     string
+	accessKeyId  string
+	accessSecret string
+	signName     string
+	// templates 默认模板 ID 到阿里云模板的映射
+	templates map[string]Template
+	now       func() time.Time
+}
+
+// NewService endpoint 为空的时候用 DefaultEndpoint
+func NewService(client *http.Client, endpoint string,
+	accessKeyId string, accessSecret string, signName string,
+	templates map[string]Template) sms.Service {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	return &Service{
+		client:       client,
+		endpoint:     endpoint,
+		accessKeyId:  accessKeyId,
+		accessSecret: accessSecret,
+		signName:     signName,
+		templates:    templates,
+		now:          time.Now,
+	}
+}
+
+func (s *Service) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
+	tpl, ok := s.templates[tplId]
+	if !ok {
+		return fmt.Errorf("%w: 阿里云没有配置模板 %s", sms.ErrInvalidTemplate, tplId)
+	}
+	if len(args) != len(tpl.Params) {
+		return fmt.Errorf("%w: 阿里云模板 %s 需要 %d 个参数，实际 %d 个", sms.ErrInvalidTemplate,
+			tpl.Code, len(tpl.Params), len(args))
+	}
+	params := make(map[string]string, len(args))
+	for i, name := range tpl.Params {
+		params[name] = args[i]
+	}
+	tplParam, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	nonce, err := s.nonce()
+	if err != nil {
+		return err
+	}
+	query := url.Values{
+		"Action":           {"SendSms"},
+		"Version":          {"2017-05-25"},
+		"Format":           {"JSON"},
+		"RegionId":         {"cn-hangzhou"},
+		"AccessKeyId":      {s.accessKeyId},
+		"SignatureMethod":  {"HMAC-SHA1"},
+		"SignatureVersion": {"1.0"},
+		"SignatureNonce":   {nonce},
+		"Timestamp":        {s.now().UTC().Format("2006-01-02T15:04:05Z")},
+		"PhoneNumbers":     {strings.Join(numbers, ",")},
+		"SignName":         {s.signName},
+		"TemplateCode":     {tpl.Code},
+		"TemplateParam":    {string(tplParam)},
+	}
+	query.Set("Signature", s.sign(http.MethodPost, query))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, strings.NewReader(query.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w: %w", sms.ErrProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	// 签名错误这些，阿里云的 HTTP 状态码不是 200，但是 body 的格式是一样的
+	var res struct {
+		Code      string
+		Message   string
+		RequestId string
+	}
+	if err = json.Unmarshal(body, &res); err != nil || res.Code == "" {
+		// 一般是网关出错了，比如 502
+		return fmt.Errorf("%w: 阿里云短信响应无法解析 HTTP %d: %.200s", sms.ErrProviderUnavailable, resp.StatusCode, body)
+	}
+	if res.Code != CodeOK {
+		return &Error{Code: res.Code, Message: res.Message, RequestId: res.RequestId}
+	}
+	return nil
+}
+
+// sign 阿里云 RPC 风格的签名
+// StringToSign = Method & %2F & percentEncode(排好序的 query)，密钥是 AccessKeySecret 加上 &
+func (s *Service) sign(method string, query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, percentEncode(k)+"="+percentEncode(query.Get(k)))
+	}
+	str := method + "&" + percentEncode("/") + "&" + percentEncode(strings.Join(pairs, "&"))
+	mac := hmac.New(sha1.New, []byte(s.accessSecret+"&"))
+	mac.Write([]byte(str))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Service) nonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// percentEncode 阿里云要求的 RFC 3986 编码，空格是 %20，* 要编码，~ 不编码
+func percentEncode(s string) string {
+	res := url.QueryEscape(s)
+	res = strings.ReplaceAll(res, "+", "%20")
+	res = strings.ReplaceAll(res, "*", "%2A")
+	return strings.ReplaceAll(res, "%7E", "~")
+}
@@ -0,0 +1,126 @@
+package aliyun
+
+import (
+	"context"
+	"errors"
+	"github.com/jym0818/webook/internal/service/sms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const testSecret = "testSecret"
+
+// 阿里云文档里面的签名例子
+func TestService_sign(t *testing.T) {
+	s := &Service{accessSecret: testSecret}
+	query := url.Values{
+		"AccessKeyId":      {"testId"},
+		"Action":           {"SendSms"},
+		"Format":           {"XML"},
+		"OutId":            {"123"},
+		"PhoneNumbers":     {"15300000001"},
+		"RegionId":         {"cn-hangzhou"},
+		"SignName":         {"阿里云短信测试专用"},
+		"SignatureMethod":  {"HMAC-SHA1"},
+		"SignatureNonce":   {"45e25e9b-0a6f-4070-8c85-2956eda1b466"},
+		"SignatureVersion": {"1.0"},
+		"TemplateCode":     {"SMS_71390007"},
+		"TemplateParam":    {`{"customer":"test"}`},
+		"Timestamp":        {"2017-07-12T02:42:19Z"},
+		"Version":          {"2017-05-25"},
+	}
+	assert.Equal(t, "zJDF+Lrzhj/ThnlvIToysFRq6t4=", s.sign(http.MethodGet, query))
+}
+
+// newStub 模拟阿里云：先校验签名，然后按手机号返回不同的结果
+func newStub(t *testing.T, responses map[string]stubResp) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		form := r.PostForm
+		sig := form.Get("Signature")
+		form.Del("Signature")
+		if (&Service{accessSecret: testSecret}).sign(http.MethodPost, form) != sig {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"Code":"SignatureDoesNotMatch","Message":"Specified signature is not matched","RequestId":"r0"}`))
+			return
+		}
+		assert.Equal(t, "SendSms", form.Get("Action"))
+		assert.Equal(t, "webook", form.Get("SignName"))
+		assert.Equal(t, "SMS_1", form.Get("TemplateCode"))
+		assert.JSONEq(t, `{"code":"123456"}`, form.Get("TemplateParam"))
+		resp, ok := responses[form.Get("PhoneNumbers")]
+		require.True(t, ok, form.Get("PhoneNumbers"))
+		w.WriteHeader(resp.status)
+		_, _ = w.Write([]byte(resp.body))
+	}))
+}
+
+type stubResp struct {
+	status int
+	body   string
+}
+
+func TestService_Send(t *testing.T) {
+	srv := newStub(t, map[string]stubResp{
+		"+8613800000000": {http.StatusOK, `{"Code":"OK","Message":"OK","RequestId":"r1","BizId":"b1"}`},
+		"+8613800000001": {http.StatusOK, `{"Code":"isv.BUSINESS_LIMIT_CONTROL","Message":"触发号码天级流控","RequestId":"r2"}`},
+		"+8613800000002": {http.StatusOK, `{"Code":"isp.SYSTEM_ERROR","Message":"系统错误","RequestId":"r3"}`},
+		"+8613800000003": {http.StatusOK, `{"Code":"isv.MOBILE_NUMBER_ILLEGAL","Message":"非法手机号","RequestId":"r4"}`},
+		"+8613800000004": {http.StatusOK, `{"Code":"isv.SMS_TEMPLATE_ILLEGAL","Message":"模板不合法","RequestId":"r5"}`},
+		"+8613800000005": {http.StatusOK, `{"Code":"isv.OUT_OF_SERVICE","Message":"业务停机","RequestId":"r6"}`},
+		"+8613800000006": {http.StatusBadGateway, `<html>502 Bad Gateway</html>`},
+	})
+	defer srv.Close()
+	tpls := map[string]Template{"123": {Code: "SMS_1", Params: []string{"code"}}}
+
+	testCases := []struct {
+		name    string
+		secret  string
+		tpl     string
+		number  string
+		wantErr error
+		// wantCode 不为空的时候，错误一定是 *Error
+		wantCode string
+	}{
+		{name: "发送成功", tpl: "123", number: "+8613800000000"},
+		{name: "流控", tpl: "123", number: "+8613800000001",
+			wantErr: sms.ErrProviderLimited, wantCode: CodeBusinessLimit},
+		{name: "系统错误", tpl: "123", number: "+8613800000002",
+			wantErr: sms.ErrProviderUnavailable, wantCode: CodeSystemError},
+		{name: "手机号不对", tpl: "123", number: "+8613800000003",
+			wantErr: sms.ErrInvalidNumber, wantCode: CodeMobileIllegal},
+		{name: "模板不对", tpl: "123", number: "+8613800000004",
+			wantErr: sms.ErrInvalidTemplate, wantCode: CodeTemplateIllegal},
+		{name: "没有转换的错误码", tpl: "123", number: "+8613800000005", wantCode: "isv.OUT_OF_SERVICE"},
+		{name: "网关错误", tpl: "123", number: "+8613800000006", wantErr: sms.ErrProviderUnavailable},
+		{name: "签名不对", secret: "wrong", tpl: "123", number: "+8613800000000", wantCode: "SignatureDoesNotMatch"},
+		{name: "没有配置模板", tpl: "456", number: "+8613800000000", wantErr: sms.ErrInvalidTemplate},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			secret := testSecret
+			if tc.secret != "" {
+				secret = tc.secret
+			}
+			svc := NewService(srv.Client(), srv.URL, "testId", secret, "webook", tpls)
+			err := svc.Send(context.Background(), tc.tpl, []string{"123456"}, tc.number)
+			if tc.wantErr == nil && tc.wantCode == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			}
+			if tc.wantCode != "" {
+				var ae *Error
+				require.True(t, errors.As(err, &ae))
+				assert.Equal(t, tc.wantCode, ae.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/repository"
+	"github.com/jym0818/webook/internal/service/sms"
+	"github.com/jym0818/webook/internal/service/sms/failover"
+	"github.com/jym0818/webook/internal/service/sms/ratelimit"
+	"go.uber.org/zap"
+	"time"
+)
+
+// errExpired 还没发出去就已经过了有效期，比如验证码已经失效了
+var errExpired = errors.New("短信已经过了有效期")
+
+// Service 同步发送遇到临时的错误（限流或者所有服务商都失败了）的时候，把短信存到数据库里面，
+// 由 RetryWaiting 定时按指数退避重试。号码不对这种重试也没用的错误直接返回
+type Service struct {
+	svc  sms.Service
+	repo repository.AsyncSmsRepository
+	// maxAttempts 最多发送几次，包括第一次同步发送
+	maxAttempts int
+	// initInterval 第一次重试的间隔，之后每次翻倍，最多 maxInterval
+	initInterval time.Duration
+	maxInterval  time.Duration
+	// ttl 从第一次发送开始算，过了这么久就不再重试，要和验证码的有效期一致
+	ttl time.Duration
+	// lease 抢占之后多久没有结果可以被别的实例再次抢占，要比一次发送的超时时间长
+	lease time.Duration
+	now   func() time.Time
+}
+
+func NewService(svc sms.Service, repo repository.AsyncSmsRepository,
+	maxAttempts int, initInterval time.Duration, maxInterval time.Duration, ttl time.Duration) *Service {
+	return &Service{
+		svc:          svc,
+		repo:         repo,
+		maxAttempts:  maxAttempts,
+		initInterval: initInterval,
+		maxInterval:  maxInterval,
+		ttl:          ttl,
+		lease:        time.Minute,
+		now:          time.Now,
+	}
+}
+
+func (s *Service) Send(ctx context.Context, tpl string, args []string, numbers ...string) error {
+	err := s.svc.Send(ctx, tpl, args, numbers...)
+	if err == nil {
+		return nil
+	}
+	now := s.now()
+	next, ok := s.next(1, now, now.Add(s.ttl))
+	if !ok || !s.retryable(err) {
+		return err
+	}
+	// 请求已经结束了也要存下来，验证码已经写进 redis 了
+	er := s.repo.Add(context.WithoutCancel(ctx), domain.AsyncSms{
+		Tpl:         tpl,
+		Args:        args,
+		Numbers:     numbers,
+		Attempts:    1,
+		MaxAttempts: s.maxAttempts,
+		LastErr:     err.Error(),
+		NextTime:    next,
+		ExpireTime:  now.Add(s.ttl),
+	})
+	if er != nil {
+		zap.L().Error("保存异步短信失败", zap.Error(er), zap.NamedError("send_err", err))
+		// 存不下来就把发送的错误返回给上层
+		return err
+	}
+	return nil
+}
+
+// RetryWaiting 重试一批到时间了的短信，返回处理了多少条
+func (s *Service) RetryWaiting(ctx context.Context, limit int) (int, error) {
+	ss, err := s.repo.PreemptWaiting(ctx, s.lease, limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range ss {
+		err = s.retry(ctx, m)
+		if err != nil {
+			// 没有记下来的话，过了 lease 会再发一次
+			zap.L().Error("记录异步短信结果失败", zap.Error(err), zap.Int64("id", m.Id))
+		}
+	}
+	return len(ss), nil
+}
+
+func (s *Service) retry(ctx context.Context, m domain.AsyncSms) error {
+	if !s.now().Before(m.ExpireTime) {
+		return s.finalFailure(ctx, m, errExpired)
+	}
+	err := s.svc.Send(ctx, m.Tpl, m.Args, m.Numbers...)
+	if err == nil {
+		return s.repo.ReportSuccess(ctx, m.Id)
+	}
+	if !s.retryable(err) {
+		return s.finalFailure(ctx, m, err)
+	}
+	next, ok := s.next(m.Attempts+1, s.now(), m.ExpireTime)
+	if !ok {
+		return s.finalFailure(ctx, m, err)
+	}
+	return s.repo.ReportFailure(ctx, m.Id, err.Error(), next)
+}
+
+func (s *Service) finalFailure(ctx context.Context, m domain.AsyncSms, err error) error {
+	zap.L().Error("异步短信最终发送失败", zap.Int64("id", m.Id),
+		zap.Int("attempts", m.Attempts+1), zap.Error(err))
+	return s.repo.ReportFinalFailure(ctx, m.Id, err.Error())
+}
+
+// next 已经发了 attempts 次之后，下一次什么时候发。次数用完了，或者下一次已经过期了，返回 false
+func (s *Service) next(attempts int, now time.Time, expire time.Time) (time.Time, bool) {
+	if attempts >= s.maxAttempts {
+		return time.Time{}, false
+	}
+	d := s.initInterval
+	for i := 1; i < attempts && d < s.maxInterval; i++ {
+		d *= 2
+	}
+	next := now.Add(min(d, s.maxInterval))
+	return next, next.Before(expire)
+}
+
+// retryable 只有临时的错误才值得重试
+func (s *Service) retryable(err error) bool {
+	return errors.Is(err, ratelimit.ErrLimited) ||
+		errors.Is(err, failover.ErrAllFailed) ||
+		errors.Is(err, sms.ErrProviderLimited) ||
+		errors.Is(err, sms.ErrProviderUnavailable)
+}
@@ -0,0 +1,218 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/service/sms"
+	"github.com/jym0818/webook/internal/service/sms/failover"
+	"github.com/jym0818/webook/internal/service/sms/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// memRepo 模拟数据库，PreemptWaiting 按 now 取出到时间了的短信
+type memRepo struct {
+	rows []domain.AsyncSms
+	now  func() time.Time
+}
+
+func (r *memRepo) Add(ctx context.Context, s domain.AsyncSms) error {
+	s.Id = int64(len(r.rows) + 1)
+	s.Status = domain.AsyncSmsStatusWaiting
+	r.rows = append(r.rows, s)
+	return nil
+}
+
+func (r *memRepo) PreemptWaiting(ctx context.Context, lease time.Duration, limit int) ([]domain.AsyncSms, error) {
+	var res []domain.AsyncSms
+	for i, s := range r.rows {
+		if s.Status == domain.AsyncSmsStatusWaiting && !s.NextTime.After(r.now()) {
+			res = append(res, s)
+			r.rows[i].NextTime = r.now().Add(lease)
+		}
+	}
+	return res, nil
+}
+
+func (r *memRepo) ReportSuccess(ctx context.Context, id int64) error {
+	s := &r.rows[id-1]
+	s.Attempts++
+	s.Status = domain.AsyncSmsStatusSuccess
+	s.Args = nil
+	return nil
+}
+
+func (r *memRepo) ReportFinalFailure(ctx context.Context, id int64, lastErr string) error {
+	s := &r.rows[id-1]
+	s.Attempts++
+	s.Status = domain.AsyncSmsStatusFailed
+	s.Args = nil
+	s.LastErr = lastErr
+	return nil
+}
+
+func (r *memRepo) ReportFailure(ctx context.Context, id int64, lastErr string, nextTime time.Time) error {
+	s := &r.rows[id-1]
+	s.Attempts++
+	s.LastErr = lastErr
+	s.NextTime = nextTime
+	return nil
+}
+
+// scriptSms 按顺序返回 errs 里面的错误，用完了之后返回 nil
+type scriptSms struct {
+	errs []error
+	cnt  int
+}
+
+func (s *scriptSms) Send(ctx context.Context, tpl string, args []string, numbers ...string) error {
+	s.cnt++
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newTestService(errs ...error) (*Service, *memRepo, *scriptSms, *clock) {
+	c := &clock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	repo := &memRepo{now: c.now}
+	svc := &scriptSms{errs: errs}
+	s := NewService(svc, repo, 4, 10*time.Second, 40*time.Second, 10*time.Minute)
+	s.now = c.now
+	return s, repo, svc, c
+}
+
+func TestService_next(t *testing.T) {
+	s, _, _, c := newTestService()
+	expire := c.t.Add(time.Hour)
+	wants := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second}
+	for i, want := range wants {
+		next, ok := s.next(i+1, c.t, expire)
+		assert.True(t, ok)
+		assert.Equal(t, want, next.Sub(c.t), "attempts %d", i+1)
+	}
+	// 次数用完了
+	_, ok := s.next(4, c.t, expire)
+	assert.False(t, ok)
+	// 下一次已经过期了
+	_, ok = s.next(1, c.t, c.t.Add(5*time.Second))
+	assert.False(t, ok)
+
+	s.maxAttempts = 10
+	next, ok := s.next(6, c.t, expire)
+	assert.True(t, ok)
+	assert.Equal(t, 40*time.Second, next.Sub(c.t), "最多 maxInterval")
+}
+
+func TestService_Send(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       error
+		wantErr   error
+		wantSaved bool
+	}{
+		{name: "发送成功"},
+		{name: "本地限流", err: ratelimit.ErrLimited, wantSaved: true},
+		{name: "所有服务商都失败了", err: failover.ErrAllFailed, wantSaved: true},
+		{name: "服务商限流", err: errors.Join(errors.New("阿里云"), sms.ErrProviderLimited), wantSaved: true},
+		{name: "号码不对", err: sms.ErrInvalidNumber, wantErr: sms.ErrInvalidNumber},
+		{name: "模板不对", err: sms.ErrInvalidTemplate, wantErr: sms.ErrInvalidTemplate},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, repo, _, c := newTestService(tc.err)
+			err := s.Send(context.Background(), "tpl", []string{"123456"}, "+8613800000000")
+			assert.Equal(t, tc.wantErr, err)
+			if !tc.wantSaved {
+				assert.Empty(t, repo.rows)
+				return
+			}
+			require.Len(t, repo.rows, 1)
+			row := repo.rows[0]
+			assert.Equal(t, 1, row.Attempts)
+			assert.Equal(t, c.t.Add(10*time.Second), row.NextTime)
+			assert.Equal(t, c.t.Add(10*time.Minute), row.ExpireTime)
+		})
+	}
+}
+
+func TestService_RetryWaiting(t *testing.T) {
+	t.Run("重试成功之后清掉参数", func(t *testing.T) {
+		s, repo, svc, c := newTestService(ratelimit.ErrLimited, ratelimit.ErrLimited)
+		require.NoError(t, s.Send(context.Background(), "tpl", []string{"123456"}, "+8613800000000"))
+
+		// 还没到时间
+		n, err := s.RetryWaiting(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+
+		c.t = c.t.Add(10 * time.Second)
+		n, err = s.RetryWaiting(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, 2, repo.rows[0].Attempts)
+		assert.Equal(t, c.t.Add(20*time.Second), repo.rows[0].NextTime)
+
+		c.t = c.t.Add(20 * time.Second)
+		_, err = s.RetryWaiting(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, domain.AsyncSmsStatusSuccess, repo.rows[0].Status)
+		assert.Equal(t, 3, repo.rows[0].Attempts)
+		assert.Nil(t, repo.rows[0].Args)
+		assert.Equal(t, 3, svc.cnt)
+	})
+
+	t.Run("次数用完了", func(t *testing.T) {
+		s, repo, _, c := newTestService(failover.ErrAllFailed, failover.ErrAllFailed,
+			failover.ErrAllFailed, failover.ErrAllFailed)
+		require.NoError(t, s.Send(context.Background(), "tpl", []string{"123456"}, "+8613800000000"))
+		for i := 0; i < 3; i++ {
+			c.t = c.t.Add(time.Minute)
+			_, err := s.RetryWaiting(context.Background(), 10)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, domain.AsyncSmsStatusFailed, repo.rows[0].Status)
+		assert.Equal(t, 4, repo.rows[0].Attempts)
+		assert.Nil(t, repo.rows[0].Args)
+	})
+
+	t.Run("重试遇到重试也没用的错误", func(t *testing.T) {
+		s, repo, _, c := newTestService(ratelimit.ErrLimited, sms.ErrInvalidNumber)
+		require.NoError(t, s.Send(context.Background(), "tpl", []string{"123456"}, "+8613800000000"))
+		c.t = c.t.Add(10 * time.Second)
+		_, err := s.RetryWaiting(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, domain.AsyncSmsStatusFailed, repo.rows[0].Status)
+		assert.Equal(t, sms.ErrInvalidNumber.Error(), repo.rows[0].LastErr)
+	})
+
+	t.Run("过期了不再发送", func(t *testing.T) {
+		s, repo, svc, c := newTestService(ratelimit.ErrLimited)
+		require.NoError(t, s.Send(context.Background(), "tpl", []string{"123456"}, "+8613800000000"))
+		// 比如重试任务停了一段时间
+		c.t = c.t.Add(11 * time.Minute)
+		_, err := s.RetryWaiting(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, domain.AsyncSmsStatusFailed, repo.rows[0].Status)
+		assert.Equal(t, errExpired.Error(), repo.rows[0].LastErr)
+		assert.Equal(t, 1, svc.cnt)
+	})
+
+	t.Run("下一次重试会过期", func(t *testing.T) {
+		s, repo, _, c := newTestService(ratelimit.ErrLimited, ratelimit.ErrLimited)
+		require.NoError(t, s.Send(context.Background(), "tpl", []string{"123456"}, "+8613800000000"))
+		c.t = c.t.Add(9*time.Minute + 50*time.Second)
+		_, err := s.RetryWaiting(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, domain.AsyncSmsStatusFailed, repo.rows[0].Status)
+	})
+}
@@ -7,6 +7,9 @@ import (
 	"sync/atomic"
 )
 
+// ErrAllFailed 所有的服务商都发送失败了
+var ErrAllFailed = errors.New("所有短信服务商都发送失败了")
+
 type FailoverService struct {
 	svcs []sms.Service
 	idx  *atomic.Int64
@@ -17,16 +20,19 @@ func (s *FailoverService) Send(ctx context.Context, tpl string, args []string, n
 	length := int64(len(s.svcs))
 	for i := idx; i < idx+length; i++ {
 		err := s.svcs[i%length].Send(ctx, tpl, args, numbers...)
-		switch err {
-		case nil:
+		switch {
+		case err == nil:
 			return nil
-		case context.DeadlineExceeded, context.Canceled:
+		case err == context.DeadlineExceeded, err == context.Canceled:
 			return nil
+		case errors.Is(err, sms.ErrInvalidNumber):
+			// 号码不对，换服务商也没有用
+			return err
 		default:
 			//记录日志和监控
 		}
 	}
-	return errors.New("failover service ")
+	return ErrAllFailed
 }
 
 func NewFailoverService(svcs []sms.Service) sms.Service {
@@ -0,0 +1,57 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"github.com/jym0818/webook/internal/service/sms"
+	"github.com/jym0818/webook/pkg/phonex"
+)
+
+// Route 一个国家或者地区的短信怎么发。国际短信的模板要单独申请，
+// 所以模板 ID 也要按地区转换
+type Route struct {
+	Svc sms.Service
+	// Templates 默认模板 ID 到这个地区的模板 ID，没有配置的模板原样使用
+	Templates map[string]string
+}
+
+// Service 按号码的国际区号把短信分给不同的服务商，号码必须是 E.164 格式
+type Service struct {
+	// routes 国际区号到路由，比如 86、852
+	routes map[string]Route
+	def    sms.Service
+}
+
+func NewService(def sms.Service, routes map[string]Route) sms.Service {
+	return &Service{def: def, routes: routes}
+}
+
+func (s *Service) Send(ctx context.Context, tpl string, args []string, numbers ...string) error {
+	groups := make(map[string][]string, 1)
+	for _, n := range numbers {
+		code := phonex.CallingCode(n)
+		if _, ok := s.routes[code]; !ok {
+			code = ""
+		}
+		groups[code] = append(groups[code], n)
+	}
+	var errs []error
+	for code, ns := range groups {
+		err := s.send(ctx, code, tpl, args, ns)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) send(ctx context.Context, code string, tpl string, args []string, numbers []string) error {
+	r, ok := s.routes[code]
+	if !ok {
+		return s.def.Send(ctx, tpl, args, numbers...)
+	}
+	if t, ok := r.Templates[tpl]; ok {
+		tpl = t
+	}
+	return r.Svc.Send(ctx, tpl, args, numbers...)
+}
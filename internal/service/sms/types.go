@@ -1,6 +1,22 @@
 package sms
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// 服务商的错误码各不相同，实现的时候转换成下面这几种，用 errors.Is 判断。
+// 前两种可以重试或者换一个服务商，后两种重试也没有用
+var (
+	// ErrProviderLimited 服务商那边限流了
+	ErrProviderLimited = errors.New("短信服务商限流")
+	// ErrProviderUnavailable 服务商系统错误或者网络不通
+	ErrProviderUnavailable = errors.New("短信服务商不可用")
+	// ErrInvalidNumber 手机号不对，换服务商也没有用
+	ErrInvalidNumber = errors.New("手机号不对")
+	// ErrInvalidTemplate 模板、签名或者参数不对，要改配置
+	ErrInvalidTemplate = errors.New("短信模板不对")
+)
 
 type Service interface {
 	Send(ctx context.Context, tpl string, args []string, numbers ...string) error
@@ -4,34 +4,102 @@ import (
 	"context"
 	"errors"
 	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/events/user"
 	"github.com/jym0818/webook/internal/repository"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
+	"slices"
+	"time"
 )
 
 type UserService interface {
-	Signup(ctx context.Context, user domain.User) error
+	// Signup 只创建一个没有密码、还没有激活的账号，密码要等 ActivateByEmail 的时候才写进去，
+	// 不然别人可以抢先用你的邮箱注册，等你验证完了还能用他设置的密码登录。
+	// 邮箱已经注册了但是还没有验证的时候返回 ErrUserNotActivated
+	Signup(ctx context.Context, email string) error
 	Login(ctx context.Context, email, password string) (domain.User, error)
 	Profile(ctx context.Context, uid int64) (domain.User, error)
 	FindOrCreate(ctx context.Context, phone string) (domain.User, error)
 	FindOrCreateByWechat(ctx context.Context, info domain.WechatInfo) (domain.User, error)
+	// FindOrCreateByEmail 邮件登录链接校验通过之后调用，没有注册的邮箱直接创建没有密码的账号
+	FindOrCreateByEmail(ctx context.Context, email string) (domain.User, error)
+	// ActivateByEmail 邮箱验证码校验通过之后，激活账号并且设置密码，和登录一样会检查封禁和注销。
+	// 已经激活了的账号不会修改密码
+	ActivateByEmail(ctx context.Context, email string, password string) (domain.User, error)
+	// ResetPasswordByEmail 和 ResetPasswordByPhone 调用之前，要先校验验证码。
+	// 账号状态的检查和登录一样，被封禁或者已经注销了会返回 ErrUserBanned、ErrUserDeleted
+	ResetPasswordByEmail(ctx context.Context, email string, password string) (domain.User, error)
+	ResetPasswordByPhone(ctx context.Context, phone string, password string) (domain.User, error)
+	// UpdateNonSensitiveInfo 更新昵称、生日这些非敏感信息
+	UpdateNonSensitiveInfo(ctx context.Context, user domain.User) error
+
+	// BindPhone BindEmail BindWechat 给已有账号绑定新的登录方式，调用之前要先校验验证码。
+	// 如果返回 ErrIdentityConflict，那么返回的 domain.User 就是已经绑定了它的那个账号
+	BindPhone(ctx context.Context, uid int64, phone string) (domain.User, error)
+	BindEmail(ctx context.Context, uid int64, email string, password string) (domain.User, error)
+	BindWechat(ctx context.Context, uid int64, info domain.WechatInfo) (domain.User, error)
+	// Unbind 解绑，至少要保留一种登录方式
+	Unbind(ctx context.Context, uid int64, method domain.LoginMethod) error
+	// Merge 把 from 账号合并到 to 账号，调用方要确认用户同时拥有这两个账号。
+	// from 被封禁或者已经注销了会返回 ErrUserBanned、ErrUserDeleted
+	Merge(ctx context.Context, from, to int64) error
+
+	// FindOrCreateByOAuth2 GitHub、OIDC 这些第三方登录
+	FindOrCreateByOAuth2(ctx context.Context, info domain.OAuth2Info) (domain.User, error)
+	BindOAuth2(ctx context.Context, uid int64, info domain.OAuth2Info) (domain.User, error)
+	UnbindOAuth2(ctx context.Context, uid int64, provider string) error
+	OAuth2Bindings(ctx context.Context, uid int64) ([]domain.OAuth2Binding, error)
+
+	// Deactivate 申请注销，冷静期内登录就会恢复
+	Deactivate(ctx context.Context, uid int64) error
+	// PurgeDeactivated 注销过了冷静期的账号，一次最多处理 limit 个，返回处理了多少个
+	PurgeDeactivated(ctx context.Context, limit int, withdrawArticles bool) (int, error)
+	// RetryDeletedEvents 重发之前没有发出去的注销消息，一次最多 limit 个，返回发出去了多少个。
+	// 消息发不出去的时候返回错误，剩下的等下一次
+	RetryDeletedEvents(ctx context.Context, limit int) (int, error)
+
+	// Ban 封禁账号，until 传 domain.BanForever 就是永久封禁
+	Ban(ctx context.Context, uid int64, until time.Time, reason string) error
+	Unban(ctx context.Context, uid int64) error
+	// Search 管理后台用的
+	Search(ctx context.Context, q domain.UserQuery, offset int, limit int) ([]domain.User, error)
+	// FindUnnormalizedPhones 迁移手机号格式用的，按 id 从小到大返回 startId 之后的账号
+	FindUnnormalizedPhones(ctx context.Context, startId int64, limit int) ([]domain.User, error)
+	// RecordPhoneConflict 记下迁移之后和别的账号重复的手机号，后面人工联系用户合并
+	RecordPhoneConflict(ctx context.Context, uid int64, owner int64, phone string) error
 }
 
 var ErrUserDuplicateEmail = repository.ErrUserDuplicateEmail
 var ErrInvalidUserOrPassword = errors.New("账号或者密码错误")
+var ErrUserNotActivated = errors.New("账号未激活")
+var ErrUserNotFound = repository.ErrUserNotFound
+var ErrIdentityConflict = errors.New("已经被别的账号绑定")
+var ErrLastLoginMethod = errors.New("至少要保留一种登录方式")
+var ErrUserDeleted = errors.New("账号已注销")
+var ErrUserBanned = errors.New("账号已被封禁")
+
+// DeactivateCoolingOff 注销的冷静期
+const DeactivateCoolingOff = time.Hour * 24 * 30
 
 type userService struct {
-	repo repository.UserRepository
+	repo      repository.UserRepository
+	oauthRepo repository.OAuth2BindingRepository
+	producer  user.Producer
 }
 
 func (svc *userService) FindOrCreate(ctx context.Context, phone string) (domain.User, error) {
 	//查找
 	u, err := svc.repo.FindByPhone(ctx, phone)
+	if err == nil {
+		return svc.checkStatus(ctx, u)
+	}
 	if err != repository.ErrUserNotFound {
-		return u, nil
+		return u, err
 	}
 	//创建
 	err = svc.repo.Create(ctx, domain.User{
-		Phone: phone,
+		Phone:  phone,
+		Status: domain.UserStatusActive,
 	})
 	if err != nil {
 		return domain.User{}, err
@@ -43,12 +111,16 @@ func (svc *userService) FindOrCreate(ctx context.Context, phone string) (domain.
 func (svc *userService) FindOrCreateByWechat(ctx context.Context, info domain.WechatInfo) (domain.User, error) {
 	//查找
 	u, err := svc.repo.FindByWechat(ctx, info.OpenID)
+	if err == nil {
+		return svc.checkStatus(ctx, u)
+	}
 	if err != repository.ErrUserNotFound {
-		return u, nil
+		return u, err
 	}
 	//创建
 	err = svc.repo.Create(ctx, domain.User{
 		WechatInfo: info,
+		Status:     domain.UserStatusActive,
 	})
 	if err != nil {
 		return domain.User{}, err
@@ -57,6 +129,36 @@ func (svc *userService) FindOrCreateByWechat(ctx context.Context, info domain.We
 	return svc.repo.FindByWechat(ctx, info.OpenID)
 }
 
+func (svc *userService) FindOrCreateByEmail(ctx context.Context, email string) (domain.User, error) {
+	u, err := svc.repo.FindByEmail(ctx, email)
+	if err == nil {
+		// 能点开登录链接，说明邮箱是他的，注册了没有验证的顺便激活。
+		// 没有验证的账号，密码不一定是他设置的，别人可以先用他的邮箱注册，
+		// 所以激活的同时要清掉密码，之后他要用密码登录就走重置密码
+		if u.Status == domain.UserStatusUnverified {
+			err = svc.repo.UpdateStatusAndPassword(ctx, u.Id, domain.UserStatusActive, "")
+			if err != nil {
+				return domain.User{}, err
+			}
+			u.Status = domain.UserStatusActive
+			u.Password = ""
+		}
+		return svc.checkStatus(ctx, u)
+	}
+	if err != repository.ErrUserNotFound {
+		return u, err
+	}
+	err = svc.repo.Create(ctx, domain.User{
+		Email:  email,
+		Status: domain.UserStatusActive,
+	})
+	// 并发登录，别人先创建了
+	if err != nil && err != repository.ErrUserDuplicateEmail {
+		return domain.User{}, err
+	}
+	return svc.repo.FindByEmail(ctx, email)
+}
+
 func (svc *userService) Profile(ctx context.Context, uid int64) (domain.User, error) {
 	return svc.repo.FindById(ctx, uid)
 }
@@ -74,20 +176,391 @@ func (svc *userService) Login(ctx context.Context, email, password string) (doma
 	if err != nil {
 		return domain.User{}, ErrInvalidUserOrPassword
 	}
-	return user, nil
+	// 密码对了才告诉他没激活，不然别人可以用这个来探测邮箱有没有注册
+	if user.Status == domain.UserStatusUnverified {
+		return domain.User{}, ErrUserNotActivated
+	}
+	return svc.checkStatus(ctx, user)
 }
 
-func NewuserService(repo repository.UserRepository) UserService {
+// checkStatus 登录的时候检查账号状态，冷静期内登录就撤销注销
+func (svc *userService) checkStatus(ctx context.Context, u domain.User) (domain.User, error) {
+	if u.Banned() {
+		return domain.User{}, ErrUserBanned
+	}
+	switch u.Status {
+	case domain.UserStatusDeactivated:
+		if time.Since(u.DeactivateTime) > DeactivateCoolingOff {
+			// 过了冷静期，只是还没有轮到清理
+			return domain.User{}, ErrUserDeleted
+		}
+		err := svc.repo.UpdateStatus(ctx, u.Id, domain.UserStatusActive)
+		if err != nil {
+			return domain.User{}, err
+		}
+		u.Status = domain.UserStatusActive
+		return u, nil
+	case domain.UserStatusDeleted, domain.UserStatusMerged:
+		return domain.User{}, ErrUserDeleted
+	default:
+		return u, nil
+	}
+}
+
+func (svc *userService) ActivateByEmail(ctx context.Context, email string, password string) (domain.User, error) {
+	u, err := svc.repo.FindByEmail(ctx, email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	// 验证完了会直接登录，和别的登录一样要检查状态
+	u, err = svc.checkStatus(ctx, u)
+	if err != nil || u.Status != domain.UserStatusUnverified {
+		return u, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return domain.User{}, err
+	}
+	err = svc.repo.UpdateStatusAndPassword(ctx, u.Id, domain.UserStatusActive, string(hash))
+	if err != nil {
+		return domain.User{}, err
+	}
+	u.Status = domain.UserStatusActive
+	return u, nil
+}
+
+func (svc *userService) ResetPasswordByEmail(ctx context.Context, email string, password string) (domain.User, error) {
+	u, err := svc.repo.FindByEmail(ctx, email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	// 和登录一样，封禁和注销了的账号不能用重置密码绕过去
+	u, err = svc.checkStatus(ctx, u)
+	if err != nil {
+		return domain.User{}, err
+	}
+	// 能收到邮件验证码，说明邮箱是他的，顺便激活
+	if u.Status == domain.UserStatusUnverified {
+		hash, er := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if er != nil {
+			return domain.User{}, er
+		}
+		u.Status = domain.UserStatusActive
+		return u, svc.repo.UpdateStatusAndPassword(ctx, u.Id, domain.UserStatusActive, string(hash))
+	}
+	return u, svc.resetPassword(ctx, u.Id, password)
+}
+
+func (svc *userService) ResetPasswordByPhone(ctx context.Context, phone string, password string) (domain.User, error) {
+	u, err := svc.repo.FindByPhone(ctx, phone)
+	if err != nil {
+		return domain.User{}, err
+	}
+	u, err = svc.checkStatus(ctx, u)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return u, svc.resetPassword(ctx, u.Id, password)
+}
+
+func (svc *userService) UpdateNonSensitiveInfo(ctx context.Context, user domain.User) error {
+	// 防止上层不小心把敏感字段传下来
+	user.Email = ""
+	user.Phone = ""
+	user.Password = ""
+	user.WechatInfo = domain.WechatInfo{}
+	return svc.repo.UpdateNonZeroFields(ctx, user)
+}
+
+func (svc *userService) BindPhone(ctx context.Context, uid int64, phone string) (domain.User, error) {
+	return svc.bind(ctx, uid, func() (domain.User, error) {
+		return svc.repo.FindByPhone(ctx, phone)
+	}, func() error {
+		return svc.repo.BindPhone(ctx, uid, phone)
+	})
+}
+
+func (svc *userService) BindEmail(ctx context.Context, uid int64, email string, password string) (domain.User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return svc.bind(ctx, uid, func() (domain.User, error) {
+		return svc.repo.FindByEmail(ctx, email)
+	}, func() error {
+		return svc.repo.BindEmail(ctx, uid, email, string(hash))
+	})
+}
+
+func (svc *userService) BindWechat(ctx context.Context, uid int64, info domain.WechatInfo) (domain.User, error) {
+	return svc.bind(ctx, uid, func() (domain.User, error) {
+		return svc.repo.FindByWechat(ctx, info.OpenID)
+	}, func() error {
+		return svc.repo.BindWechat(ctx, uid, info)
+	})
+}
+
+// bind find 用来查找已经绑定了这个登录方式的账号
+func (svc *userService) bind(ctx context.Context, uid int64,
+	find func() (domain.User, error), update func() error) (domain.User, error) {
+	owner, err := find()
+	switch err {
+	case nil:
+		if owner.Id == uid {
+			// 已经绑定在自己身上了
+			return domain.User{}, nil
+		}
+		return owner, ErrIdentityConflict
+	case repository.ErrUserNotFound:
+		err = update()
+		if err == repository.ErrUserDuplicate {
+			// 并发绑定，被别人抢先了
+			owner, err = find()
+			if err != nil {
+				return domain.User{}, err
+			}
+			return owner, ErrIdentityConflict
+		}
+		return domain.User{}, err
+	default:
+		return domain.User{}, err
+	}
+}
+
+func (svc *userService) Unbind(ctx context.Context, uid int64, method domain.LoginMethod) error {
+	u, err := svc.repo.FindById(ctx, uid)
+	if err != nil {
+		return err
+	}
+	methods := u.LoginMethods()
+	if !slices.Contains(methods, method) {
+		return nil
+	}
+	cnt, err := svc.loginMethodCnt(ctx, u)
+	if err != nil {
+		return err
+	}
+	if cnt <= 1 {
+		return ErrLastLoginMethod
+	}
+	return svc.repo.Unbind(ctx, uid, method)
+}
+
+func (svc *userService) FindOrCreateByOAuth2(ctx context.Context, info domain.OAuth2Info) (domain.User, error) {
+	b, err := svc.oauthRepo.FindBySubject(ctx, info.Provider, info.Subject)
+	if err == nil {
+		u, er := svc.repo.FindById(ctx, b.Uid)
+		if er != nil {
+			return domain.User{}, er
+		}
+		return svc.checkStatus(ctx, u)
+	}
+	if err != repository.ErrOAuth2BindingNotFound {
+		return domain.User{}, err
+	}
+	// 不按邮箱自动关联已有账号，不然别人在第三方平台上填一个你的邮箱就能登录你的账号。
+	// 想要关联的话，登录之后走绑定
+	uid, err := svc.oauthRepo.CreateUser(ctx, info)
+	if err == repository.ErrUserDuplicate {
+		// 并发登录，别人先创建了
+		b, err = svc.oauthRepo.FindBySubject(ctx, info.Provider, info.Subject)
+		if err != nil {
+			return domain.User{}, err
+		}
+		uid = b.Uid
+	} else if err != nil {
+		return domain.User{}, err
+	}
+	return svc.repo.FindById(ctx, uid)
+}
+
+func (svc *userService) BindOAuth2(ctx context.Context, uid int64, info domain.OAuth2Info) (domain.User, error) {
+	return svc.bind(ctx, uid, func() (domain.User, error) {
+		b, err := svc.oauthRepo.FindBySubject(ctx, info.Provider, info.Subject)
+		if err == repository.ErrOAuth2BindingNotFound {
+			return domain.User{}, repository.ErrUserNotFound
+		}
+		if err != nil {
+			return domain.User{}, err
+		}
+		return svc.repo.FindById(ctx, b.Uid)
+	}, func() error {
+		return svc.oauthRepo.Bind(ctx, uid, info)
+	})
+}
+
+func (svc *userService) UnbindOAuth2(ctx context.Context, uid int64, provider string) error {
+	u, err := svc.repo.FindById(ctx, uid)
+	if err != nil {
+		return err
+	}
+	bs, err := svc.oauthRepo.FindByUid(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(bs, func(b domain.OAuth2Binding) bool {
+		return b.Provider == provider
+	}) {
+		return nil
+	}
+	if len(u.LoginMethods())+len(bs) <= 1 {
+		return ErrLastLoginMethod
+	}
+	return svc.oauthRepo.Unbind(ctx, uid, provider)
+}
+
+func (svc *userService) OAuth2Bindings(ctx context.Context, uid int64) ([]domain.OAuth2Binding, error) {
+	return svc.oauthRepo.FindByUid(ctx, uid)
+}
+
+func (svc *userService) Deactivate(ctx context.Context, uid int64) error {
+	return svc.repo.Deactivate(ctx, uid)
+}
+
+func (svc *userService) PurgeDeactivated(ctx context.Context, limit int, withdrawArticles bool) (int, error) {
+	us, err := svc.repo.FindDeactivated(ctx, time.Now().Add(-DeactivateCoolingOff), limit)
+	if err != nil {
+		return 0, err
+	}
+	cnt := 0
+	for _, u := range us {
+		err = svc.repo.Delete(ctx, u.Id, withdrawArticles)
+		if err == repository.ErrUserNotFound {
+			// 刚好在这个时候登录恢复了
+			continue
+		}
+		if err != nil {
+			return cnt, err
+		}
+		cnt++
+		er := svc.produceDeletedEvent(ctx, u.Id)
+		if er != nil {
+			// 没有清掉标记，RetryDeletedEvents 会再发
+			zap.L().Error("发送账号注销消息失败", zap.Error(er), zap.Int64("uid", u.Id))
+		}
+	}
+	return cnt, nil
+}
+
+func (svc *userService) RetryDeletedEvents(ctx context.Context, limit int) (int, error) {
+	uids, err := svc.repo.FindPurgeEventPending(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+	for i, uid := range uids {
+		err = svc.produceDeletedEvent(ctx, uid)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(uids), nil
+}
+
+// produceDeletedEvent 点赞收藏在 interactive 服务里面，通知它清理，发出去了才清掉标记。
+// 清标记失败的话会重复发，interactive 那边重复删除没有影响
+func (svc *userService) produceDeletedEvent(ctx context.Context, uid int64) error {
+	err := svc.producer.ProduceDeletedEvent(ctx, user.DeletedEvent{Uid: uid})
+	if err != nil {
+		return err
+	}
+	return svc.repo.ClearPurgeEventPending(ctx, uid)
+}
+
+func (svc *userService) Ban(ctx context.Context, uid int64, until time.Time, reason string) error {
+	_, err := svc.repo.FindById(ctx, uid)
+	if err != nil {
+		return err
+	}
+	return svc.repo.UpdateBan(ctx, uid, until, reason)
+}
+
+func (svc *userService) Unban(ctx context.Context, uid int64) error {
+	return svc.repo.UpdateBan(ctx, uid, time.Time{}, "")
+}
+
+func (svc *userService) Search(ctx context.Context, q domain.UserQuery, offset int, limit int) ([]domain.User, error) {
+	return svc.repo.Search(ctx, q, offset, limit)
+}
+
+func (svc *userService) FindUnnormalizedPhones(ctx context.Context, startId int64, limit int) ([]domain.User, error) {
+	return svc.repo.FindUnnormalizedPhones(ctx, startId, limit)
+}
+
+func (svc *userService) RecordPhoneConflict(ctx context.Context, uid int64, owner int64, phone string) error {
+	return svc.repo.SavePhoneConflict(ctx, uid, owner, phone)
+}
+
+// loginMethodCnt 手机号、邮箱、微信加上第三方登录的数量
+func (svc *userService) loginMethodCnt(ctx context.Context, u domain.User) (int, error) {
+	bs, err := svc.oauthRepo.FindByUid(ctx, u.Id)
+	if err != nil {
+		return 0, err
+	}
+	return len(u.LoginMethods()) + len(bs), nil
+}
+
+func (svc *userService) Merge(ctx context.Context, from, to int64) error {
+	if from == to {
+		return nil
+	}
+	u, err := svc.repo.FindById(ctx, from)
+	if err != nil {
+		return err
+	}
+	// 不然被封禁的账号可以把手机号、邮箱合并到新账号上面，继续登录
+	if u.Banned() {
+		return ErrUserBanned
+	}
+	switch u.Status {
+	case domain.UserStatusDeleted, domain.UserStatusMerged:
+		return ErrUserDeleted
+	case domain.UserStatusDeactivated:
+		if time.Since(u.DeactivateTime) > DeactivateCoolingOff {
+			return ErrUserDeleted
+		}
+	}
+	err = svc.repo.Merge(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	// 点赞收藏这些数据在 interactive 服务里面，通知它迁移
+	er := svc.producer.ProduceMergedEvent(ctx, user.MergedEvent{From: from, To: to})
+	if er != nil {
+		zap.L().Error("发送账号合并消息失败", zap.Error(er),
+			zap.Int64("from", from), zap.Int64("to", to))
+	}
+	return nil
+}
+
+func (svc *userService) resetPassword(ctx context.Context, uid int64, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return svc.repo.UpdatePassword(ctx, uid, string(hash))
+}
+
+func NewuserService(repo repository.UserRepository, oauthRepo repository.OAuth2BindingRepository,
+	producer user.Producer) UserService {
 	return &userService{
-		repo: repo,
+		repo:      repo,
+		oauthRepo: oauthRepo,
+		producer:  producer,
 	}
 }
 
-func (svc *userService) Signup(ctx context.Context, user domain.User) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+func (svc *userService) Signup(ctx context.Context, email string) error {
+	err := svc.repo.Create(ctx, domain.User{Email: email, Status: domain.UserStatusUnverified})
+	if err != repository.ErrUserDuplicateEmail {
+		return err
+	}
+	// 邮箱已经被注册了，但是一直没有验证，上层重新发一次验证邮件就可以
+	u, err := svc.repo.FindByEmail(ctx, email)
 	if err != nil {
 		return err
 	}
-	user.Password = string(hash)
-	return svc.repo.Create(ctx, user)
+	if u.Status == domain.UserStatusUnverified {
+		return ErrUserNotActivated
+	}
+	return ErrUserDuplicateEmail
 }
@@ -0,0 +1,417 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/events/user"
+	"github.com/jym0818/webook/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+	"time"
+)
+
+// memUserRepo 只实现了测试用到的方法，别的方法调用了会 panic
+type memUserRepo struct {
+	repository.UserRepository
+	users map[int64]domain.User
+	// pending 注销了但是消息还没发出去的账号
+	pending map[int64]bool
+}
+
+func newMemUserRepo(users ...domain.User) *memUserRepo {
+	repo := &memUserRepo{users: map[int64]domain.User{}, pending: map[int64]bool{}}
+	for _, u := range users {
+		repo.users[u.Id] = u
+	}
+	return repo
+}
+
+func (r *memUserRepo) Create(ctx context.Context, u domain.User) error {
+	if u.Email != "" {
+		if _, err := r.FindByEmail(ctx, u.Email); err == nil {
+			return repository.ErrUserDuplicateEmail
+		}
+	}
+	u.Id = int64(len(r.users) + 1)
+	r.users[u.Id] = u
+	return nil
+}
+
+func (r *memUserRepo) FindByEmail(ctx context.Context, email string) (domain.User, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return domain.User{}, repository.ErrUserNotFound
+}
+
+func (r *memUserRepo) FindByPhone(ctx context.Context, phone string) (domain.User, error) {
+	for _, u := range r.users {
+		if u.Phone == phone {
+			return u, nil
+		}
+	}
+	return domain.User{}, repository.ErrUserNotFound
+}
+
+func (r *memUserRepo) FindById(ctx context.Context, uid int64) (domain.User, error) {
+	u, ok := r.users[uid]
+	if !ok {
+		return domain.User{}, repository.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (r *memUserRepo) Merge(ctx context.Context, from, to int64) error {
+	u := r.users[from]
+	u.Status = domain.UserStatusMerged
+	r.users[from] = u
+	return nil
+}
+
+func (r *memUserRepo) UpdateStatus(ctx context.Context, uid int64, status domain.UserStatus) error {
+	u := r.users[uid]
+	u.Status = status
+	r.users[uid] = u
+	return nil
+}
+
+func (r *memUserRepo) UpdatePassword(ctx context.Context, uid int64, password string) error {
+	u := r.users[uid]
+	u.Password = password
+	r.users[uid] = u
+	return nil
+}
+
+func (r *memUserRepo) UpdateStatusAndPassword(ctx context.Context, uid int64, status domain.UserStatus, password string) error {
+	u := r.users[uid]
+	u.Status = status
+	u.Password = password
+	r.users[uid] = u
+	return nil
+}
+
+func (r *memUserRepo) FindDeactivated(ctx context.Context, before time.Time, limit int) ([]domain.User, error) {
+	var res []domain.User
+	for _, u := range r.users {
+		if u.Status == domain.UserStatusDeactivated && u.DeactivateTime.Before(before) {
+			res = append(res, u)
+		}
+	}
+	return res, nil
+}
+
+func (r *memUserRepo) Delete(ctx context.Context, uid int64, withdrawArticles bool) error {
+	r.users[uid] = domain.User{Id: uid, Status: domain.UserStatusDeleted}
+	r.pending[uid] = true
+	return nil
+}
+
+func (r *memUserRepo) FindPurgeEventPending(ctx context.Context, limit int) ([]int64, error) {
+	var res []int64
+	for uid := range r.pending {
+		res = append(res, uid)
+	}
+	return res, nil
+}
+
+func (r *memUserRepo) ClearPurgeEventPending(ctx context.Context, uid int64) error {
+	delete(r.pending, uid)
+	return nil
+}
+
+// nopProducer 消息发出去就不管了，failDeleted 为 true 的时候注销消息发不出去
+type nopProducer struct {
+	user.Producer
+	merged      []user.MergedEvent
+	deleted     []user.DeletedEvent
+	failDeleted bool
+}
+
+func (p *nopProducer) ProduceDeletedEvent(ctx context.Context, evt user.DeletedEvent) error {
+	if p.failDeleted {
+		return errors.New("kafka 挂了")
+	}
+	p.deleted = append(p.deleted, evt)
+	return nil
+}
+
+func (p *nopProducer) ProduceMergedEvent(ctx context.Context, evt user.MergedEvent) error {
+	p.merged = append(p.merged, evt)
+	return nil
+}
+
+func hashPassword(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	return string(hash)
+}
+
+// 别人先用受害者的邮箱注册，受害者用邮件链接登录之后，别人的密码不能再用
+func TestUserService_FindOrCreateByEmail_PreAccountTakeover(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUserRepo(domain.User{
+		Id:       1,
+		Email:    "victim@qq.com",
+		Password: hashPassword(t, "attacker#123"),
+		Status:   domain.UserStatusUnverified,
+	})
+	svc := NewuserService(repo, nil, nil)
+
+	u, err := svc.FindOrCreateByEmail(ctx, "victim@qq.com")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), u.Id)
+	assert.Equal(t, domain.UserStatusActive, u.Status)
+	assert.Empty(t, repo.users[1].Password)
+
+	_, err = svc.Login(ctx, "victim@qq.com", "attacker#123")
+	assert.Equal(t, ErrInvalidUserOrPassword, err)
+}
+
+func TestUserService_FindOrCreateByEmail_KeepActivePassword(t *testing.T) {
+	ctx := context.Background()
+	hash := hashPassword(t, "hello#world123")
+	repo := newMemUserRepo(domain.User{
+		Id:       1,
+		Email:    "123@qq.com",
+		Password: hash,
+		Status:   domain.UserStatusActive,
+	})
+	svc := NewuserService(repo, nil, nil)
+
+	_, err := svc.FindOrCreateByEmail(ctx, "123@qq.com")
+	require.NoError(t, err)
+	// 已经激活的账号，密码是他自己设置的，不用清掉
+	assert.Equal(t, hash, repo.users[1].Password)
+}
+
+// 别人抢先用受害者的邮箱注册，受害者验证完了之后，别人不能用自己设置的密码登录
+func TestUserService_Signup_PreAccountHijack(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUserRepo()
+	svc := NewuserService(repo, nil, nil)
+
+	err := svc.Signup(ctx, "victim@qq.com")
+	require.NoError(t, err)
+	assert.Empty(t, repo.users[1].Password)
+	assert.Equal(t, domain.UserStatusUnverified, repo.users[1].Status)
+	err = svc.Signup(ctx, "victim@qq.com")
+	assert.Equal(t, ErrUserNotActivated, err)
+
+	// 验证码只会发到受害者的邮箱里面，密码是受害者验证的时候设置的
+	u, err := svc.ActivateByEmail(ctx, "victim@qq.com", "victim#123")
+	require.NoError(t, err)
+	assert.Equal(t, domain.UserStatusActive, u.Status)
+	_, err = svc.Login(ctx, "victim@qq.com", "victim#123")
+	assert.NoError(t, err)
+
+	err = svc.Signup(ctx, "victim@qq.com")
+	assert.Equal(t, ErrUserDuplicateEmail, err)
+	// 已经激活了，再验证一次也不能改密码
+	_, err = svc.ActivateByEmail(ctx, "victim@qq.com", "attacker#123")
+	require.NoError(t, err)
+	_, err = svc.Login(ctx, "victim@qq.com", "attacker#123")
+	assert.Equal(t, ErrInvalidUserOrPassword, err)
+}
+
+func TestUserService_ActivateByEmail_Banned(t *testing.T) {
+	repo := newMemUserRepo(domain.User{
+		Id:       1,
+		Email:    "123@qq.com",
+		Status:   domain.UserStatusUnverified,
+		BanUntil: time.Now().Add(time.Hour),
+	})
+	_, err := NewuserService(repo, nil, nil).ActivateByEmail(context.Background(), "123@qq.com", "hello#world123")
+	assert.Equal(t, ErrUserBanned, err)
+	assert.Equal(t, domain.UserStatusUnverified, repo.users[1].Status)
+	assert.Empty(t, repo.users[1].Password)
+}
+
+func TestUserService_ResetPassword_CheckStatus(t *testing.T) {
+	testCases := []struct {
+		name       string
+		user       domain.User
+		wantErr    error
+		wantStatus domain.UserStatus
+	}{
+		{
+			name:       "正常账号",
+			user:       domain.User{Status: domain.UserStatusActive},
+			wantStatus: domain.UserStatusActive,
+		},
+		{
+			name:    "被封禁了",
+			user:    domain.User{Status: domain.UserStatusActive, BanUntil: time.Now().Add(time.Hour)},
+			wantErr: ErrUserBanned,
+		},
+		{
+			name:       "封禁已经过期",
+			user:       domain.User{Status: domain.UserStatusActive, BanUntil: time.Now().Add(-time.Hour)},
+			wantStatus: domain.UserStatusActive,
+		},
+		{
+			name: "冷静期内，恢复账号",
+			user: domain.User{Status: domain.UserStatusDeactivated,
+				DeactivateTime: time.Now().Add(-time.Hour)},
+			wantStatus: domain.UserStatusActive,
+		},
+		{
+			name: "过了冷静期",
+			user: domain.User{Status: domain.UserStatusDeactivated,
+				DeactivateTime: time.Now().Add(-DeactivateCoolingOff - time.Hour)},
+			wantErr: ErrUserDeleted,
+		},
+		{
+			name:    "已经注销",
+			user:    domain.User{Status: domain.UserStatusDeleted},
+			wantErr: ErrUserDeleted,
+		},
+		{
+			name:    "已经被合并",
+			user:    domain.User{Status: domain.UserStatusMerged},
+			wantErr: ErrUserDeleted,
+		},
+	}
+	resets := map[string]func(svc UserService) (domain.User, error){
+		"邮箱": func(svc UserService) (domain.User, error) {
+			return svc.ResetPasswordByEmail(context.Background(), "123@qq.com", "new#password123")
+		},
+		"手机号": func(svc UserService) (domain.User, error) {
+			return svc.ResetPasswordByPhone(context.Background(), "+8613800000000", "new#password123")
+		},
+	}
+	for _, tc := range testCases {
+		for by, reset := range resets {
+			t.Run(tc.name+"/"+by, func(t *testing.T) {
+				old := hashPassword(t, "old#password123")
+				u := tc.user
+				u.Id = 1
+				u.Email = "123@qq.com"
+				u.Phone = "+8613800000000"
+				u.Password = old
+				repo := newMemUserRepo(u)
+
+				_, err := reset(NewuserService(repo, nil, nil))
+				assert.Equal(t, tc.wantErr, err)
+				saved := repo.users[1]
+				if tc.wantErr != nil {
+					assert.Equal(t, old, saved.Password)
+					return
+				}
+				assert.Equal(t, tc.wantStatus, saved.Status)
+				assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(saved.Password), []byte("new#password123")))
+			})
+		}
+	}
+}
+
+// 能收到重置密码的邮件，说明邮箱是他的，顺便激活
+func TestUserService_ResetPasswordByEmail_Activate(t *testing.T) {
+	repo := newMemUserRepo(domain.User{
+		Id:       1,
+		Email:    "123@qq.com",
+		Password: hashPassword(t, "attacker#123"),
+		Status:   domain.UserStatusUnverified,
+	})
+	svc := NewuserService(repo, nil, nil)
+
+	u, err := svc.ResetPasswordByEmail(context.Background(), "123@qq.com", "new#password123")
+	require.NoError(t, err)
+	assert.Equal(t, domain.UserStatusActive, u.Status)
+	assert.Equal(t, domain.UserStatusActive, repo.users[1].Status)
+	_, err = svc.Login(context.Background(), "123@qq.com", "attacker#123")
+	assert.Equal(t, ErrInvalidUserOrPassword, err)
+	_, err = svc.Login(context.Background(), "123@qq.com", "new#password123")
+	assert.NoError(t, err)
+}
+
+func TestUserService_Merge(t *testing.T) {
+	testCases := []struct {
+		name    string
+		from    domain.User
+		wantErr error
+	}{
+		{name: "正常账号", from: domain.User{Status: domain.UserStatusActive}},
+		{
+			name:    "被封禁了",
+			from:    domain.User{Status: domain.UserStatusActive, BanUntil: time.Now().Add(time.Hour)},
+			wantErr: ErrUserBanned,
+		},
+		{
+			name:    "永久封禁",
+			from:    domain.User{Status: domain.UserStatusActive, BanUntil: domain.BanForever},
+			wantErr: ErrUserBanned,
+		},
+		{
+			name: "冷静期内",
+			from: domain.User{Status: domain.UserStatusDeactivated,
+				DeactivateTime: time.Now().Add(-time.Hour)},
+		},
+		{
+			name: "过了冷静期",
+			from: domain.User{Status: domain.UserStatusDeactivated,
+				DeactivateTime: time.Now().Add(-DeactivateCoolingOff - time.Hour)},
+			wantErr: ErrUserDeleted,
+		},
+		{name: "已经注销", from: domain.User{Status: domain.UserStatusDeleted}, wantErr: ErrUserDeleted},
+		{name: "已经被合并过", from: domain.User{Status: domain.UserStatusMerged}, wantErr: ErrUserDeleted},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.from.Id = 1
+			tc.from.Phone = "+8613800000000"
+			repo := newMemUserRepo(tc.from, domain.User{Id: 2, Status: domain.UserStatusActive})
+			producer := &nopProducer{}
+			svc := NewuserService(repo, nil, producer)
+
+			err := svc.Merge(context.Background(), 1, 2)
+			assert.Equal(t, tc.wantErr, err)
+			if tc.wantErr != nil {
+				assert.Equal(t, tc.from, repo.users[1])
+				assert.Empty(t, producer.merged)
+				return
+			}
+			assert.Equal(t, domain.UserStatusMerged, repo.users[1].Status)
+			assert.Equal(t, []user.MergedEvent{{From: 1, To: 2}}, producer.merged)
+		})
+	}
+}
+
+// 注销消息发送失败的时候，账号已经抹掉了，消息要留到下一次再发
+func TestUserService_PurgeDeactivated_RetryEvent(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUserRepo(domain.User{
+		Id:             1,
+		Status:         domain.UserStatusDeactivated,
+		DeactivateTime: time.Now().Add(-DeactivateCoolingOff - time.Hour),
+	})
+	producer := &nopProducer{failDeleted: true}
+	svc := NewuserService(repo, nil, producer)
+
+	cnt, err := svc.PurgeDeactivated(ctx, 10, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cnt)
+	assert.Equal(t, domain.UserStatusDeleted, repo.users[1].Status)
+	assert.True(t, repo.pending[1])
+
+	cnt, err = svc.RetryDeletedEvents(ctx, 10)
+	assert.Error(t, err)
+	assert.Equal(t, 0, cnt)
+	assert.True(t, repo.pending[1])
+
+	producer.failDeleted = false
+	cnt, err = svc.RetryDeletedEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cnt)
+	assert.Empty(t, repo.pending)
+	assert.Equal(t, []user.DeletedEvent{{Uid: 1}}, producer.deleted)
+
+	// 发出去了就不会再发
+	cnt, err = svc.RetryDeletedEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 0, cnt)
+}
@@ -0,0 +1,75 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/errs"
+	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/pkg/ginx"
+	"github.com/jym0818/webook/pkg/openapi"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// AdminRoleHandler 给用户分配角色。第一个管理员要直接在 user_roles 表里面插入
+type AdminRoleHandler struct {
+	roleSvc service.RoleService
+}
+
+func NewAdminRoleHandler(roleSvc service.RoleService) *AdminRoleHandler {
+	return &AdminRoleHandler{roleSvc: roleSvc}
+}
+
+type RoleReq struct {
+	Uid  int64  `json:"uid"`
+	Role string `json:"role"`
+}
+
+func (h *AdminRoleHandler) RegisterRoutes(s *gin.Engine) {
+	g := s.Group("/admin/roles", RequirePermission(domain.PermRoleManage))
+	g.POST("/list", ginx.WrapBody(h.List))
+	g.POST("/grant", ginx.WrapBodyAndClaims(h.Grant))
+	g.POST("/revoke", ginx.WrapBodyAndClaims(h.Revoke))
+}
+
+func (h *AdminRoleHandler) Docs() []openapi.Operation {
+	const tag = "管理后台"
+	return []openapi.Operation{
+		{Method: http.MethodPost, Path: "/admin/roles/list", Summary: "用户的角色", Tag: tag, Request: RoleReq{}, Response: []string{}},
+		{Method: http.MethodPost, Path: "/admin/roles/grant", Summary: "分配角色", Tag: tag, Request: RoleReq{}},
+		{Method: http.MethodPost, Path: "/admin/roles/revoke", Summary: "撤销角色", Tag: tag, Request: RoleReq{}},
+	}
+}
+
+func (h *AdminRoleHandler) List(ctx *gin.Context, req RoleReq) (Result, error) {
+	roles, err := h.roleSvc.Roles(ctx.Request.Context(), req.Uid)
+	if err != nil {
+		return errUserInternal, err
+	}
+	return Result{Code: 200, Msg: "ok", Data: roles}, nil
+}
+
+func (h *AdminRoleHandler) Grant(ctx *gin.Context, req RoleReq, uc *UserClaims) (Result, error) {
+	err := h.roleSvc.Grant(ctx.Request.Context(), req.Uid, domain.Role(req.Role))
+	if err != nil {
+		// 未定义的角色在 errors.go 里面登记过了
+		return errUserInternal, err
+	}
+	zap.L().Info("分配角色", zap.Int64("operator", uc.Uid),
+		zap.Int64("uid", req.Uid), zap.String("role", req.Role))
+	return Result{Code: 200, Msg: "ok"}, nil
+}
+
+func (h *AdminRoleHandler) Revoke(ctx *gin.Context, req RoleReq, uc *UserClaims) (Result, error) {
+	// 防止最后一个管理员把自己撤掉，之后就没人能管了
+	if req.Uid == uc.Uid && domain.Role(req.Role) == domain.RoleAdmin {
+		return Result{Code: errs.UserInvalidInput, Msg: "不能撤销自己的管理员角色"}, nil
+	}
+	err := h.roleSvc.Revoke(ctx.Request.Context(), req.Uid, domain.Role(req.Role))
+	if err != nil {
+		return errUserInternal, err
+	}
+	zap.L().Info("撤销角色", zap.Int64("operator", uc.Uid),
+		zap.Int64("uid", req.Uid), zap.String("role", req.Role))
+	return Result{Code: 200, Msg: "ok"}, nil
+}
@@ -0,0 +1,322 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/errs"
+	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/pkg/openapi"
+	"github.com/jym0818/webook/pkg/phonex"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+	"unicode/utf8"
+)
+
+// AdminUserHandler 管理后台查询用户和封禁
+type AdminUserHandler struct {
+	jwtHandler
+	svc    service.UserService
+	phones *phonex.Parser
+}
+
+func NewAdminUserHandler(svc service.UserService, roleSvc service.RoleService, logSvc service.LoginLogService,
+	phones *phonex.Parser, cmd redis.Cmdable, keys JWTKeyrings, binder *SessionBinder) *AdminUserHandler {
+	return &AdminUserHandler{
+		jwtHandler: newJWTHandler(cmd, keys, roleSvc, logSvc, binder),
+		svc:        svc,
+		phones:     phones,
+	}
+}
+
+func (h *AdminUserHandler) RegisterRoutes(s *gin.Engine) {
+	g := s.Group("/admin/users")
+	g.POST("/search", RequirePermission(domain.PermUserRead), h.Search)
+	g.POST("/detail", RequirePermission(domain.PermUserRead), h.Detail)
+	g.POST("/logins", RequirePermission(domain.PermUserRead), h.LoginLogs)
+	g.POST("/ban", RequirePermission(domain.PermUserManage), h.Ban)
+	g.POST("/unban", RequirePermission(domain.PermUserManage), h.Unban)
+}
+
+func (h *AdminUserHandler) Docs() []openapi.Operation {
+	const tag = "管理后台"
+	return []openapi.Operation{
+		{Method: http.MethodPost, Path: "/admin/users/search", Summary: "搜索用户", Tag: tag, Request: AdminUserSearchReq{}, Response: []AdminUserVO{}},
+		{Method: http.MethodPost, Path: "/admin/users/detail", Summary: "用户详情", Tag: tag, Request: AdminUserReq{}, Response: AdminUserDetailVO{}},
+		{Method: http.MethodPost, Path: "/admin/users/logins", Summary: "登录审计日志", Tag: tag, Request: AdminLoginLogReq{}, Response: []AdminLoginLogVO{}},
+		{Method: http.MethodPost, Path: "/admin/users/ban", Summary: "封禁用户，会下线所有会话", Tag: tag, Request: BanReq{}},
+		{Method: http.MethodPost, Path: "/admin/users/unban", Summary: "解封用户", Tag: tag, Request: AdminUserReq{}},
+	}
+}
+
+type AdminUserSearchReq struct {
+	Id       int64  `json:"id"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Nickname string `json:"nickname"`
+	// CtimeStart 和 CtimeEnd 格式是 2006-01-02 15:04:05，左闭右开
+	CtimeStart string `json:"ctime_start"`
+	CtimeEnd   string `json:"ctime_end"`
+	Offset     int    `json:"offset"`
+	Limit      int    `json:"limit"`
+}
+
+type AdminUserVO struct {
+	UserProfileVO
+	Status       uint8  `json:"status"`
+	WechatOpenID string `json:"wechat_open_id"`
+	// BanUntil 没有封禁的时候是空字符串
+	BanUntil  string `json:"ban_until"`
+	BanReason string `json:"ban_reason"`
+}
+
+type AdminUserDetailVO struct {
+	AdminUserVO
+	Roles    []domain.Role          `json:"roles"`
+	Bindings []domain.OAuth2Binding `json:"bindings"`
+}
+
+func newAdminUserVO(u domain.User) AdminUserVO {
+	vo := AdminUserVO{
+		UserProfileVO: newUserProfileVO(u),
+		Status:        u.Status.ToUint8(),
+		WechatOpenID:  u.WechatInfo.OpenID,
+	}
+	if u.Banned() {
+		vo.BanUntil = u.BanUntil.Format(time.DateTime)
+		vo.BanReason = u.BanReason
+	}
+	return vo
+}
+
+func (h *AdminUserHandler) Search(ctx *gin.Context) {
+	var req AdminUserSearchReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 || req.Offset < 0 {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "分页参数不对"})
+		return
+	}
+	q := domain.UserQuery{
+		Id:       req.Id,
+		Email:    req.Email,
+		Phone:    req.Phone,
+		Nickname: req.Nickname,
+	}
+	if req.Phone != "" {
+		// 库里面存的是 E.164 格式，解析不了的就原样查
+		if phone, err := h.phones.Normalize(req.Phone); err == nil {
+			q.Phone = phone
+		}
+	}
+	var err error
+	if req.CtimeStart != "" {
+		q.CtimeStart, err = time.ParseInLocation(time.DateTime, req.CtimeStart, time.Local)
+		if err != nil {
+			ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "时间格式不对"})
+			return
+		}
+	}
+	if req.CtimeEnd != "" {
+		q.CtimeEnd, err = time.ParseInLocation(time.DateTime, req.CtimeEnd, time.Local)
+		if err != nil {
+			ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "时间格式不对"})
+			return
+		}
+	}
+	us, err := h.svc.Search(ctx.Request.Context(), q, req.Offset, req.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	res := make([]AdminUserVO, 0, len(us))
+	for _, u := range us {
+		res = append(res, newAdminUserVO(u))
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "ok", Data: res})
+}
+
+type AdminUserReq struct {
+	Uid int64 `json:"uid"`
+}
+
+func (h *AdminUserHandler) Detail(ctx *gin.Context) {
+	var req AdminUserReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	u, err := h.svc.Profile(ctx.Request.Context(), req.Uid)
+	if err == service.ErrUserNotFound {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "用户不存在"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	roles, err := h.roleSvc.Roles(ctx.Request.Context(), req.Uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	bindings, err := h.svc.OAuth2Bindings(ctx.Request.Context(), req.Uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "ok", Data: AdminUserDetailVO{
+		AdminUserVO: newAdminUserVO(u),
+		Roles:       roles,
+		Bindings:    bindings,
+	}})
+}
+
+type BanReq struct {
+	Uid    int64  `json:"uid"`
+	Reason string `json:"reason"`
+	// Until 格式是 2006-01-02 15:04:05，不传就是永久封禁
+	Until string `json:"until"`
+}
+
+func (h *AdminUserHandler) Ban(ctx *gin.Context) {
+	var req BanReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("claims").(*UserClaims)
+	if req.Uid == uc.Uid {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "不能封禁自己"})
+		return
+	}
+	if req.Reason == "" || utf8.RuneCountInString(req.Reason) > 256 {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "请填写封禁原因"})
+		return
+	}
+	until := domain.BanForever
+	if req.Until != "" {
+		var err error
+		until, err = time.ParseInLocation(time.DateTime, req.Until, time.Local)
+		if err != nil || until.Before(time.Now()) {
+			ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "封禁时间不对"})
+			return
+		}
+	}
+	err := h.svc.Ban(ctx.Request.Context(), req.Uid, until, req.Reason)
+	if err == service.ErrUserNotFound {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "用户不存在"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	zap.L().Info("封禁用户", zap.Int64("operator", uc.Uid), zap.Int64("uid", req.Uid),
+		zap.Time("until", until), zap.String("reason", req.Reason))
+	// 先写 Redis 的标记，中间件下一个请求就能拦住；再下线所有会话，长 token 也换不了新的
+	err = setBanned(ctx, h.cmd, req.Uid, until)
+	if err != nil {
+		zap.L().Error("写入封禁标记失败", zap.Error(err), zap.Int64("uid", req.Uid))
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	err = h.clearAllTokens(ctx, req.Uid)
+	if err != nil {
+		zap.L().Error("封禁之后下线会话失败", zap.Error(err), zap.Int64("uid", req.Uid))
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "ok"})
+}
+
+func (h *AdminUserHandler) Unban(ctx *gin.Context) {
+	var req AdminUserReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("claims").(*UserClaims)
+	err := h.svc.Unban(ctx.Request.Context(), req.Uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	err = clearBanned(ctx, h.cmd, req.Uid)
+	if err != nil {
+		zap.L().Error("删除封禁标记失败", zap.Error(err), zap.Int64("uid", req.Uid))
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	zap.L().Info("解封用户", zap.Int64("operator", uc.Uid), zap.Int64("uid", req.Uid))
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "ok"})
+}
+
+type AdminLoginLogReq struct {
+	Uid     int64  `json:"uid"`
+	Action  string `json:"action"`
+	Method  string `json:"method"`
+	Account string `json:"account"`
+	IP      string `json:"ip"`
+	// OnlyFailed 只看失败的
+	OnlyFailed bool `json:"only_failed"`
+	// Start 和 End 格式是 2006-01-02 15:04:05，左闭右开
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+}
+
+type AdminLoginLogVO struct {
+	LoginLogVO
+	Uid     int64  `json:"uid"`
+	Account string `json:"account"`
+	Ssid    string `json:"ssid"`
+}
+
+// LoginLogs 查询登录审计日志
+func (h *AdminUserHandler) LoginLogs(ctx *gin.Context) {
+	var req AdminLoginLogReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 || req.Offset < 0 {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "分页参数不对"})
+		return
+	}
+	q := domain.LoginLogQuery{
+		Uid:        req.Uid,
+		Action:     domain.LoginAction(req.Action),
+		Method:     req.Method,
+		Account:    req.Account,
+		IP:         req.IP,
+		OnlyFailed: req.OnlyFailed,
+	}
+	var err error
+	if req.Start != "" {
+		q.Start, err = time.ParseInLocation(time.DateTime, req.Start, time.Local)
+		if err != nil {
+			ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "时间格式不对"})
+			return
+		}
+	}
+	if req.End != "" {
+		q.End, err = time.ParseInLocation(time.DateTime, req.End, time.Local)
+		if err != nil {
+			ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "时间格式不对"})
+			return
+		}
+	}
+	ls, err := h.logSvc.Search(ctx.Request.Context(), q, req.Offset, req.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	res := make([]AdminLoginLogVO, 0, len(ls))
+	for _, l := range ls {
+		res = append(res, AdminLoginLogVO{
+			LoginLogVO: newLoginLogVO(l),
+			Uid:        l.Uid,
+			Account:    l.Account,
+			Ssid:       l.Ssid,
+		})
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "ok", Data: res})
+}
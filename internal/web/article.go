@@ -4,7 +4,10 @@ import (
 	"github.com/gin-gonic/gin"
 	intrv1 "github.com/jym0818/webook/api/proto/gen/intr/v1"
 	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/errs"
 	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/pkg/ginx"
+	"github.com/jym0818/webook/pkg/openapi"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 	"net/http"
@@ -28,76 +31,64 @@ func NewArticleHandler(svc service.ArticleService, intrSvc intrv1.InteractiveSer
 
 func (h *ArticleHandler) RegisterRoutes(s *gin.Engine) {
 	g := s.Group("/article")
-	g.POST("/edit", h.Edit)
-	g.POST("/publish", h.Publish)
-	g.POST("/withdraw", h.Withdraw)
-	g.POST("list", h.List)
-	g.GET("/detail/:id", h.Detail)
+	g.POST("/edit", ginx.WrapBodyAndClaims(h.Edit))
+	g.POST("/publish", ginx.WrapBodyAndClaims(h.Publish))
+	g.POST("/withdraw", ginx.WrapBodyAndClaims(h.Withdraw))
+	g.POST("list", ginx.WrapBodyAndClaims(h.List))
+	g.GET("/detail/:id", ginx.WrapClaims(h.Detail))
 
 	pub := g.Group("/pub")
 	//pub.GET("/pub", a.PubList)
-	pub.GET("/:id", h.PubDetail)
+	// 游客也可以看，claims 可能没有，所以不用 WrapClaims
+	pub.GET("/:id", ginx.Wrap(h.PubDetail))
 
-	pub.POST("/like", h.Like)
+	pub.POST("/like", ginx.WrapBodyAndClaims(h.Like))
 
 }
-func (h *ArticleHandler) Edit(c *gin.Context) {
 
-	var req ArticleReq
-	if err := c.Bind(&req); err != nil {
-		return
+func (h *ArticleHandler) Docs() []openapi.Operation {
+	const tag = "文章"
+	return []openapi.Operation{
+		{Method: http.MethodPost, Path: "/article/edit", Summary: "保存草稿，data 是文章 ID", Tag: tag, Request: ArticleReq{}, Response: int64(0)},
+		{Method: http.MethodPost, Path: "/article/publish", Summary: "发表，data 是文章 ID", Tag: tag, Request: ArticleReq{}, Response: int64(0)},
+		{Method: http.MethodPost, Path: "/article/withdraw", Summary: "撤回，变成仅自己可见", Tag: tag, Request: WithdrawReq{}},
+		{Method: http.MethodPost, Path: "/article/list", Summary: "创作者看自己的文章列表", Tag: tag, Request: ListReq{}, Response: []ArticleVO{}},
+		{Method: http.MethodGet, Path: "/article/detail/:id", Summary: "创作者看自己的文章", Tag: tag, Response: ArticleVO{}},
+		{Method: http.MethodGet, Path: "/article/pub/:id", Summary: "读者看文章，游客也可以看", Tag: tag, Response: ArticleVO{}, Public: true},
+		{Method: http.MethodPost, Path: "/article/pub/like", Summary: "点赞或者取消点赞", Tag: tag, Request: LikeReq{}},
 	}
+}
 
-	claims := c.MustGet("claims").(*UserClaims)
-
-	//调用下一层
+// errArticleInternal 文章模块没有登记过的错误都用这个错误码
+var errArticleInternal = Result{Code: errs.ArticleInternalServerError, Msg: "系统错误"}
 
+func (h *ArticleHandler) Edit(c *gin.Context, req ArticleReq, claims *UserClaims) (Result, error) {
 	id, err := h.svc.Save(c.Request.Context(), req.toDomain(claims.Uid))
 	if err != nil {
-		c.JSON(500, Result{Msg: "保存帖子失败"})
-		zap.L().Error("保存帖子失败", zap.Error(err))
-		return
+		return errArticleInternal, err
 	}
-	c.JSON(200, Result{
+	return Result{
 		Msg:  "ok",
 		Data: id,
-	})
+	}, nil
 }
 
-func (h *ArticleHandler) Publish(ctx *gin.Context) {
-	var req ArticleReq
-	if err := ctx.Bind(&req); err != nil {
-		return
-	}
-
-	claims := ctx.MustGet("claims").(*UserClaims)
+func (h *ArticleHandler) Publish(ctx *gin.Context, req ArticleReq, claims *UserClaims) (Result, error) {
 	id, err := h.svc.Publish(ctx.Request.Context(), req.toDomain(claims.Uid))
-
 	if err != nil {
-		ctx.JSON(http.StatusOK, Result{
-			Code: 5,
-			Msg:  "系统错误",
-		})
-		// 打日志？
-		zap.L().Error("发布失败", zap.Error(err))
-		return
+		return errArticleInternal, err
 	}
-	ctx.JSON(http.StatusOK, Result{
+	return Result{
 		Msg:  "OK",
 		Data: id,
-	})
+	}, nil
+}
 
+type WithdrawReq struct {
+	Id int64 `binding:"gt=0"`
 }
 
-func (h *ArticleHandler) Withdraw(ctx *gin.Context) {
-	type Req struct {
-		Id int64
-	}
-	var req Req
-	if err := ctx.Bind(&req); err != nil {
-		return
-	}
-	claims := ctx.MustGet("claims").(*UserClaims)
+func (h *ArticleHandler) Withdraw(ctx *gin.Context, req WithdrawReq, claims *UserClaims) (Result, error) {
 	err := h.svc.Withdraw(ctx.Request.Context(), domain.Article{
 		Id: req.Id,
 		Author: domain.Author{
@@ -105,34 +96,17 @@ func (h *ArticleHandler) Withdraw(ctx *gin.Context) {
 		},
 	})
 	if err != nil {
-		ctx.JSON(http.StatusOK, Result{
-			Code: 5,
-			Msg:  "系统错误",
-		})
-		// 打日志？
-		zap.L().Error("保存帖子失败", zap.Error(err))
-		return
+		return errArticleInternal, err
 	}
-	ctx.JSON(http.StatusOK, Result{
+	return Result{
 		Msg: "OK",
-	})
-
+	}, nil
 }
 
-func (h *ArticleHandler) List(ctx *gin.Context) {
-	var req ListReq
-	if err := ctx.Bind(&req); err != nil {
-		return
-	}
-	claims := ctx.MustGet("claims").(*UserClaims)
+func (h *ArticleHandler) List(ctx *gin.Context, req ListReq, claims *UserClaims) (Result, error) {
 	res, err := h.svc.List(ctx.Request.Context(), claims.Uid, req.Limit, req.Offset)
-
 	if err != nil {
-		ctx.JSON(http.StatusOK, Result{
-			Code: 5,
-			Msg:  "系统错误",
-		})
-		return
+		return errArticleInternal, err
 	}
 	var arts []ArticleVO
 	for _, item := range res {
@@ -145,44 +119,33 @@ func (h *ArticleHandler) List(ctx *gin.Context) {
 			Abstract: item.Abstract(),
 		})
 	}
-	ctx.JSON(http.StatusOK, Result{
+	return Result{
 		Msg:  "OK",
 		Data: arts,
-	})
+	}, nil
 }
 
-func (h *ArticleHandler) Detail(ctx *gin.Context) {
-	idStr := ctx.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+func (h *ArticleHandler) Detail(ctx *gin.Context, claims *UserClaims) (Result, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
 	if err != nil {
-		ctx.JSON(http.StatusOK, Result{
-			Msg: "系统错误",
-		})
+		return Result{Code: errs.ArticleInvalidInput, Msg: "参数错误"}, nil
 	}
-
-	claims := ctx.MustGet("claims").(*UserClaims)
 	art, err := h.svc.GetById(ctx.Request.Context(), id)
 	if err != nil {
-		ctx.JSON(http.StatusOK, Result{
-			Code: 5,
-			Msg:  "系统错误",
-		})
-
-		return
+		return errArticleInternal, err
 	}
 	// 这是不借助数据库查询来判定的方法
 	if art.Author.Id != claims.Uid {
-		ctx.JSON(http.StatusOK, Result{
-			Code: 4,
+		// 如果公司有风控系统，这个时候就要上报这种非法访问的用户了。
+		zap.L().Warn("查看别人的草稿", zap.Int64("uid", claims.Uid), zap.Int64("art_id", id))
+		return Result{
+			Code: errs.ArticleInvalidInput,
 			// 也不需要告诉前端究竟发生了什么
 			Msg: "输入有误",
-		})
-		// 如果公司有风控系统，这个时候就要上报这种非法访问的用户了。
-
-		return
+		}, nil
 	}
 
-	ctx.JSON(http.StatusOK, Result{
+	return Result{
 		Data: ArticleVO{
 			Id:    art.Id,
 			Title: art.Title,
@@ -195,46 +158,40 @@ func (h *ArticleHandler) Detail(ctx *gin.Context) {
 			Ctime: art.Ctime.Format(time.DateTime),
 			Utime: art.Utime.Format(time.DateTime),
 		},
-	})
-
+	}, nil
 }
 
-func (h *ArticleHandler) PubDetail(ctx *gin.Context) {
-	idstr := ctx.Param("id")
-	id, err := strconv.ParseInt(idstr, 10, 64)
+func (h *ArticleHandler) PubDetail(ctx *gin.Context) (Result, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
 	if err != nil {
-		ctx.JSON(http.StatusOK, Result{
-			Code: 4,
-			Msg:  "参数错误",
-		})
-
-		return
+		return Result{Code: errs.ArticleInvalidInput, Msg: "参数错误"}, nil
+	}
+	// 游客也可以看，这个时候 uid 是 0，点赞收藏都是 false
+	var uid int64
+	if uc, ok := ctx.Get("claims"); ok {
+		uid = uc.(*UserClaims).Uid
 	}
-	claims := ctx.MustGet("claims").(*UserClaims)
 	var eg errgroup.Group
 	var art domain.Article
 	eg.Go(func() error {
-		art, err = h.svc.GetPublishedById(ctx.Request.Context(), id, claims.Uid)
-		return err
+		var er error
+		art, er = h.svc.GetPublishedById(ctx.Request.Context(), id, uid)
+		return er
 	})
 	var intr *intrv1.GetResponse
 	eg.Go(func() error {
-		uc := ctx.MustGet("claims").(*UserClaims)
-		intr, err = h.intrSvc.Get(ctx, &intrv1.GetRequest{
-			Uid:   uc.Uid,
+		var er error
+		intr, er = h.intrSvc.Get(ctx, &intrv1.GetRequest{
+			Uid:   uid,
 			Biz:   h.biz,
 			BizId: id,
 		})
-		return err
+		return er
 	})
 	err = eg.Wait()
 	if err != nil {
 		// 代表查询出错了
-		ctx.JSON(http.StatusOK, Result{
-			Code: 5,
-			Msg:  "系统错误",
-		})
-		return
+		return errArticleInternal, err
 	}
 
 	//增加阅读计数
@@ -246,7 +203,7 @@ func (h *ArticleHandler) PubDetail(ctx *gin.Context) {
 	//	}
 	//}()
 
-	ctx.JSON(http.StatusOK, Result{
+	return Result{
 		Data: ArticleVO{
 			Id:      art.Id,
 			Title:   art.Title,
@@ -262,15 +219,10 @@ func (h *ArticleHandler) PubDetail(ctx *gin.Context) {
 			ReadCnt:    intr.GetIntr().GetReadCnt(),
 			CollectCnt: intr.GetIntr().GetCollectCnt(),
 		},
-	})
+	}, nil
 }
 
-func (h *ArticleHandler) Like(ctx *gin.Context) {
-	var req LikeReq
-	if err := ctx.Bind(&req); err != nil {
-		return
-	}
-	claims := ctx.MustGet("claims").(*UserClaims)
+func (h *ArticleHandler) Like(ctx *gin.Context, req LikeReq, claims *UserClaims) (Result, error) {
 	var err error
 	if req.Like {
 		//h.biz, req.Id, claims.Uid
@@ -279,14 +231,9 @@ func (h *ArticleHandler) Like(ctx *gin.Context) {
 		_, err = h.intrSvc.CancelLike(ctx.Request.Context(), &intrv1.CancelLikeRequest{BizId: req.Id, Biz: h.biz, Uid: claims.Uid})
 	}
 	if err != nil {
-		zap.L().Error("点赞错误", zap.Error(err))
-		ctx.JSON(http.StatusOK, Result{
-			Msg: "系统错误",
-		})
-		return
+		return errArticleInternal, err
 	}
-	ctx.JSON(http.StatusOK, Result{
+	return Result{
 		Msg: "OK",
-	})
-
+	}, nil
 }
@@ -28,14 +28,14 @@ type ArticleVO struct {
 }
 
 type LikeReq struct {
-	Id int64 `json:"id"`
+	Id int64 `json:"id" binding:"gt=0"`
 	// 点赞和取消点赞，我都准备复用这个
 	Like bool `json:"like"`
 }
 
 type ListReq struct {
-	Limit  int `json:"limit"`
-	Offset int `json:"offset"`
+	Limit  int `json:"limit" binding:"min=1,max=100"`
+	Offset int `json:"offset" binding:"min=0"`
 }
 
 func (req ArticleReq) toDomain(uid int64) domain.Article {
@@ -50,7 +50,8 @@ func (req ArticleReq) toDomain(uid int64) domain.Article {
 }
 
 type ArticleReq struct {
-	Id      int64  `json:"id"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	Id    int64  `json:"id" binding:"min=0"`
+	Title string `json:"title" binding:"title"`
+	// 数据库里面是 BLOB，最多 64KB
+	Content string `json:"content" binding:"maxbytes=65535"`
 }
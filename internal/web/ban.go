@@ -0,0 +1,44 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var ErrUserBanned = errors.New("账号已被封禁")
+
+// CheckBanned 每个请求都会调用，所以只查 Redis。
+// 封禁的时候写进去，过期时间就是封禁结束的时间
+func CheckBanned(ctx context.Context, cmd redis.Cmdable, uid int64) error {
+	cnt, err := cmd.Exists(ctx, bannedKey(uid)).Result()
+	if err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return ErrUserBanned
+	}
+	return nil
+}
+
+func setBanned(ctx context.Context, cmd redis.Cmdable, uid int64, until time.Time) error {
+	var expiration time.Duration
+	if !until.Equal(domain.BanForever) {
+		expiration = time.Until(until)
+		if expiration <= 0 {
+			return nil
+		}
+	}
+	return cmd.Set(ctx, bannedKey(uid), "", expiration).Err()
+}
+
+func clearBanned(ctx context.Context, cmd redis.Cmdable, uid int64) error {
+	return cmd.Del(ctx, bannedKey(uid)).Err()
+}
+
+func bannedKey(uid int64) string {
+	return fmt.Sprintf("user:banned:%d", uid)
+}
@@ -0,0 +1,48 @@
+package web
+
+import (
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"github.com/jym0818/webook/internal/errs"
+	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/pkg/openapi"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type CaptchaHandler struct {
+	svc service.CaptchaService
+}
+
+func NewCaptchaHandler(svc service.CaptchaService) *CaptchaHandler {
+	return &CaptchaHandler{svc: svc}
+}
+
+func (h *CaptchaHandler) RegisterRoutes(s *gin.Engine) {
+	s.GET("/captcha", h.New)
+}
+
+func (h *CaptchaHandler) Docs() []openapi.Operation {
+	return []openapi.Operation{
+		{Method: http.MethodGet, Path: "/captcha", Summary: "获取图形验证码", Tag: "用户", Response: CaptchaVO{}, Public: true},
+	}
+}
+
+type CaptchaVO struct {
+	Id string `json:"id"`
+	// Image data URL，可以直接放到 img 标签的 src 里面
+	Image string `json:"image"`
+}
+
+func (h *CaptchaHandler) New(ctx *gin.Context) {
+	c, err := h.svc.Generate(ctx.Request.Context())
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("生成图形验证码失败", zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "ok", Data: CaptchaVO{
+		Id:    c.Id,
+		Image: "data:image/png;base64," + base64.StdEncoding.EncodeToString(c.Image),
+	}})
+}
@@ -0,0 +1,37 @@
+package web
+
+import (
+	"github.com/jym0818/webook/internal/errs"
+	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/internal/service/oauth2"
+	"github.com/jym0818/webook/pkg/ginx"
+	"net/http"
+)
+
+// errUserInternal 用户模块没有登记过的错误都用这个错误码
+var errUserInternal = Result{Code: errs.UserInternalServerError, Msg: "系统错误"}
+
+// 用 ginx 包装的 handler 直接返回 service 的错误，在这里统一转成错误码。
+// ErrIdentityConflict 这种要带上 Data 的，还是在 handler 里面自己处理
+func init() {
+	ginx.SetInternalError(ginx.NewError(errs.InternalServerError, "系统错误"))
+
+	ginx.RegisterError(service.ErrUserDuplicateEmail, ginx.NewError(errs.UserInvalidInput, "邮箱冲突"))
+	ginx.RegisterError(service.ErrInvalidUserOrPassword, ginx.NewError(errs.UserInvalidOrPassword, "用户名或者密码不对"))
+	ginx.RegisterError(service.ErrUserNotActivated, ginx.NewError(errs.UserNotActivated, "账号未激活，请先完成邮箱验证"))
+	ginx.RegisterError(service.ErrLastLoginMethod, ginx.NewError(errs.UserLastLoginMethod, "至少要保留一种登录方式"))
+	ginx.RegisterError(service.ErrUserDeleted, ginx.NewError(errs.UserDeleted, "账号已注销"))
+	ginx.RegisterError(service.ErrUserBanned, ginx.NewError(errs.UserBanned, "账号已被封禁"))
+	ginx.RegisterError(ErrUserBanned, ginx.NewError(errs.UserBanned, "账号已被封禁"))
+	ginx.RegisterError(ErrSessionRevoked, ginx.NewError(errs.UserInvalidInput, "登录已经失效").WithStatus(http.StatusUnauthorized))
+	ginx.RegisterError(service.ErrUnknownRole, ginx.NewError(errs.UserInvalidInput, "未定义的角色"))
+
+	ginx.RegisterError(service.ErrCodeSendTooMany, ginx.NewError(errs.UserInvalidInput, "发送太频繁，请稍后再试"))
+	ginx.RegisterError(service.ErrCodeVerifyTooManyTimes, ginx.NewError(errs.UserInvalidInput, "验证次数太多，请重新获取验证码"))
+
+	ginx.RegisterError(service.ErrInvalidMFACode, ginx.NewError(errs.UserInvalidInput, "验证码错误"))
+	ginx.RegisterError(service.ErrMFANotEnrolled, ginx.NewError(errs.UserInvalidInput, "没有开启两步验证"))
+	ginx.RegisterError(service.ErrMFAAlreadyEnabled, ginx.NewError(errs.UserInvalidInput, "已经开启了两步验证"))
+
+	ginx.RegisterError(oauth2.ErrProviderNotFound, ginx.NewError(errs.UserInvalidInput, "不支持的登录方式"))
+}
@@ -0,0 +1,33 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jym0818/webook/pkg/openapi"
+	"net/http"
+)
+
+// JWKSHandler 公开短 token 的公钥，别的服务可以自己校验 token，不需要共享密钥
+type JWKSHandler struct {
+	keys JWTKeyrings
+}
+
+func NewJWKSHandler(keys JWTKeyrings) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+func (h *JWKSHandler) RegisterRoutes(s *gin.Engine) {
+	s.GET("/.well-known/jwks.json", h.JWKS)
+}
+
+func (h *JWKSHandler) Docs() []openapi.Operation {
+	return []openapi.Operation{
+		// 这个接口是 RFC 7517 的格式，不是 Result
+		{Method: http.MethodGet, Path: "/.well-known/jwks.json", Summary: "校验短 token 用的公钥", Tag: "用户", Public: true},
+	}
+}
+
+func (h *JWKSHandler) JWKS(ctx *gin.Context) {
+	// 轮换密钥要等缓存过期，不要设置太长
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, h.keys.Access.JWKS())
+}
@@ -1,40 +1,98 @@
 package web
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/pkg/jwtx"
+	"github.com/redis/go-redis/v9"
+	"slices"
 	"strings"
 	"time"
 )
 
+// AtKey 和 RtKey 是引入 kid 之前用的 HMAC 密钥，
+// 没有配置非对称密钥的开发环境继续用它们
 var (
 	AtKey = []byte("95osj3fUD7fo0mlYdDbncXz4VD2igvf0")
 	RtKey = []byte("95osj3fUD7fo0mlYdDbncXz4VD2igvfx")
 )
 
-type jwtHandler struct{}
+// JWTKeyrings 长短 token 用不同的密钥，只有短 token 的公钥会通过 JWKS 公开
+type JWTKeyrings struct {
+	Access  *jwtx.Keyring
+	Refresh *jwtx.Keyring
+}
+
+var ErrSessionRevoked = errors.New("登录已经失效")
+
+// errRefreshTokenReused 长 token 已经换过一次了又被拿来用，大概率是被偷了
+var errRefreshTokenReused = errors.New("长 token 被重复使用")
+
+// refreshExpiration 长 token 的过期时间，退出登录的 ssid 也至少要保留这么久
+const refreshExpiration = time.Hour * 24 * 7
+
+type jwtHandler struct {
+	cmd  redis.Cmdable
+	keys JWTKeyrings
+	// roleSvc 角色放到短 token 里面，刷新的时候重新查，所以改了角色最多三十分钟生效
+	roleSvc service.RoleService
+	logSvc  service.LoginLogService
+	binder  *SessionBinder
+}
 
-func (h jwtHandler) setJWT(c *gin.Context, uid int64) error {
+func newJWTHandler(cmd redis.Cmdable, keys JWTKeyrings, roleSvc service.RoleService,
+	logSvc service.LoginLogService, binder *SessionBinder) jwtHandler {
+	return jwtHandler{cmd: cmd, keys: keys, roleSvc: roleSvc, logSvc: logSvc, binder: binder}
+}
+
+// setJWT 登录成功之后调用，返回新会话的 ssid
+func (h jwtHandler) setJWT(c *gin.Context, uid int64) (string, error) {
 	ssid := uuid.New().String()
-	err := h.setJWTToken(c, uid, ssid)
+	err := h.recordSession(c, uid, ssid)
 	if err != nil {
-		return err
+		return "", err
+	}
+	err = h.setJWTToken(c, uid, ssid)
+	if err != nil {
+		return "", err
 	}
-	return h.setRefreshToken(c, uid, ssid)
+	return ssid, h.setRefreshToken(c, uid, ssid)
 }
 
-func (h jwtHandler) setJWTToken(c *gin.Context, uid int64, uuid string) error {
+// clearToken 让某一个 ssid 失效
+func (h jwtHandler) clearToken(ctx context.Context, ssid string) error {
+	return h.cmd.Set(ctx, ssidKey(ssid), "", refreshExpiration).Err()
+}
+
+// ssidKey 已经失效的 ssid
+func ssidKey(ssid string) string {
+	return fmt.Sprintf("user:ssid:%s", ssid)
+}
+
+func (h jwtHandler) setJWTToken(c *gin.Context, uid int64, ssid string) error {
+	roles, err := h.roleSvc.Roles(c.Request.Context(), uid)
+	if err != nil {
+		return err
+	}
 	claims := UserClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 30)),
 		},
-		Uid:       uid,
-		Ssid:      uuid,
-		UserAgent: c.Request.UserAgent(),
+		Uid:     uid,
+		Ssid:    ssid,
+		Binding: h.binder.Fingerprint(c),
+		Perms:   domain.Permissions(roles),
+	}
+	for _, r := range roles {
+		claims.Roles = append(claims.Roles, string(r))
 	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
-	token, err := t.SignedString(AtKey)
+	token, err := h.keys.Access.Sign(claims)
 	if err != nil {
 		return err
 	}
@@ -42,16 +100,17 @@ func (h jwtHandler) setJWTToken(c *gin.Context, uid int64, uuid string) error {
 	return nil
 }
 
-func (h jwtHandler) setRefreshToken(c *gin.Context, uid int64, uuid string) error {
+func (h jwtHandler) setRefreshToken(c *gin.Context, uid int64, ssid string) error {
 	claims := RefreshClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * 7)),
+			// 每个长 token 都有唯一的 jti，用过一次就作废
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(refreshExpiration)),
 		},
 		Uid:  uid,
-		Ssid: uuid,
+		Ssid: ssid,
 	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
-	token, err := t.SignedString(RtKey)
+	token, err := h.keys.Refresh.Sign(claims)
 	if err != nil {
 		return err
 	}
@@ -59,6 +118,42 @@ func (h jwtHandler) setRefreshToken(c *gin.Context, uid int64, uuid string) erro
 	return nil
 }
 
+// consumeRefreshToken 每个长 token 只能用一次。
+// 用过的 jti 记下来，一直保留到这个 token 过期
+func (h jwtHandler) consumeRefreshToken(ctx context.Context, claims *RefreshClaims) error {
+	ttl := refreshExpiration
+	if claims.ExpiresAt != nil {
+		ttl = time.Until(claims.ExpiresAt.Time)
+	}
+	if ttl <= 0 {
+		return errRefreshTokenReused
+	}
+	ok, err := h.cmd.SetNX(ctx, consumedJtiKey(claims.ID), claims.Ssid, ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errRefreshTokenReused
+	}
+	return nil
+}
+
+func consumedJtiKey(jti string) string {
+	return fmt.Sprintf("user:rt:consumed:%s", jti)
+}
+
+// CheckSession 校验 ssid 是否已经失效
+func CheckSession(ctx context.Context, cmd redis.Cmdable, ssid string) error {
+	cnt, err := cmd.Exists(ctx, ssidKey(ssid)).Result()
+	if err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
 func ExtractToken(ctx *gin.Context) string {
 	t := ctx.GetHeader("Authorization")
 
@@ -72,9 +167,17 @@ func ExtractToken(ctx *gin.Context) string {
 
 type UserClaims struct {
 	jwt.RegisteredClaims
-	Uid       int64
-	UserAgent string
-	Ssid      string
+	Uid  int64
+	Ssid string
+	// Binding 签发时候的绑定指纹，规则见 BindingPolicy
+	Binding string   `json:",omitempty"`
+	Roles   []string `json:",omitempty"`
+	// Perms 签发的时候就把角色展开成权限，校验的服务不需要知道角色的定义
+	Perms []string `json:",omitempty"`
+}
+
+func (c *UserClaims) HasPermission(perm string) bool {
+	return slices.Contains(c.Perms, perm)
 }
 
 type RefreshClaims struct {
@@ -0,0 +1,122 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jym0818/webook/internal/errs"
+	"github.com/jym0818/webook/pkg/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// LoginGuard 防暴力破解。同时按照账号和 IP 统计失败次数，
+// 账号维度防止有人盯着一个账号猜密码，IP 维度防止撞库
+type LoginGuard struct {
+	account ratelimit.Lockout
+	ip      ratelimit.Lockout
+
+	failures *prometheus.CounterVec
+	lockouts *prometheus.CounterVec
+}
+
+func NewLoginGuard(account ratelimit.Lockout, ip ratelimit.Lockout) *LoginGuard {
+	failures := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "jym",
+		Subsystem: "webook",
+		Name:      "login_failure_total",
+		Help:      "登录失败次数",
+	}, []string{"method"})
+	lockouts := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "jym",
+		Subsystem: "webook",
+		Name:      "login_lockout_total",
+		Help:      "登录失败太多被锁定的次数，突然变多说明有人在撞库",
+	}, []string{"method", "dimension"})
+	prometheus.MustRegister(failures, lockouts)
+	return &LoginGuard{
+		account:  account,
+		ip:       ip,
+		failures: failures,
+		lockouts: lockouts,
+	}
+}
+
+// check 被锁定的时候已经写好了响应，返回 false
+func (g *LoginGuard) check(ctx *gin.Context, method, account string) bool {
+	remain, err := g.locked(ctx, method, account, ctx.ClientIP())
+	if err != nil {
+		// Redis 出问题的时候不能让所有人都登录不了
+		zap.L().Error("查询登录锁定状态失败", zap.Error(err))
+		return true
+	}
+	if remain > 0 {
+		g.abort(ctx, remain)
+		return false
+	}
+	return true
+}
+
+func (g *LoginGuard) locked(ctx context.Context, method, account, ip string) (time.Duration, error) {
+	remain, err := g.account.Locked(ctx, g.accountKey(method, account))
+	if err != nil || remain > 0 {
+		return remain, err
+	}
+	return g.ip.Locked(ctx, g.ipKey(ip))
+}
+
+// fail 记录一次失败。这一次失败触发了锁定的话，已经写好了响应，返回 false
+func (g *LoginGuard) fail(ctx *gin.Context, method, account string) bool {
+	g.failures.WithLabelValues(method).Inc()
+	ip := ctx.ClientIP()
+	accLock, err := g.account.Fail(ctx, g.accountKey(method, account))
+	if err != nil {
+		zap.L().Error("记录登录失败次数出错", zap.Error(err))
+	}
+	if accLock > 0 {
+		g.lockouts.WithLabelValues(method, "account").Inc()
+		zap.L().Warn("账号登录失败太多，被锁定", zap.String("method", method),
+			zap.String("account", account), zap.String("ip", ip), zap.Duration("lock", accLock))
+	}
+	ipLock, err := g.ip.Fail(ctx, g.ipKey(ip))
+	if err != nil {
+		zap.L().Error("记录登录失败次数出错", zap.Error(err))
+	}
+	if ipLock > 0 {
+		g.lockouts.WithLabelValues(method, "ip").Inc()
+		zap.L().Warn("IP 登录失败太多，被锁定", zap.String("method", method),
+			zap.String("ip", ip), zap.Duration("lock", ipLock))
+	}
+	lock := max(accLock, ipLock)
+	if lock > 0 {
+		g.abort(ctx, lock)
+		return false
+	}
+	return true
+}
+
+// success 登录成功清空账号的失败次数，IP 的不清，不然撞库的人只要混进一个自己的账号就可以绕过去
+func (g *LoginGuard) success(ctx *gin.Context, method, account string) {
+	err := g.account.Reset(ctx, g.accountKey(method, account))
+	if err != nil {
+		zap.L().Error("清空登录失败次数出错", zap.Error(err))
+	}
+}
+
+func (g *LoginGuard) abort(ctx *gin.Context, remain time.Duration) {
+	minutes := int(remain.Minutes()) + 1
+	ctx.JSON(http.StatusOK, Result{
+		Code: errs.UserLoginLocked,
+		Msg:  fmt.Sprintf("尝试次数太多，请 %d 分钟后再试", minutes),
+	})
+}
+
+func (g *LoginGuard) accountKey(method, account string) string {
+	return fmt.Sprintf("login_lockout:%s:%s", method, account)
+}
+
+func (g *LoginGuard) ipKey(ip string) string {
+	return fmt.Sprintf("login_lockout:ip:%s", ip)
+}
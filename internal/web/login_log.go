@@ -0,0 +1,69 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/errs"
+	"github.com/jym0818/webook/pkg/ginx"
+	"net/http"
+	"time"
+)
+
+// newLoginLog 在 handler 开头创建，配合 defer h.audit 使用，每个分支返回之前设置好 Code
+func (h jwtHandler) newLoginLog(ctx *gin.Context, action domain.LoginAction, method string) *domain.LoginLog {
+	return &domain.LoginLog{
+		Action:    action,
+		Method:    method,
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+		Ctime:     time.Now(),
+	}
+}
+
+// audit 写登录审计日志，是异步的
+func (h jwtHandler) audit(ctx *gin.Context, l *domain.LoginLog) {
+	l.Success = l.Code == errs.Success
+	h.logSvc.Record(ctx.Request.Context(), *l)
+}
+
+type LoginLogVO struct {
+	Action    string `json:"action"`
+	Method    string `json:"method"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Success   bool   `json:"success"`
+	Code      int    `json:"code"`
+	Ctime     string `json:"ctime"`
+}
+
+func newLoginLogVO(l domain.LoginLog) LoginLogVO {
+	return LoginLogVO{
+		Action:    string(l.Action),
+		Method:    l.Method,
+		IP:        l.IP,
+		UserAgent: l.UserAgent,
+		Success:   l.Success,
+		Code:      l.Code,
+		Ctime:     l.Ctime.Format(time.DateTime),
+	}
+}
+
+// LoginLogs 查看自己的登录历史
+func (h *UserHandler) LoginLogs(ctx *gin.Context) {
+	var req ListReq
+	// 分页参数的校验在 ListReq 的 binding 标签里面
+	if !ginx.Bind(ctx, &req) {
+		return
+	}
+	uc := ctx.MustGet("claims").(*UserClaims)
+	ls, err := h.logSvc.List(ctx.Request.Context(), uc.Uid, req.Offset, req.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	res := make([]LoginLogVO, 0, len(ls))
+	for _, l := range ls {
+		res = append(res, newLoginLogVO(l))
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "ok", Data: res})
+}
@@ -0,0 +1,54 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var errMergeTicketInvalid = errors.New("合并凭证无效")
+
+// mergeTicket 绑定的时候发现登录方式属于另外一个账号，说明用户同时拥有两个账号，
+// 这时候发一个凭证，用户确认之后用它来合并账号
+type mergeTicket struct {
+	From int64
+	To   int64
+}
+
+func newMergeTicket(ctx context.Context, cmd redis.Cmdable, from, to int64) (string, error) {
+	ticket := uuid.New().String()
+	val, err := json.Marshal(mergeTicket{From: from, To: to})
+	if err != nil {
+		return "", err
+	}
+	err = cmd.Set(ctx, mergeTicketKey(ticket), val, time.Minute*10).Err()
+	return ticket, err
+}
+
+// consumeMergeTicket 凭证只能用一次，并且只能由 To 账号使用
+func consumeMergeTicket(ctx context.Context, cmd redis.Cmdable, ticket string, uid int64) (mergeTicket, error) {
+	val, err := cmd.GetDel(ctx, mergeTicketKey(ticket)).Bytes()
+	if err == redis.Nil {
+		return mergeTicket{}, errMergeTicketInvalid
+	}
+	if err != nil {
+		return mergeTicket{}, err
+	}
+	var res mergeTicket
+	err = json.Unmarshal(val, &res)
+	if err != nil {
+		return mergeTicket{}, err
+	}
+	if res.To != uid {
+		return mergeTicket{}, errMergeTicketInvalid
+	}
+	return res, nil
+}
+
+func mergeTicketKey(ticket string) string {
+	return fmt.Sprintf("user:merge_ticket:%s", ticket)
+}
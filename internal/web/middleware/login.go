@@ -1,63 +1,131 @@
 package middleware
 
 import (
-	"fmt"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/jym0818/webook/internal/errs"
 	"github.com/jym0818/webook/internal/web"
+	"github.com/jym0818/webook/pkg/jwtx"
 	"github.com/redis/go-redis/v9"
 	"net/http"
 )
 
+var errInvalidToken = errors.New("token 不对")
+
+type authMode int
+
+const (
+	// authIgnore 完全不校验，也不解析 token
+	authIgnore authMode = iota
+	// authOptional 带了合法的 token 就设置 claims，没带或者不合法就当作游客
+	authOptional
+)
+
+type rule struct {
+	match func(path string) bool
+	mode  authMode
+}
+
 type LoginMiddlewareBuilder struct {
-	paths []string
-	cmd   redis.Cmdable
+	rules  []rule
+	cmd    redis.Cmdable
+	keys   *jwtx.Keyring
+	binder *web.SessionBinder
 }
 
-func NewLoginMiddlewareBuilder(cmd redis.Cmdable) *LoginMiddlewareBuilder {
+// NewLoginMiddlewareBuilder keys 是短 token 的密钥
+func NewLoginMiddlewareBuilder(cmd redis.Cmdable, keys *jwtx.Keyring, binder *web.SessionBinder) *LoginMiddlewareBuilder {
 	return &LoginMiddlewareBuilder{
-		cmd: cmd,
+		cmd:    cmd,
+		keys:   keys,
+		binder: binder,
 	}
 }
 
+// IgnorePath 精确匹配
 func (l *LoginMiddlewareBuilder) IgnorePath(path string) *LoginMiddlewareBuilder {
-	l.paths = append(l.paths, path)
+	return l.addRule(exactMatcher(path), authIgnore)
+}
+
+// IgnorePrefix 前缀匹配，比如 /static/
+func (l *LoginMiddlewareBuilder) IgnorePrefix(prefix string) *LoginMiddlewareBuilder {
+	return l.addRule(prefixMatcher(prefix), authIgnore)
+}
+
+// IgnorePattern 和注册路由一样的写法，比如 /oauth2/:provider/callback，
+// 也支持 path.Match 的通配符，比如 /static/*.png，规则见 patternMatcher
+func (l *LoginMiddlewareBuilder) IgnorePattern(pattern string) *LoginMiddlewareBuilder {
+	return l.addRule(patternMatcher(pattern), authIgnore)
+}
+
+// OptionalPattern 游客也可以访问，登录了的用户可以拿到 claims。
+// handler 里面要用 ctx.Get("claims") 判断，不能用 MustGet
+func (l *LoginMiddlewareBuilder) OptionalPattern(pattern string) *LoginMiddlewareBuilder {
+	return l.addRule(patternMatcher(pattern), authOptional)
+}
+
+func (l *LoginMiddlewareBuilder) addRule(match func(path string) bool, mode authMode) *LoginMiddlewareBuilder {
+	l.rules = append(l.rules, rule{match: match, mode: mode})
 	return l
 }
 
 func (l *LoginMiddlewareBuilder) Build() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		for _, path := range l.paths {
-			if ctx.Request.URL.Path == path {
+		optional := false
+		for _, r := range l.rules {
+			if !r.match(ctx.Request.URL.Path) {
+				continue
+			}
+			if r.mode == authIgnore {
 				return
 			}
+			optional = true
+			break
 		}
 
-		t := web.ExtractToken(ctx)
-		claims := &web.UserClaims{}
-		token, err := jwt.ParseWithClaims(t, claims, func(token *jwt.Token) (interface{}, error) {
-			return web.AtKey, nil
-		})
-		if err != nil {
-			ctx.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
-		if token == nil || !token.Valid || claims.Uid == 0 {
-			ctx.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
-
-		if claims.UserAgent != ctx.Request.UserAgent() {
-			//记录日志
-			ctx.AbortWithStatus(http.StatusUnauthorized)
+		if optional && web.ExtractToken(ctx) == "" {
 			return
 		}
-		logout, err := l.cmd.Exists(ctx, fmt.Sprintf("users:ssid:%s", claims.Ssid)).Result()
-		if logout > 0 || err != nil {
+		claims, err := l.parse(ctx)
+		if err != nil {
+			if optional {
+				// 游客模式下 token 过期、被封禁这些都当作没有登录
+				return
+			}
+			if err == web.ErrUserBanned {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, web.Result{Code: errs.UserBanned, Msg: "账号已被封禁"})
+				return
+			}
 			ctx.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
 		ctx.Set("claims", claims)
+	}
+}
 
+func (l *LoginMiddlewareBuilder) parse(ctx *gin.Context) (*web.UserClaims, error) {
+	t := web.ExtractToken(ctx)
+	claims := &web.UserClaims{}
+	token, err := jwt.ParseWithClaims(t, claims, l.keys.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || !token.Valid || claims.Uid == 0 {
+		return nil, errInvalidToken
+	}
+
+	if !l.binder.Check(ctx, claims) {
+		return nil, errInvalidToken
+	}
+	err = web.CheckSession(ctx, l.cmd, claims.Ssid)
+	if err != nil {
+		return nil, err
+	}
+	// 封禁的时候会下线所有会话，这里再查一次是为了 Redis 里面没有记录的老会话
+	err = web.CheckBanned(ctx, l.cmd, claims.Uid)
+	if err != nil {
+		return nil, err
 	}
+	return claims, nil
 }
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"path"
+	"strings"
+)
+
+func exactMatcher(p string) func(string) bool {
+	return func(s string) bool {
+		return s == p
+	}
+}
+
+func prefixMatcher(prefix string) func(string) bool {
+	return func(s string) bool {
+		return strings.HasPrefix(s, prefix)
+	}
+}
+
+// patternMatcher 按 / 分段匹配：
+//   - :name 匹配任意一段，和 gin 的路由参数一样
+//   - *name 只能放在最后，匹配剩下的所有段，可以是空的，和 gin 的 catch-all 一样
+//   - 其他的段用 path.Match，所以 * 匹配一段里面的任意字符，但是不会跨过 /
+func patternMatcher(pattern string) func(string) bool {
+	segs := strings.Split(strings.Trim(pattern, "/"), "/")
+	return func(s string) bool {
+		parts := strings.Split(strings.Trim(s, "/"), "/")
+		for i, seg := range segs {
+			if i == len(segs)-1 && isCatchAll(seg) {
+				return len(parts) >= i
+			}
+			if i >= len(parts) {
+				return false
+			}
+			if strings.HasPrefix(seg, ":") {
+				if parts[i] == "" {
+					return false
+				}
+				continue
+			}
+			ok, err := path.Match(seg, parts[i])
+			if err != nil || !ok {
+				return false
+			}
+		}
+		return len(parts) == len(segs)
+	}
+}
+
+// isCatchAll *filepath 是 catch-all，*.png 是通配符
+func isCatchAll(seg string) bool {
+	if len(seg) < 2 || seg[0] != '*' {
+		return false
+	}
+	for _, c := range seg[1:] {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,213 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/errs"
+	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/internal/service/oauth2"
+	"github.com/jym0818/webook/pkg/openapi"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// OAuth2Handler 微信之外的第三方登录，路由里面的 :provider 就是 oauth2.Provider 的 Name
+type OAuth2Handler struct {
+	providers oauth2.Providers
+	userSvc   service.UserService
+	jwtHandler
+	states *OAuth2StateStore
+}
+
+func NewOAuth2Handler(providers oauth2.Providers, userSvc service.UserService, roleSvc service.RoleService,
+	logSvc service.LoginLogService, states *OAuth2StateStore, cmd redis.Cmdable, keys JWTKeyrings,
+	binder *SessionBinder) *OAuth2Handler {
+	return &OAuth2Handler{
+		providers:  providers,
+		userSvc:    userSvc,
+		jwtHandler: newJWTHandler(cmd, keys, roleSvc, logSvc, binder),
+		states:     states,
+	}
+}
+
+type OAuth2BindingVO struct {
+	Provider string `json:"provider"`
+	Email    string `json:"email"`
+	Nickname string `json:"nickname"`
+	Ctime    string `json:"ctime"`
+}
+
+func (h *OAuth2Handler) RegisterRoutes(s *gin.Engine) {
+	g := s.Group("/oauth2")
+	g.GET("/bindings", h.Bindings)
+	pg := g.Group("/:provider")
+	pg.GET("/authurl", h.AuthURL)
+	pg.Any("/callback", h.Callback)
+	pg.GET("/bind/authurl", h.BindAuthURL)
+	pg.POST("/unbind", h.Unbind)
+}
+
+func (h *OAuth2Handler) Docs() []openapi.Operation {
+	const tag = "第三方登录"
+	return []openapi.Operation{
+		{Method: http.MethodGet, Path: "/oauth2/bindings", Summary: "绑定了的第三方账号", Tag: tag, Response: []OAuth2BindingVO{}},
+		{Method: http.MethodGet, Path: "/oauth2/:provider/authurl", Summary: "第三方登录的地址", Tag: tag, Response: "", Public: true},
+		{Method: openapi.Any, Path: "/oauth2/:provider/callback", Summary: "第三方回调，登录成功之后 token 在响应头里面", Tag: tag, Public: true},
+		{Method: http.MethodGet, Path: "/oauth2/:provider/bind/authurl", Summary: "已经登录的用户绑定第三方账号", Tag: tag, Response: ""},
+		{Method: http.MethodPost, Path: "/oauth2/:provider/unbind", Summary: "解绑第三方账号", Tag: tag},
+	}
+}
+
+func (h *OAuth2Handler) AuthURL(ctx *gin.Context) {
+	h.authURL(ctx, 0)
+}
+
+func (h *OAuth2Handler) BindAuthURL(ctx *gin.Context) {
+	uc := ctx.MustGet("claims").(*UserClaims)
+	h.authURL(ctx, uc.Uid)
+}
+
+func (h *OAuth2Handler) authURL(ctx *gin.Context, uid int64) {
+	p, ok := h.provider(ctx)
+	if !ok {
+		return
+	}
+	state, err := h.states.Create(ctx, h.callbackPath(p), uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	url, err := p.AuthURL(ctx.Request.Context(), state)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "构造登录URL失败"})
+		zap.L().Error("构造第三方登录URL失败", zap.Error(err), zap.String("provider", p.Name()))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "ok", Data: url})
+}
+
+func (h *OAuth2Handler) Callback(ctx *gin.Context) {
+	p, ok := h.provider(ctx)
+	if !ok {
+		return
+	}
+	lg := h.newLoginLog(ctx, domain.LoginActionLogin, p.Name())
+	binding := false
+	defer func() {
+		// 绑定不算登录，不写审计日志
+		if !binding {
+			h.audit(ctx, lg)
+		}
+	}()
+	uid, err := h.states.Verify(ctx, h.callbackPath(p))
+	if err != nil && err != errInvalidState {
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("校验第三方登录 state 失败", zap.Error(err), zap.String("provider", p.Name()))
+		return
+	}
+	if err != nil {
+		lg.Code = errs.UserInvalidInput
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "登录失败"})
+		return
+	}
+	token, err := p.Exchange(ctx.Request.Context(), ctx.Query("code"))
+	if err != nil {
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("第三方登录换 token 失败", zap.Error(err), zap.String("provider", p.Name()))
+		return
+	}
+	info, err := p.UserInfo(ctx.Request.Context(), token)
+	if err != nil {
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("获取第三方用户信息失败", zap.Error(err), zap.String("provider", p.Name()))
+		return
+	}
+	if uid > 0 {
+		binding = true
+		owner, er := h.userSvc.BindOAuth2(ctx.Request.Context(), uid, info)
+		handleBindErr(ctx, h.cmd, uid, owner, er)
+		return
+	}
+	u, err := h.userSvc.FindOrCreateByOAuth2(ctx.Request.Context(), info)
+	if err == service.ErrUserDeleted {
+		lg.Code = errs.UserDeleted
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserDeleted, Msg: "账号已注销"})
+		return
+	}
+	if err == service.ErrUserBanned {
+		lg.Code = errs.UserBanned
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserBanned, Msg: "账号已被封禁"})
+		return
+	}
+	if err != nil {
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("第三方登录失败", zap.Error(err), zap.String("provider", p.Name()))
+		return
+	}
+	lg.Uid = u.Id
+	lg.Ssid, err = h.setJWT(ctx, u.Id)
+	if err != nil {
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	lg.Code = errs.Success
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "登录成功"})
+}
+
+func (h *OAuth2Handler) Unbind(ctx *gin.Context) {
+	p, ok := h.provider(ctx)
+	if !ok {
+		return
+	}
+	uc := ctx.MustGet("claims").(*UserClaims)
+	err := h.userSvc.UnbindOAuth2(ctx.Request.Context(), uc.Uid, p.Name())
+	switch err {
+	case nil:
+		ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "解绑成功"})
+	case service.ErrLastLoginMethod:
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserLastLoginMethod, Msg: "至少要保留一种登录方式"})
+	default:
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("解绑第三方登录失败", zap.Error(err), zap.Int64("uid", uc.Uid))
+	}
+}
+
+func (h *OAuth2Handler) Bindings(ctx *gin.Context) {
+	uc := ctx.MustGet("claims").(*UserClaims)
+	bs, err := h.userSvc.OAuth2Bindings(ctx.Request.Context(), uc.Uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	res := make([]OAuth2BindingVO, 0, len(bs))
+	for _, b := range bs {
+		res = append(res, OAuth2BindingVO{
+			Provider: b.Provider,
+			Email:    b.Email,
+			Nickname: b.Nickname,
+			Ctime:    b.Ctime.Format(time.DateTime),
+		})
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "ok", Data: res})
+}
+
+// provider 不支持的时候已经写好了响应
+func (h *OAuth2Handler) provider(ctx *gin.Context) (oauth2.Provider, bool) {
+	p, err := h.providers.Get(ctx.Param("provider"))
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "不支持的登录方式"})
+		return nil, false
+	}
+	return p, true
+}
+
+func (h *OAuth2Handler) callbackPath(p oauth2.Provider) string {
+	return "/oauth2/" + p.Name() + "/callback"
+}
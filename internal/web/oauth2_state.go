@@ -0,0 +1,62 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	uuid "github.com/lithammer/shortuuid/v4"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const stateCookieName = "oauth2-state"
+
+// stateExpiration 用户在第三方平台上授权的时间，第一次授权要确认权限，不能太短
+const stateExpiration = time.Minute * 10
+
+var errInvalidState = errors.New("state 校验失败")
+
+// OAuth2StateStore 微信和别的第三方登录共用。state 是随机数，
+// 要绑定到哪个账号只记在 redis 里面，不会交给浏览器，回调的时候取出来就删掉，只能用一次
+type OAuth2StateStore struct {
+	cmd    redis.Cmdable
+	secure bool
+}
+
+func NewOAuth2StateStore(cmd redis.Cmdable, cfg Config) *OAuth2StateStore {
+	return &OAuth2StateStore{cmd: cmd, secure: cfg.Secure}
+}
+
+// Create 生成 state，同时放到 cookie 里面，回调的时候用来防 CSRF。
+// uid 不为 0 的时候是已经登录的用户在绑定第三方账号
+func (s *OAuth2StateStore) Create(ctx *gin.Context, callbackPath string, uid int64) (string, error) {
+	state := uuid.New()
+	err := s.cmd.Set(ctx.Request.Context(), s.key(callbackPath, state), uid, stateExpiration).Err()
+	if err != nil {
+		return "", err
+	}
+	ctx.SetCookie(stateCookieName, state, int(stateExpiration.Seconds()),
+		callbackPath, "", s.secure, true)
+	return state, nil
+}
+
+// Verify 校验回调里面的 state，返回 Create 的时候传的 uid
+func (s *OAuth2StateStore) Verify(ctx *gin.Context, callbackPath string) (int64, error) {
+	state := ctx.Query("state")
+	ck, err := ctx.Cookie(stateCookieName)
+	if err != nil || state == "" || ck != state {
+		return 0, errInvalidState
+	}
+	// 不管后面成功没有，这个 state 都不能再用了
+	ctx.SetCookie(stateCookieName, "", -1, callbackPath, "", s.secure, true)
+	uid, err := s.cmd.GetDel(ctx.Request.Context(), s.key(callbackPath, state)).Int64()
+	if err == redis.Nil {
+		// 过期了，或者已经用过了
+		return 0, errInvalidState
+	}
+	return uid, err
+}
+
+func (s *OAuth2StateStore) key(callbackPath string, state string) string {
+	return fmt.Sprintf("oauth2:state:%s:%s", callbackPath, state)
+}
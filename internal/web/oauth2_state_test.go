@@ -0,0 +1,117 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// memRedis 只实现了用到的命令，别的命令调用了会 panic
+type memRedis struct {
+	redis.Cmdable
+	vals map[string]string
+}
+
+func (r *memRedis) Set(ctx context.Context, key string, value any, expiration time.Duration) *redis.StatusCmd {
+	r.vals[key] = fmt.Sprint(value)
+	cmd := redis.NewStatusCmd(ctx)
+	cmd.SetVal("OK")
+	return cmd
+}
+
+func (r *memRedis) GetDel(ctx context.Context, key string) *redis.StringCmd {
+	cmd := redis.NewStringCmd(ctx)
+	val, ok := r.vals[key]
+	if !ok {
+		cmd.SetErr(redis.Nil)
+		return cmd
+	}
+	delete(r.vals, key)
+	cmd.SetVal(val)
+	return cmd
+}
+
+const testCallback = "/oauth2/github/callback"
+
+// authState 模拟浏览器请求 authurl，返回 state 和 cookie
+func authState(t *testing.T, s *OAuth2StateStore, uid int64) (string, *http.Cookie) {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/oauth2/github/authurl", nil)
+	state, err := s.Create(ctx, testCallback, uid)
+	require.NoError(t, err)
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+	return state, cookies[0]
+}
+
+// callbackState 模拟第三方回调
+func callbackState(s *OAuth2StateStore, path string, state string, ck *http.Cookie) (int64, error) {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodGet, path+"?code=abc&state="+state, nil)
+	if ck != nil {
+		ctx.Request.AddCookie(ck)
+	}
+	return s.Verify(ctx, path)
+}
+
+func TestOAuth2StateStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newStore := func() *OAuth2StateStore {
+		return NewOAuth2StateStore(&memRedis{vals: map[string]string{}}, Config{})
+	}
+
+	t.Run("绑定只能用一次", func(t *testing.T) {
+		s := newStore()
+		state, ck := authState(t, s, 123)
+		assert.Equal(t, state, ck.Value)
+		assert.True(t, ck.HttpOnly)
+
+		uid, err := callbackState(s, testCallback, state, ck)
+		require.NoError(t, err)
+		assert.Equal(t, int64(123), uid)
+
+		_, err = callbackState(s, testCallback, state, ck)
+		assert.Equal(t, errInvalidState, err)
+	})
+
+	t.Run("登录", func(t *testing.T) {
+		s := newStore()
+		state, ck := authState(t, s, 0)
+		uid, err := callbackState(s, testCallback, state, ck)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), uid)
+	})
+
+	t.Run("自己造的 state", func(t *testing.T) {
+		// 没有经过 authurl 的 state，redis 里面没有，不能拿来绑定别人的账号
+		s := newStore()
+		ck := &http.Cookie{Name: stateCookieName, Value: "forged"}
+		_, err := callbackState(s, testCallback, "forged", ck)
+		assert.Equal(t, errInvalidState, err)
+	})
+
+	t.Run("cookie 和 state 对不上", func(t *testing.T) {
+		s := newStore()
+		state, _ := authState(t, s, 123)
+		_, other := authState(t, s, 0)
+		_, err := callbackState(s, testCallback, state, other)
+		assert.Equal(t, errInvalidState, err)
+		_, err = callbackState(s, testCallback, state, nil)
+		assert.Equal(t, errInvalidState, err)
+	})
+
+	t.Run("换了一个回调", func(t *testing.T) {
+		s := newStore()
+		state, ck := authState(t, s, 123)
+		_, err := callbackState(s, "/oauth2/wechat/callback", state, ck)
+		assert.Equal(t, errInvalidState, err)
+	})
+}
@@ -0,0 +1,26 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// RequirePermission 校验当前用户有没有 perm 权限，要放在登录校验的后面。
+// 权限在签发短 token 的时候就写进去了，这里不查数据库
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		val, _ := ctx.Get("claims")
+		uc, ok := val.(*UserClaims)
+		if !ok {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if !uc.HasPermission(perm) {
+			zap.L().Warn("没有权限", zap.Int64("uid", uc.Uid),
+				zap.String("perm", perm), zap.String("path", ctx.Request.URL.Path))
+			ctx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package web
 
-type Result struct {
-	Code int    `json:"code"`
-	Msg  string `json:"msg"`
-	Data any    `json:"data"`
-}
+import "github.com/jym0818/webook/pkg/ginx"
+
+// Result 挪到了 ginx 里面，这里保留别名，老的 handler 不用改
+type Result = ginx.Result
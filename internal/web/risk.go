@@ -0,0 +1,93 @@
+package web
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jym0818/webook/internal/errs"
+	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/pkg/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// deviceHeader 前端生成并持久化的设备 ID，没有的时候只按 IP 统计
+const deviceHeader = "X-Device-Id"
+
+// RiskPolicy 发短信这种不用登录、又有成本的接口，同一个 IP 或者设备调用太多之后，
+// 每次调用都要先通过图形验证码，防止被拿来轰炸别人的手机
+type RiskPolicy struct {
+	captchaSvc service.CaptchaService
+	ip         ratelimit.Limiter
+	device     ratelimit.Limiter
+
+	challenges *prometheus.CounterVec
+}
+
+func NewRiskPolicy(captchaSvc service.CaptchaService, ip ratelimit.Limiter, device ratelimit.Limiter) *RiskPolicy {
+	challenges := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "jym",
+		Subsystem: "webook",
+		Name:      "captcha_challenge_total",
+		Help:      "要求图形验证码的次数，突然变多说明有人在刷接口",
+	}, []string{"scene"})
+	prometheus.MustRegister(challenges)
+	return &RiskPolicy{
+		captchaSvc: captchaSvc,
+		ip:         ip,
+		device:     device,
+		challenges: challenges,
+	}
+}
+
+// CaptchaReq 需要图形验证码的接口都带上这两个字段，没有触发风控的时候可以不传
+type CaptchaReq struct {
+	CaptchaId     string `json:"captcha_id"`
+	CaptchaAnswer string `json:"captcha_answer"`
+}
+
+// check 需要图形验证码而且没有通过的时候已经写好了响应，返回 false
+func (p *RiskPolicy) check(ctx *gin.Context, scene string, req CaptchaReq) bool {
+	if !p.risky(ctx, scene) {
+		return true
+	}
+	p.challenges.WithLabelValues(scene).Inc()
+	if req.CaptchaId == "" {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserCaptchaRequired, Msg: "请先完成图形验证"})
+		return false
+	}
+	ok, err := p.captchaSvc.Verify(ctx.Request.Context(), req.CaptchaId, req.CaptchaAnswer)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("校验图形验证码失败", zap.Error(err))
+		return false
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserCaptchaRequired, Msg: "图形验证码错误，请重新获取"})
+		return false
+	}
+	return true
+}
+
+// risky 每次调用都会计数，IP 和设备有一个超过阈值就算有风险
+func (p *RiskPolicy) risky(ctx *gin.Context, scene string) bool {
+	limited, err := p.ip.Limit(ctx, fmt.Sprintf("risk:%s:ip:%s", scene, ctx.ClientIP()))
+	if err != nil {
+		// Redis 出问题的时候不能让所有人都收不到验证码
+		zap.L().Error("风控统计失败", zap.Error(err))
+		return false
+	}
+	if limited {
+		return true
+	}
+	device := ctx.GetHeader(deviceHeader)
+	if device == "" || len(device) > 64 {
+		return false
+	}
+	limited, err = p.device.Limit(ctx, fmt.Sprintf("risk:%s:device:%s", scene, device))
+	if err != nil {
+		zap.L().Error("风控统计失败", zap.Error(err))
+		return false
+	}
+	return limited
+}
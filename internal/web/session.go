@@ -0,0 +1,143 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"sort"
+	"time"
+)
+
+var errSessionNotFound = errors.New("会话不存在")
+
+// Session 一次登录就是一个会话，用 ssid 标识
+type Session struct {
+	Ssid      string
+	UserAgent string
+	IP        string
+	// Ctime 登录时间，毫秒数
+	Ctime int64
+	// Utime 最后一次刷新 token 的时间，毫秒数
+	Utime int64
+}
+
+// recordSession 记录用户名下的会话，用户可以查看自己在哪些设备上登录了，
+// 也方便一次性让这个用户的所有登录失效
+func (h jwtHandler) recordSession(c *gin.Context, uid int64, ssid string) error {
+	now := time.Now().UnixMilli()
+	val, err := json.Marshal(Session{
+		Ssid:      ssid,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+		Ctime:     now,
+		Utime:     now,
+	})
+	if err != nil {
+		return err
+	}
+	key := h.sessionsKey(uid)
+	pipe := h.cmd.TxPipeline()
+	pipe.HSet(c, key, ssid, val)
+	pipe.Expire(c, key, refreshExpiration)
+	_, err = pipe.Exec(c)
+	return err
+}
+
+// touchSession 刷新 token 的时候更新一下最后活跃时间
+func (h jwtHandler) touchSession(ctx context.Context, uid int64, ssid string) error {
+	key := h.sessionsKey(uid)
+	val, err := h.cmd.HGet(ctx, key, ssid).Bytes()
+	if err != nil {
+		return err
+	}
+	var s Session
+	err = json.Unmarshal(val, &s)
+	if err != nil {
+		return err
+	}
+	s.Utime = time.Now().UnixMilli()
+	val, err = json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	// 每次刷新都会签发新的长 token，会话跟着续期
+	pipe := h.cmd.TxPipeline()
+	pipe.HSet(ctx, key, ssid, val)
+	pipe.Expire(ctx, key, refreshExpiration)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// listSessions 按照最后活跃时间倒序，顺便清理掉已经过期的会话
+func (h jwtHandler) listSessions(ctx context.Context, uid int64) ([]Session, error) {
+	key := h.sessionsKey(uid)
+	vals, err := h.cmd.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	expired := time.Now().Add(-refreshExpiration).UnixMilli()
+	res := make([]Session, 0, len(vals))
+	var expiredSsids []string
+	for ssid, val := range vals {
+		var s Session
+		err = json.Unmarshal([]byte(val), &s)
+		if err != nil {
+			return nil, err
+		}
+		// 最后一次刷新的时候签发了新的长 token，从那个时候开始算
+		if s.Utime < expired {
+			expiredSsids = append(expiredSsids, ssid)
+			continue
+		}
+		res = append(res, s)
+	}
+	if len(expiredSsids) > 0 {
+		err = h.cmd.HDel(ctx, key, expiredSsids...).Err()
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Utime > res[j].Utime
+	})
+	return res, nil
+}
+
+// revokeSession 只能下线自己名下的会话
+func (h jwtHandler) revokeSession(ctx context.Context, uid int64, ssid string) error {
+	key := h.sessionsKey(uid)
+	ok, err := h.cmd.HExists(ctx, key, ssid).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errSessionNotFound
+	}
+	err = h.clearToken(ctx, ssid)
+	if err != nil {
+		return err
+	}
+	return h.cmd.HDel(ctx, key, ssid).Err()
+}
+
+// clearAllTokens 让用户所有的会话失效，比如说重置密码之后，或者用户选择退出所有设备
+func (h jwtHandler) clearAllTokens(ctx context.Context, uid int64) error {
+	key := h.sessionsKey(uid)
+	ssids, err := h.cmd.HKeys(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	for _, ssid := range ssids {
+		err = h.clearToken(ctx, ssid)
+		if err != nil {
+			return err
+		}
+	}
+	return h.cmd.Del(ctx, key).Err()
+}
+
+func (h jwtHandler) sessionsKey(uid int64) string {
+	return fmt.Sprintf("user:sessions:%d", uid)
+}
@@ -0,0 +1,169 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"net"
+	"strings"
+)
+
+// BindingPolicy 登录的时候算一个指纹放进短 token，之后每次请求重新算一次，
+// 不一样就说明 token 可能被拿到别的地方用了
+type BindingPolicy interface {
+	Name() string
+	// Fingerprint 返回空字符串表示这个请求没法绑定，比如没有带设备 ID
+	Fingerprint(ctx *gin.Context) string
+}
+
+// NoneBinding 不绑定
+type NoneBinding struct{}
+
+func (NoneBinding) Name() string {
+	return "none"
+}
+
+func (NoneBinding) Fingerprint(ctx *gin.Context) string {
+	return ""
+}
+
+// UABinding 只比较浏览器（或者 App）和主版本号，
+// 浏览器自动更新小版本、操作系统打补丁都不会让用户掉线
+type UABinding struct{}
+
+func (UABinding) Name() string {
+	return "ua"
+}
+
+func (UABinding) Fingerprint(ctx *gin.Context) string {
+	return uaFamily(ctx.Request.UserAgent())
+}
+
+// uaBrowsers 顺序很重要，Edge 和 Opera 的 UA 里面也有 Chrome，Chrome 的 UA 里面也有 Safari
+var uaBrowsers = []string{"MicroMessenger/", "Edg/", "OPR/", "Firefox/", "Chrome/", "CriOS/", "FxiOS/", "Version/"}
+
+// uaFamily 返回 Chrome/118 这种格式，认不出来的用第一段 product/version，
+// 比如我们自己 App 的 webook-ios/3.2.1 就是 webook-ios/3
+func uaFamily(ua string) string {
+	for _, b := range uaBrowsers {
+		idx := strings.Index(ua, b)
+		if idx < 0 {
+			continue
+		}
+		name := strings.TrimSuffix(b, "/")
+		if name == "Version" {
+			// Safari 的版本号在 Version/ 后面
+			name = "Safari"
+		}
+		return name + "/" + majorVersion(ua[idx+len(b):])
+	}
+	product, _, _ := strings.Cut(ua, " ")
+	name, version, ok := strings.Cut(product, "/")
+	if !ok {
+		return product
+	}
+	return name + "/" + majorVersion(version)
+}
+
+func majorVersion(s string) string {
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if end < 0 {
+		return s
+	}
+	return s[:end]
+}
+
+// DeviceBinding 绑定前端生成的设备 ID，App 升级也不会变
+type DeviceBinding struct{}
+
+func (DeviceBinding) Name() string {
+	return "device"
+}
+
+func (DeviceBinding) Fingerprint(ctx *gin.Context) string {
+	return ctx.GetHeader(deviceHeader)
+}
+
+// IPBinding 绑定 IP 所在的网段，移动网络切基站的时候 IP 经常在同一个网段里面变
+type IPBinding struct {
+	v4 net.IPMask
+	v6 net.IPMask
+}
+
+// NewIPBinding 一般是 IPv4 /24，IPv6 /64
+func NewIPBinding(v4Bits, v6Bits int) IPBinding {
+	return IPBinding{
+		v4: net.CIDRMask(v4Bits, 32),
+		v6: net.CIDRMask(v6Bits, 128),
+	}
+}
+
+func (IPBinding) Name() string {
+	return "ip"
+}
+
+func (b IPBinding) Fingerprint(ctx *gin.Context) string {
+	ip := net.ParseIP(ctx.ClientIP())
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(b.v4).String()
+	}
+	return ip.Mask(b.v6).String()
+}
+
+// SessionBinder 不强制的时候只记日志和打点，可以先观察误杀的比例再决定要不要打开
+type SessionBinder struct {
+	policy  BindingPolicy
+	enforce bool
+
+	mismatches *prometheus.CounterVec
+}
+
+func NewSessionBinder(policy BindingPolicy, enforce bool) *SessionBinder {
+	mismatches := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "jym",
+		Subsystem: "webook",
+		Name:      "session_binding_mismatch_total",
+		Help:      "短 token 的绑定指纹和请求对不上的次数",
+	}, []string{"policy", "enforced"})
+	prometheus.MustRegister(mismatches)
+	return &SessionBinder{
+		policy:     policy,
+		enforce:    enforce,
+		mismatches: mismatches,
+	}
+}
+
+// Fingerprint 签发短 token 的时候用
+func (b *SessionBinder) Fingerprint(ctx *gin.Context) string {
+	return b.policy.Fingerprint(ctx)
+}
+
+// Check 返回 false 表示要拒绝这个请求
+func (b *SessionBinder) Check(ctx *gin.Context, claims *UserClaims) bool {
+	// 签发的时候没法绑定，或者签发的时候还没有打开绑定
+	if claims.Binding == "" {
+		return true
+	}
+	fp := b.policy.Fingerprint(ctx)
+	if fp == claims.Binding {
+		return true
+	}
+	enforced := "false"
+	if b.enforce {
+		enforced = "true"
+	}
+	b.mismatches.WithLabelValues(b.policy.Name(), enforced).Inc()
+	zap.L().Warn("短 token 的绑定指纹对不上",
+		zap.String("policy", b.policy.Name()),
+		zap.Int64("uid", claims.Uid),
+		zap.String("ssid", claims.Ssid),
+		zap.String("expected", claims.Binding),
+		zap.String("actual", fp),
+		zap.Bool("enforced", b.enforce))
+	return !b.enforce
+}
@@ -2,138 +2,293 @@ package web
 
 import (
 	"fmt"
-	regexp "github.com/dlclark/regexp2"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/jym0818/webook/internal/domain"
 	"github.com/jym0818/webook/internal/errs"
 	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/pkg/ginx"
+	"github.com/jym0818/webook/pkg/openapi"
+	"github.com/jym0818/webook/pkg/phonex"
 	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"net/http"
+	"net/url"
 	"time"
+	"unicode/utf8"
 )
 
-const emailRegexPattern = "^\\w+([-+.]\\w+)*@\\w+([-.]\\w+)*\\.\\w+([-.]\\w+)*$"
+const (
+	loginMethodPassword = "password"
+	loginMethodSMS      = "sms"
+	// loginMethodSignupEmail 注册的时候验证完邮箱直接登录
+	loginMethodSignupEmail = "signup_email"
+)
 
-const passwordRegexPattern = `^(?=.*[A-Za-z])(?=.*\d)(?=.*[$@$!%*#?&])[A-Za-z\d$@$!%*#?&]{8,}$`
+const (
+	bizSignupEmail = "signup_email"
+	bizResetPwd    = "reset_pwd"
+	bizBindPhone   = "bind_phone"
+	bizBindEmail   = "bind_email"
+)
 
 type UserHandler struct {
-	emailExp    *regexp.Regexp
-	passwordExp *regexp.Regexp
-	svc         service.UserService
-	codeSvc     service.CodeService
+	svc     service.UserService
+	codeSvc service.CodeService
+	mfaSvc  service.MFAService
+	linkSvc service.MagicLinkService
+	guard   *LoginGuard
+	risk    *RiskPolicy
+	// phones 手机号统一成 E.164 格式再使用，不然 +86 138... 和 138... 会变成两个账号
+	phones *phonex.Parser
 	jwtHandler
-	cmd redis.Cmdable
 }
 
-func NewUserHandler(svc service.UserService, codeSvc service.CodeService, cmd redis.Cmdable) *UserHandler {
+func NewUserHandler(svc service.UserService, codeSvc service.CodeService, mfaSvc service.MFAService,
+	linkSvc service.MagicLinkService,
+	roleSvc service.RoleService, logSvc service.LoginLogService,
+	phones *phonex.Parser, cmd redis.Cmdable, keys JWTKeyrings, binder *SessionBinder,
+	guard *LoginGuard, risk *RiskPolicy) *UserHandler {
 	return &UserHandler{
-		emailExp:    regexp.MustCompile(emailRegexPattern, regexp.None),
-		passwordExp: regexp.MustCompile(passwordRegexPattern, regexp.None),
-		svc:         svc,
-		codeSvc:     codeSvc,
-		jwtHandler:  jwtHandler{},
-		cmd:         cmd,
+		svc:        svc,
+		codeSvc:    codeSvc,
+		mfaSvc:     mfaSvc,
+		linkSvc:    linkSvc,
+		guard:      guard,
+		risk:       risk,
+		phones:     phones,
+		jwtHandler: newJWTHandler(cmd, keys, roleSvc, logSvc, binder),
 	}
 }
 
 func (h *UserHandler) RegisterRoutes(s *gin.Engine) {
 	g := s.Group("/user")
 	g.POST("/signup", h.Signup)
+	g.POST("/signup/verify", h.SignupVerify)
 	g.POST("/login", h.Login)
+	g.POST("/login/2fa", h.LoginMFA)
 	g.POST("/profile", h.Profile)
+	g.POST("/edit", h.Edit)
 	g.POST("/logout", h.Logout)
 	g.POST("/refresh", h.RefreshToken)
 	g.POST("/login_sms", h.LoginSMS)
 	g.POST("/login_sms/send", h.SendSMS)
+	g.POST("/login_email/send", h.SendLoginEmail)
+	g.POST("/login_email/verify", h.LoginEmail)
+	g.POST("/password/reset/send", h.SendResetPasswordCode)
+	g.POST("/password/reset", h.ResetPassword)
+
+	bg := g.Group("/bind")
+	bg.POST("/phone/send", h.SendBindPhoneCode)
+	bg.POST("/phone", h.BindPhone)
+	bg.POST("/email/send", h.SendBindEmailCode)
+	bg.POST("/email", h.BindEmail)
+	g.POST("/unbind", h.Unbind)
+	g.POST("/merge", h.Merge)
+
+	tg := g.Group("/2fa/totp")
+	tg.POST("/enroll", ginx.WrapClaims(h.EnrollTOTP))
+	tg.POST("/confirm", ginx.WrapBodyAndClaims(h.ConfirmTOTP))
+	tg.POST("/disable", h.DisableTOTP)
+
+	g.POST("/deactivate", h.Deactivate)
+
+	g.GET("/sessions", ginx.WrapClaims(h.Sessions))
+	g.POST("/sessions/revoke", ginx.WrapBodyAndClaims(h.RevokeSession))
+	g.POST("/sessions/revoke_all", ginx.WrapClaims(h.RevokeAllSessions))
+
+	g.POST("/security/logins", h.LoginLogs)
 }
 
-func (h *UserHandler) Login(c *gin.Context) {
-	type Req struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+// Docs 加了路由要在这里补上文档，不然 ioc/web_test.go 里面的 TestInitWeb_Docs 会失败
+func (h *UserHandler) Docs() []openapi.Operation {
+	const tag = "用户"
+	return []openapi.Operation{
+		{Method: http.MethodPost, Path: "/user/signup", Summary: "邮箱注册，之后要验证邮箱", Tag: tag, Request: SignupReq{}, Public: true},
+		{Method: http.MethodPost, Path: "/user/signup/verify", Summary: "验证注册邮箱", Tag: tag, Request: SignupVerifyReq{}, Public: true},
+		{Method: http.MethodPost, Path: "/user/login", Summary: "邮箱密码登录，开启了两步验证的时候 data 是临时凭证", Tag: tag, Request: LoginReq{}, Response: "", Public: true},
+		{Method: http.MethodPost, Path: "/user/login/2fa", Summary: "两步验证", Tag: tag, Request: LoginMFAReq{}, Public: true},
+		{Method: http.MethodPost, Path: "/user/profile", Summary: "个人信息", Tag: tag, Response: UserProfileVO{}},
+		{Method: http.MethodPost, Path: "/user/edit", Summary: "修改个人信息", Tag: tag, Request: UserEditReq{}},
+		{Method: http.MethodPost, Path: "/user/logout", Summary: "退出登录", Tag: tag},
+		{Method: http.MethodPost, Path: "/user/refresh", Summary: "用长 token 换新的短 token，Authorization 里面放长 token", Tag: tag, Public: true},
+		{Method: http.MethodPost, Path: "/user/login_sms", Summary: "短信登录，没有注册的手机号会自动注册", Tag: tag, Request: LoginSMSReq{}, Public: true},
+		{Method: http.MethodPost, Path: "/user/login_sms/send", Summary: "发送登录短信", Tag: tag, Request: SendSMSReq{}, Public: true},
+		{Method: http.MethodPost, Path: "/user/login_email/send", Summary: "发送邮件登录链接，15 分钟内有效", Tag: tag, Request: SendLoginEmailReq{}, Public: true},
+		{Method: http.MethodPost, Path: "/user/login_email/verify", Summary: "用邮件登录链接里面的 token 登录，没有注册的邮箱会自动注册", Tag: tag, Request: LoginEmailReq{}, Public: true},
+		{Method: http.MethodPost, Path: "/user/password/reset/send", Summary: "发送重置密码的验证码", Tag: tag, Request: SendResetPasswordCodeReq{}, Public: true},
+		{Method: http.MethodPost, Path: "/user/password/reset", Summary: "重置密码", Tag: tag, Request: ResetPasswordReq{}, Public: true},
+		{Method: http.MethodPost, Path: "/user/bind/phone/send", Summary: "发送绑定手机号的验证码", Tag: tag, Request: SendBindPhoneCodeReq{}},
+		{Method: http.MethodPost, Path: "/user/bind/phone", Summary: "绑定手机号，已经属于别的账号的时候 data 是合并凭证", Tag: tag, Request: BindPhoneReq{}, Response: ""},
+		{Method: http.MethodPost, Path: "/user/bind/email/send", Summary: "发送绑定邮箱的验证码", Tag: tag, Request: SendBindEmailCodeReq{}},
+		{Method: http.MethodPost, Path: "/user/bind/email", Summary: "绑定邮箱并设置密码", Tag: tag, Request: BindEmailReq{}, Response: ""},
+		{Method: http.MethodPost, Path: "/user/unbind", Summary: "解绑手机号、邮箱或者微信", Tag: tag, Request: UnbindReq{}},
+		{Method: http.MethodPost, Path: "/user/merge", Summary: "用合并凭证合并账号", Tag: tag, Request: MergeReq{}},
+		{Method: http.MethodPost, Path: "/user/2fa/totp/enroll", Summary: "生成两步验证的密钥", Tag: tag, Response: TOTPEnrollVO{}},
+		{Method: http.MethodPost, Path: "/user/2fa/totp/confirm", Summary: "开启两步验证，data 是恢复码", Tag: tag, Request: ConfirmTOTPReq{}, Response: []string{}},
+		{Method: http.MethodPost, Path: "/user/2fa/totp/disable", Summary: "关闭两步验证", Tag: tag, Request: DisableTOTPReq{}},
+		{Method: http.MethodPost, Path: "/user/deactivate", Summary: "注销账号，冷静期内重新登录可以恢复", Tag: tag},
+		{Method: http.MethodGet, Path: "/user/sessions", Summary: "登录中的设备", Tag: tag, Response: []SessionVO{}},
+		{Method: http.MethodPost, Path: "/user/sessions/revoke", Summary: "下线一个设备", Tag: tag, Request: RevokeSessionReq{}},
+		{Method: http.MethodPost, Path: "/user/sessions/revoke_all", Summary: "退出所有设备", Tag: tag},
+		{Method: http.MethodPost, Path: "/user/security/logins", Summary: "登录历史", Tag: tag, Request: ListReq{}, Response: []LoginLogVO{}},
 	}
+}
+
+type LoginReq struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
 
-	var req Req
+func (h *UserHandler) Login(c *gin.Context) {
+
+	var req LoginReq
 	if er := c.Bind(&req); er != nil {
 		return
 	}
+	lg := h.newLoginLog(c, domain.LoginActionLogin, loginMethodPassword)
+	lg.Account = req.Email
+	defer h.audit(c, lg)
+	if !h.guard.check(c, loginMethodPassword, req.Email) {
+		lg.Code = errs.UserLoginLocked
+		return
+	}
 
 	user, err := h.svc.Login(c.Request.Context(), req.Email, req.Password)
 	if err == service.ErrInvalidUserOrPassword {
-		c.JSON(http.StatusOK, Result{Code: errs.UserInvalidOrPassword, Msg: "账号或者密码错误"})
+		lg.Code = errs.UserLoginLocked
+		if h.guard.fail(c, loginMethodPassword, req.Email) {
+			lg.Code = errs.UserInvalidOrPassword
+			c.JSON(http.StatusOK, Result{Code: errs.UserInvalidOrPassword, Msg: "账号或者密码错误"})
+		}
 		return
 	}
-	if err != nil {
-		c.JSON(http.StatusOK, Result{Code: 500, Msg: "系统错误"})
+	if err == service.ErrUserNotActivated {
+		lg.Code = errs.UserNotActivated
+		c.JSON(http.StatusOK, Result{Code: errs.UserNotActivated, Msg: "账号未激活，请先完成邮箱验证"})
+		return
+	}
+	if err == service.ErrUserDeleted {
+		lg.Code = errs.UserDeleted
+		c.JSON(http.StatusOK, Result{Code: errs.UserDeleted, Msg: "账号已注销"})
+		return
+	}
+	if err == service.ErrUserBanned {
+		lg.Code = errs.UserBanned
+		c.JSON(http.StatusOK, Result{Code: errs.UserBanned, Msg: "账号已被封禁"})
 		return
 	}
-
-	err = h.setJWT(c, user.Id)
 	if err != nil {
-		c.JSON(http.StatusOK, Result{Code: 500, Msg: "系统错误"})
+		lg.Code = errs.UserInternalServerError
+		c.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
 		return
 	}
-	c.JSON(http.StatusOK, Result{Code: 200, Msg: "登录成功"})
 
+	h.guard.success(c, loginMethodPassword, req.Email)
+	h.loginWithMFA(c, lg, user.Id, "登录成功")
+}
+
+// SignupReq 密码在验证邮箱的时候才设置
+type SignupReq struct {
+	Email string `json:"email" binding:"email"`
 }
 
 func (h *UserHandler) Signup(c *gin.Context) {
 	//接受参数
-	type Req struct {
-		Email      string `json:"email"`
-		Password   string `json:"password"`
-		RePassword string `json:"rePassword"`
-	}
-	var req Req
+	var req SignupReq
 	//Bind方法会根据Context-Type来解析你的数据到req中
-	//解析错了，会返回400错误
-	if err := c.Bind(&req); err != nil {
+	//解析错了，会返回400错误，参数校验没有通过会返回每个字段的错误
+	if !ginx.Bind(c, &req) {
+		return
+	}
 
+	//调用下一层
+	err := h.svc.Signup(c.Request.Context(), req.Email)
+	//错误判断
+	if err == service.ErrUserDuplicateEmail {
+		span := trace.SpanFromContext(c.Request.Context())
+		span.AddEvent("邮件冲突")
+		c.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "邮箱冲突"})
 		return
 	}
-	//参数校验
-	ok, err := h.emailExp.MatchString(req.Email)
-	if err != nil {
-		c.JSON(http.StatusOK, Result{Code: 500, Msg: "系统错误"})
+	// 之前注册过但是没有验证，重新发一次验证邮件
+	if err != nil && err != service.ErrUserNotActivated {
+		c.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
 		return
 	}
-	if !ok {
-		c.JSON(http.StatusOK, Result{Code: 400, Msg: "邮箱格式不正确"})
+
+	err = h.codeSvc.SendEmail(c.Request.Context(), bizSignupEmail, req.Email)
+	if err == service.ErrCodeSendTooMany {
+		c.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "发送频繁"})
 		return
 	}
-	ok, err = h.passwordExp.MatchString(req.Password)
 	if err != nil {
-		c.JSON(http.StatusOK, Result{Code: 500, Msg: "系统错误"})
+		c.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("发送注册验证邮件失败", zap.Error(err))
 		return
 	}
-	if !ok {
-		c.JSON(http.StatusOK, Result{Code: 400, Msg: "密码格式不正确"})
+
+	c.JSON(http.StatusOK, Result{Code: 200, Msg: "注册成功，请查收验证邮件"})
+
+}
+
+// SignupVerifyReq 只有收到验证码的人才能设置密码
+type SignupVerifyReq struct {
+	Email      string `json:"email" binding:"email"`
+	InputCode  string `json:"input_code" binding:"required"`
+	Password   string `json:"password" binding:"password"`
+	RePassword string `json:"rePassword" binding:"eqfield=Password"`
+}
+
+func (h *UserHandler) SignupVerify(c *gin.Context) {
+	var req SignupVerifyReq
+	if !ginx.Bind(c, &req) {
 		return
 	}
-	if req.RePassword != req.Password {
-		c.JSON(http.StatusOK, Result{Code: 400, Msg: "两次密码输入不正确"})
+	// 验证通过之后直接登录，和别的登录一样记审计日志
+	lg := h.newLoginLog(c, domain.LoginActionLogin, loginMethodSignupEmail)
+	lg.Account = req.Email
+	defer h.audit(c, lg)
+	ok, err := h.codeSvc.Verify(c.Request.Context(), bizSignupEmail, req.Email, req.InputCode)
+	if err == service.ErrCodeVerifyTooManyTimes {
+		lg.Code = errs.UserInvalidInput
+		c.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "验证次数太多，请重新注册"})
 		return
 	}
-
-	//调用下一层
-	err = h.svc.Signup(c.Request.Context(), domain.User{Email: req.Email, Password: req.Password})
-	//错误判断
-	if err == service.ErrUserDuplicateEmail {
-		span := trace.SpanFromContext(c.Request.Context())
-		span.AddEvent("邮件冲突")
-		c.JSON(http.StatusOK, Result{Code: 400, Msg: "邮箱冲突"})
+	if err != nil {
+		lg.Code = errs.UserInternalServerError
+		c.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("校验邮箱验证码出错", zap.Error(err))
 		return
 	}
-	if err != nil {
-		c.JSON(http.StatusOK, Result{Code: 500, Msg: "系统错误"})
+	if !ok {
+		lg.Code = errs.UserInvalidInput
+		c.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "验证码错误"})
 		return
 	}
 
-	c.JSON(http.StatusOK, Result{Code: 200, Msg: "注册成功"})
-
+	u, err := h.svc.ActivateByEmail(c.Request.Context(), req.Email, req.Password)
+	switch err {
+	case nil:
+	case service.ErrUserNotFound:
+		lg.Code = errs.UserInvalidInput
+		c.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "用户不存在"})
+		return
+	case service.ErrUserDeleted:
+		lg.Code = errs.UserDeleted
+		c.JSON(http.StatusOK, Result{Code: errs.UserDeleted, Msg: "账号已注销"})
+		return
+	case service.ErrUserBanned:
+		lg.Code = errs.UserBanned
+		c.JSON(http.StatusOK, Result{Code: errs.UserBanned, Msg: "账号已被封禁"})
+		return
+	default:
+		lg.Code = errs.UserInternalServerError
+		c.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	h.loginWithMFA(c, lg, u.Id, "验证成功")
 }
 
 func (h *UserHandler) Profile(c *gin.Context) {
@@ -142,86 +297,224 @@ func (h *UserHandler) Profile(c *gin.Context) {
 	user, err := h.svc.Profile(c.Request.Context(), claims.Uid)
 
 	if err != nil {
-		c.JSON(http.StatusOK, Result{Code: 500, Msg: "系统错误"})
+		c.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	c.JSON(http.StatusOK, Result{Code: 200, Msg: "ok", Data: newUserProfileVO(user)})
+
+}
+
+func (h *UserHandler) Edit(c *gin.Context) {
+	var req UserEditReq
+	if err := c.Bind(&req); err != nil {
+		return
+	}
+	// 零值代表不修改
+	var birthday time.Time
+	if req.Birthday != "" {
+		var err error
+		birthday, err = time.Parse(time.DateOnly, req.Birthday)
+		if err != nil || birthday.After(time.Now()) {
+			c.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "生日格式不对"})
+			return
+		}
+	}
+	if utf8.RuneCountInString(req.Nickname) > 32 {
+		c.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "昵称过长"})
+		return
+	}
+	if utf8.RuneCountInString(req.AboutMe) > 1024 {
+		c.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "个人简介过长"})
 		return
 	}
-	c.JSON(http.StatusOK, Result{Code: 200, Msg: "ok", Data: user})
+	if req.Avatar != "" {
+		u, err := url.Parse(req.Avatar)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(req.Avatar) > 1024 {
+			c.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "头像地址不对"})
+			return
+		}
+	}
 
+	claims := c.MustGet("claims").(*UserClaims)
+	err := h.svc.UpdateNonSensitiveInfo(c.Request.Context(), domain.User{
+		Id:       claims.Uid,
+		Nickname: req.Nickname,
+		Birthday: birthday,
+		AboutMe:  req.AboutMe,
+		Avatar:   req.Avatar,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("更新个人资料失败", zap.Error(err), zap.Int64("uid", claims.Uid))
+		return
+	}
+	c.JSON(http.StatusOK, Result{Code: 200, Msg: "ok"})
 }
 
 func (h *UserHandler) Logout(c *gin.Context) {
 	c.Header("x-jwt-token", "")
 	c.Header("x-refresh-token", "")
 	uc := c.MustGet("claims").(*UserClaims)
-	err := h.cmd.Set(c, fmt.Sprintf("user:ssid:%s", uc.Ssid), "", time.Hour*7*24).Err()
+	lg := h.newLoginLog(c, domain.LoginActionLogout, "")
+	lg.Uid = uc.Uid
+	lg.Ssid = uc.Ssid
+	defer h.audit(c, lg)
+	err := h.revokeSession(c, uc.Uid, uc.Ssid)
+	if err == errSessionNotFound {
+		// 老的登录没有记录会话，直接让 ssid 失效
+		err = h.clearToken(c, uc.Ssid)
+	}
 	if err != nil {
-		c.JSON(http.StatusOK, Result{Code: 500, Msg: "系统错误"})
+		lg.Code = errs.UserInternalServerError
+		c.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
 		return
 	}
+	lg.Code = errs.Success
 	c.JSON(http.StatusOK, Result{Code: 200, Msg: "退出登录成功"})
 }
 
+// Deactivate 注销账号，所有登录都会失效，冷静期内重新登录可以恢复
+func (h *UserHandler) Deactivate(ctx *gin.Context) {
+	uc := ctx.MustGet("claims").(*UserClaims)
+	err := h.svc.Deactivate(ctx.Request.Context(), uc.Uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("注销账号失败", zap.Error(err), zap.Int64("uid", uc.Uid))
+		return
+	}
+	err = h.clearAllTokens(ctx, uc.Uid)
+	if err != nil {
+		zap.L().Error("注销账号之后下线会话失败", zap.Error(err), zap.Int64("uid", uc.Uid))
+	}
+	ctx.Header("x-jwt-token", "")
+	ctx.Header("x-refresh-token", "")
+	days := int(service.DeactivateCoolingOff / (time.Hour * 24))
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: fmt.Sprintf("账号已注销，%d 天内重新登录可以恢复", days)})
+}
+
+type LoginSMSReq struct {
+	Phone     string `json:"phone" binding:"phone"`
+	InputCode string `json:"input_code" binding:"required"`
+}
+
 func (h *UserHandler) LoginSMS(ctx *gin.Context) {
-	type Req struct {
-		Phone     string `json:"phone"`
-		InputCode string `json:"input_code"`
+	var req LoginSMSReq
+	if !ginx.Bind(ctx, &req) {
+		return
+	}
+	phone, valid := h.normalizePhone(ctx, req.Phone)
+	if !valid {
+		return
 	}
-	var req Req
-	if err := ctx.Bind(&req); err != nil {
+	req.Phone = phone
+	lg := h.newLoginLog(ctx, domain.LoginActionLogin, loginMethodSMS)
+	lg.Account = req.Phone
+	defer h.audit(ctx, lg)
+	if !h.guard.check(ctx, loginMethodSMS, req.Phone) {
+		lg.Code = errs.UserLoginLocked
 		return
 	}
 	ok, err := h.codeSvc.Verify(ctx.Request.Context(), "login", req.Phone, req.InputCode)
+	if err == service.ErrCodeVerifyTooManyTimes {
+		lg.Code = errs.UserLoginLocked
+		if h.guard.fail(ctx, loginMethodSMS, req.Phone) {
+			lg.Code = errs.UserInvalidInput
+			ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "验证次数太多，请重新获取验证码"})
+		}
+		return
+	}
 	if err != nil {
-		ctx.JSON(http.StatusOK, Result{Code: 500, Msg: "系统错误"})
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
 		zap.L().Error("校验验证码出错", zap.Error(err), zap.Int64("id", 123))
 		return
 	}
 
 	if !ok {
-		ctx.JSON(http.StatusOK, Result{Code: 400, Msg: "验证码错误"})
+		lg.Code = errs.UserLoginLocked
+		if h.guard.fail(ctx, loginMethodSMS, req.Phone) {
+			lg.Code = errs.UserInvalidInput
+			ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "验证码错误"})
+		}
 		return
 	}
+	h.guard.success(ctx, loginMethodSMS, req.Phone)
 	//验证成功
 	u, err := h.svc.FindOrCreate(ctx.Request.Context(), req.Phone)
+	if err == service.ErrUserDeleted {
+		lg.Code = errs.UserDeleted
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserDeleted, Msg: "账号已注销"})
+		return
+	}
+	if err == service.ErrUserBanned {
+		lg.Code = errs.UserBanned
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserBanned, Msg: "账号已被封禁"})
+		return
+	}
 	if err != nil {
-		ctx.JSON(http.StatusOK, Result{Code: 500, Msg: "系统错误"})
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
 		return
 	}
+	lg.Uid = u.Id
 	//jwt
-	err = h.setJWT(ctx, u.Id)
+	lg.Ssid, err = h.setJWT(ctx, u.Id)
 	if err != nil {
-		ctx.JSON(http.StatusOK, Result{Code: 500, Msg: "系统错误"})
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
 		return
 	}
+	lg.Code = errs.Success
 	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "登录成功"})
 }
 
+// normalizePhone 格式不对的时候直接返回错误给前端
+func (h *UserHandler) normalizePhone(ctx *gin.Context, phone string) (string, bool) {
+	res, err := h.phones.Normalize(phone)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "手机号格式不对"})
+		return "", false
+	}
+	return res, true
+}
+
+type SendSMSReq struct {
+	Phone string `json:"phone" binding:"phone"`
+	CaptchaReq
+}
+
 func (h *UserHandler) SendSMS(ctx *gin.Context) {
-	type Req struct {
-		Phone string `json:"phone"`
+	var req SendSMSReq
+	if !ginx.Bind(ctx, &req) {
+		return
+	}
+	phone, ok := h.normalizePhone(ctx, req.Phone)
+	if !ok {
+		return
 	}
-	var req Req
-	if err := ctx.Bind(&req); err != nil {
+	if !h.risk.check(ctx, "login_sms", req.CaptchaReq) {
 		return
 	}
-	err := h.codeSvc.Send(ctx.Request.Context(), "login", req.Phone)
+	err := h.codeSvc.Send(ctx.Request.Context(), "login", phone)
 	if err == service.ErrCodeSendTooMany {
-		ctx.JSON(http.StatusOK, Result{Code: 400, Msg: "发送频繁"})
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "发送频繁"})
 		return
 	}
 	if err != nil {
-		ctx.JSON(http.StatusOK, Result{Code: 500, Msg: "系统错误"})
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
 		return
 	}
 	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "发送成功"})
 }
 
 func (h *UserHandler) RefreshToken(ctx *gin.Context) {
+	// 刷新失败都是 401，成功的时候再改成 200
+	lg := h.newLoginLog(ctx, domain.LoginActionRefresh, "")
+	lg.Code = http.StatusUnauthorized
+	defer h.audit(ctx, lg)
 	t := ExtractToken(ctx)
 	claims := &RefreshClaims{}
-	token, err := jwt.ParseWithClaims(t, claims, func(token *jwt.Token) (interface{}, error) {
-		return RtKey, nil
-	})
+	token, err := jwt.ParseWithClaims(t, claims, h.keys.Refresh.Keyfunc)
 
 	if err != nil {
 		ctx.AbortWithStatus(http.StatusUnauthorized)
@@ -233,8 +526,47 @@ func (h *UserHandler) RefreshToken(ctx *gin.Context) {
 		return
 	}
 
-	logout, err := h.cmd.Exists(ctx, fmt.Sprintf("user:ssid:%s", claims.Ssid)).Result()
-	if logout > 0 || err != nil {
+	lg.Uid = claims.Uid
+	lg.Ssid = claims.Ssid
+	// 引入 jti 之前签发的长 token 没有 ID，让用户重新登录
+	if claims.ID == "" {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	err = CheckSession(ctx, h.cmd, claims.Ssid)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	err = CheckBanned(ctx, h.cmd, claims.Uid)
+	if err == ErrUserBanned {
+		lg.Code = errs.UserBanned
+		ctx.AbortWithStatusJSON(http.StatusForbidden, Result{Code: errs.UserBanned, Msg: "账号已被封禁"})
+		return
+	}
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	err = h.consumeRefreshToken(ctx, claims)
+	if err == errRefreshTokenReused {
+		// 用过的长 token 又出现了，说明有两个人拿着同一个 token，
+		// 分不清谁是正主，整个 ssid 都下线
+		zap.L().Warn("检测到长 token 重复使用，下线整个会话",
+			zap.Int64("uid", claims.Uid), zap.String("ssid", claims.Ssid), zap.String("ip", ctx.ClientIP()))
+		er := h.revokeSession(ctx, claims.Uid, claims.Ssid)
+		if er == errSessionNotFound {
+			er = h.clearToken(ctx, claims.Ssid)
+		}
+		if er != nil {
+			zap.L().Error("下线会话失败", zap.Error(er), zap.String("ssid", claims.Ssid))
+		}
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
 		ctx.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
@@ -244,7 +576,138 @@ func (h *UserHandler) RefreshToken(ctx *gin.Context) {
 		ctx.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
+	// 长 token 也换一个新的，老的已经作废了
+	err = h.setRefreshToken(ctx, claims.Uid, claims.Ssid)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	err = h.touchSession(ctx, claims.Uid, claims.Ssid)
+	if err != nil {
+		// 不影响刷新
+		zap.L().Warn("更新会话活跃时间失败", zap.Error(err), zap.String("ssid", claims.Ssid))
+	}
+	lg.Code = errs.Success
 	ctx.JSON(http.StatusOK, Result{
 		Msg: "刷新成功",
 	})
 }
+
+type SendResetPasswordCodeReq struct {
+	Phone string `json:"phone" binding:"omitempty,phone"`
+	Email string `json:"email" binding:"omitempty,email"`
+	CaptchaReq
+}
+
+// SendResetPasswordCode 发送重置密码的验证码，手机号和邮箱二选一
+func (h *UserHandler) SendResetPasswordCode(ctx *gin.Context) {
+	var req SendResetPasswordCodeReq
+	if !ginx.Bind(ctx, &req) {
+		return
+	}
+	if req.Phone != "" || req.Email != "" {
+		// 邮件一样有成本，也一样可以拿来骚扰别人
+		if !h.risk.check(ctx, "reset_pwd", req.CaptchaReq) {
+			return
+		}
+	}
+	var err error
+	switch {
+	case req.Email != "":
+		err = h.codeSvc.SendEmail(ctx.Request.Context(), bizResetPwd, req.Email)
+	case req.Phone != "":
+		phone, ok := h.normalizePhone(ctx, req.Phone)
+		if !ok {
+			return
+		}
+		err = h.codeSvc.Send(ctx.Request.Context(), bizResetPwd, phone)
+	default:
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "请输入手机号或者邮箱"})
+		return
+	}
+	if err == service.ErrCodeSendTooMany {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "发送频繁"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("发送重置密码验证码失败", zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "发送成功"})
+}
+
+type ResetPasswordReq struct {
+	Phone      string `json:"phone" binding:"omitempty,phone"`
+	Email      string `json:"email" binding:"omitempty,email"`
+	InputCode  string `json:"input_code" binding:"required"`
+	Password   string `json:"password" binding:"password"`
+	RePassword string `json:"rePassword" binding:"eqfield=Password"`
+}
+
+func (h *UserHandler) ResetPassword(ctx *gin.Context) {
+	var req ResetPasswordReq
+	if !ginx.Bind(ctx, &req) {
+		return
+	}
+	if req.Email == "" && req.Phone != "" {
+		phone, valid := h.normalizePhone(ctx, req.Phone)
+		if !valid {
+			return
+		}
+		req.Phone = phone
+	}
+	target := req.Email
+	if target == "" {
+		target = req.Phone
+	}
+	if target == "" {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "请输入手机号或者邮箱"})
+		return
+	}
+
+	ok, err := h.codeSvc.Verify(ctx.Request.Context(), bizResetPwd, target, req.InputCode)
+	if err == service.ErrCodeVerifyTooManyTimes {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "验证次数太多，请重新获取验证码"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("校验重置密码验证码出错", zap.Error(err))
+		return
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "验证码错误"})
+		return
+	}
+
+	var u domain.User
+	if req.Email != "" {
+		u, err = h.svc.ResetPasswordByEmail(ctx.Request.Context(), req.Email, req.Password)
+	} else {
+		u, err = h.svc.ResetPasswordByPhone(ctx.Request.Context(), req.Phone, req.Password)
+	}
+	switch err {
+	case nil:
+	case service.ErrUserNotFound:
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "用户不存在"})
+		return
+	case service.ErrUserBanned:
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserBanned, Msg: "账号已被封禁"})
+		return
+	case service.ErrUserDeleted:
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserDeleted, Msg: "账号已注销"})
+		return
+	default:
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	// 密码已经改了，之前所有的登录都要失效，防止长 token 被偷
+	err = h.clearAllTokens(ctx, u.Id)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("重置密码后清除登录态失败", zap.Error(err), zap.Int64("uid", u.Id))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "重置密码成功"})
+}
@@ -0,0 +1,215 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/errs"
+	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/pkg/ginx"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type SendBindPhoneCodeReq struct {
+	Phone string `json:"phone" binding:"phone"`
+}
+
+func (h *UserHandler) SendBindPhoneCode(ctx *gin.Context) {
+	var req SendBindPhoneCodeReq
+	if !ginx.Bind(ctx, &req) {
+		return
+	}
+	phone, ok := h.normalizePhone(ctx, req.Phone)
+	if !ok {
+		return
+	}
+	err := h.codeSvc.Send(ctx.Request.Context(), bizBindPhone, phone)
+	h.handleSendCodeErr(ctx, err)
+}
+
+type BindPhoneReq struct {
+	Phone     string `json:"phone" binding:"phone"`
+	InputCode string `json:"input_code" binding:"required"`
+}
+
+func (h *UserHandler) BindPhone(ctx *gin.Context) {
+	var req BindPhoneReq
+	if !ginx.Bind(ctx, &req) {
+		return
+	}
+	phone, ok := h.normalizePhone(ctx, req.Phone)
+	if !ok {
+		return
+	}
+	req.Phone = phone
+	if !h.verifyCode(ctx, bizBindPhone, req.Phone, req.InputCode) {
+		return
+	}
+	uc := ctx.MustGet("claims").(*UserClaims)
+	owner, err := h.svc.BindPhone(ctx.Request.Context(), uc.Uid, req.Phone)
+	handleBindErr(ctx, h.cmd, uc.Uid, owner, err)
+}
+
+type SendBindEmailCodeReq struct {
+	Email string `json:"email" binding:"email"`
+}
+
+func (h *UserHandler) SendBindEmailCode(ctx *gin.Context) {
+	var req SendBindEmailCodeReq
+	if !ginx.Bind(ctx, &req) {
+		return
+	}
+	err := h.codeSvc.SendEmail(ctx.Request.Context(), bizBindEmail, req.Email)
+	h.handleSendCodeErr(ctx, err)
+}
+
+type BindEmailReq struct {
+	Email      string `json:"email" binding:"email"`
+	InputCode  string `json:"input_code" binding:"required"`
+	Password   string `json:"password" binding:"password"`
+	RePassword string `json:"rePassword" binding:"eqfield=Password"`
+}
+
+// BindEmail 绑定邮箱的同时设置密码，之后就可以用邮箱密码登录
+func (h *UserHandler) BindEmail(ctx *gin.Context) {
+	var req BindEmailReq
+	if !ginx.Bind(ctx, &req) {
+		return
+	}
+	if !h.verifyCode(ctx, bizBindEmail, req.Email, req.InputCode) {
+		return
+	}
+	uc := ctx.MustGet("claims").(*UserClaims)
+	owner, err := h.svc.BindEmail(ctx.Request.Context(), uc.Uid, req.Email, req.Password)
+	handleBindErr(ctx, h.cmd, uc.Uid, owner, err)
+}
+
+type UnbindReq struct {
+	// Method phone, email 或者 wechat
+	Method string `json:"method"`
+}
+
+func (h *UserHandler) Unbind(ctx *gin.Context) {
+	var req UnbindReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	method := domain.LoginMethod(req.Method)
+	switch method {
+	case domain.LoginMethodPhone, domain.LoginMethodEmail, domain.LoginMethodWechat:
+	default:
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "未知的登录方式"})
+		return
+	}
+	uc := ctx.MustGet("claims").(*UserClaims)
+	err := h.svc.Unbind(ctx.Request.Context(), uc.Uid, method)
+	if err == service.ErrLastLoginMethod {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserLastLoginMethod, Msg: "至少要保留一种登录方式"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("解绑失败", zap.Error(err), zap.Int64("uid", uc.Uid))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "解绑成功"})
+}
+
+type MergeReq struct {
+	Ticket string `json:"ticket"`
+}
+
+// Merge 用绑定冲突时拿到的凭证，把另外一个账号合并到当前账号
+func (h *UserHandler) Merge(ctx *gin.Context) {
+	var req MergeReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("claims").(*UserClaims)
+	t, err := consumeMergeTicket(ctx, h.cmd, req.Ticket, uc.Uid)
+	if err == errMergeTicketInvalid {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "合并凭证无效或者已经过期"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	err = h.svc.Merge(ctx.Request.Context(), t.From, t.To)
+	if err == service.ErrUserBanned {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserBanned, Msg: "要合并的账号已被封禁"})
+		return
+	}
+	if err == service.ErrUserDeleted {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserDeleted, Msg: "要合并的账号已注销"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("合并账号失败", zap.Error(err),
+			zap.Int64("from", t.From), zap.Int64("to", t.To))
+		return
+	}
+	// 被合并的账号已经没有登录方式了，之前的登录也要失效
+	err = h.clearAllTokens(ctx, t.From)
+	if err != nil {
+		zap.L().Error("清除被合并账号的登录态失败", zap.Error(err), zap.Int64("uid", t.From))
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "合并成功"})
+}
+
+func (h *UserHandler) handleSendCodeErr(ctx *gin.Context, err error) {
+	if err == service.ErrCodeSendTooMany {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "发送频繁"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("发送验证码失败", zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "发送成功"})
+}
+
+// verifyCode 校验失败的时候已经写好了响应
+func (h *UserHandler) verifyCode(ctx *gin.Context, biz, target, inputCode string) bool {
+	ok, err := h.codeSvc.Verify(ctx.Request.Context(), biz, target, inputCode)
+	if err == service.ErrCodeVerifyTooManyTimes {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "验证次数太多，请重新获取验证码"})
+		return false
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("校验验证码出错", zap.Error(err), zap.String("biz", biz))
+		return false
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "验证码错误"})
+		return false
+	}
+	return true
+}
+
+// handleBindErr 微信绑定也要用
+func handleBindErr(ctx *gin.Context, cmd redis.Cmdable, uid int64, owner domain.User, err error) {
+	if err == service.ErrIdentityConflict {
+		ticket, er := newMergeTicket(ctx, cmd, owner.Id, uid)
+		if er != nil {
+			ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+			return
+		}
+		ctx.JSON(http.StatusOK, Result{
+			Code: errs.UserIdentityConflict,
+			Msg:  "已经被另外一个账号绑定，可以使用凭证合并账号",
+			Data: ticket,
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("绑定失败", zap.Error(err), zap.Int64("uid", uid))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "绑定成功"})
+}
@@ -0,0 +1,86 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/errs"
+	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/pkg/ginx"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+const loginMethodEmailLink = "email_link"
+
+type SendLoginEmailReq struct {
+	Email string `json:"email" binding:"email"`
+	CaptchaReq
+}
+
+// SendLoginEmail 发送登录链接，不管邮箱有没有注册
+func (h *UserHandler) SendLoginEmail(ctx *gin.Context) {
+	var req SendLoginEmailReq
+	if !ginx.Bind(ctx, &req) {
+		return
+	}
+	if !h.risk.check(ctx, "login_email", req.CaptchaReq) {
+		return
+	}
+	err := h.linkSvc.Send(ctx.Request.Context(), req.Email)
+	if err == service.ErrMagicLinkSendTooMany {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "发送太频繁，请稍后再试"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("发送登录链接失败", zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "登录链接已发送，请查收邮件"})
+}
+
+type LoginEmailReq struct {
+	// Token 前端从登录链接的 query 里面取出来
+	Token string `json:"token" binding:"required"`
+}
+
+// LoginEmail 用登录链接登录，没有注册的邮箱会自动注册
+func (h *UserHandler) LoginEmail(ctx *gin.Context) {
+	var req LoginEmailReq
+	if !ginx.Bind(ctx, &req) {
+		return
+	}
+	lg := h.newLoginLog(ctx, domain.LoginActionLogin, loginMethodEmailLink)
+	defer h.audit(ctx, lg)
+	email, err := h.linkSvc.Verify(ctx.Request.Context(), req.Token)
+	if err == service.ErrInvalidMagicLink {
+		lg.Code = errs.UserInvalidInput
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "登录链接无效或者已经过期，请重新获取"})
+		return
+	}
+	if err != nil {
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("校验登录链接失败", zap.Error(err))
+		return
+	}
+	lg.Account = email
+	u, err := h.svc.FindOrCreateByEmail(ctx.Request.Context(), email)
+	switch err {
+	case nil:
+	case service.ErrUserDeleted:
+		lg.Code = errs.UserDeleted
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserDeleted, Msg: "账号已注销"})
+		return
+	case service.ErrUserBanned:
+		lg.Code = errs.UserBanned
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserBanned, Msg: "账号已被封禁"})
+		return
+	default:
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("邮件登录查找或者创建用户失败", zap.Error(err))
+		return
+	}
+	h.loginWithMFA(ctx, lg, u.Id, "登录成功")
+}
@@ -0,0 +1,201 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/errs"
+	"github.com/jym0818/webook/internal/service"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const loginMethod2FA = "2fa"
+
+// mfaPendingExpiration 密码校验通过之后，要在这个时间内完成两步验证
+const mfaPendingExpiration = time.Minute * 5
+
+type TOTPEnrollVO struct {
+	Secret string `json:"secret"`
+	// URI otpauth:// 链接，前端转成二维码
+	URI string `json:"uri"`
+}
+
+// newMFAPendingToken 密码已经校验通过，但是还差两步验证，这个时候只发一个临时凭证，不发 JWT
+func newMFAPendingToken(ctx context.Context, cmd redis.Cmdable, uid int64) (string, error) {
+	token := uuid.New().String()
+	err := cmd.Set(ctx, mfaPendingKey(token), uid, mfaPendingExpiration).Err()
+	return token, err
+}
+
+func mfaPendingKey(token string) string {
+	return fmt.Sprintf("user:mfa_pending:%s", token)
+}
+
+// loginWithMFA 第一步已经校验通过了，开启了两步验证的只发临时凭证，没有开启的直接登录。
+// 密码、邮件登录链接、注册验证都是拿邮箱登录，都要走这里，不然能进邮箱就能绕过两步验证
+func (h *UserHandler) loginWithMFA(ctx *gin.Context, lg *domain.LoginLog, uid int64, msg string) {
+	lg.Uid = uid
+	enabled, err := h.mfaSvc.Enabled(ctx.Request.Context(), uid)
+	if err != nil {
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	if enabled {
+		token, er := newMFAPendingToken(ctx, h.cmd, uid)
+		if er != nil {
+			lg.Code = errs.UserInternalServerError
+			ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+			return
+		}
+		lg.Code = errs.UserMFARequired
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserMFARequired, Msg: "请输入两步验证码", Data: token})
+		return
+	}
+	lg.Ssid, err = h.setJWT(ctx, uid)
+	if err != nil {
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	lg.Code = errs.Success
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: msg})
+}
+
+type LoginMFAReq struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+func (h *UserHandler) LoginMFA(ctx *gin.Context) {
+	var req LoginMFAReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	lg := h.newLoginLog(ctx, domain.LoginActionLogin, loginMethod2FA)
+	defer h.audit(ctx, lg)
+	uid, err := h.cmd.Get(ctx, mfaPendingKey(req.MFAToken)).Int64()
+	if err == redis.Nil {
+		lg.Code = errs.UserInvalidInput
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "凭证已过期，请重新登录"})
+		return
+	}
+	if err != nil {
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("查询两步验证凭证失败", zap.Error(err))
+		return
+	}
+	lg.Uid = uid
+	account := strconv.FormatInt(uid, 10)
+	if !h.guard.check(ctx, loginMethod2FA, account) {
+		lg.Code = errs.UserLoginLocked
+		return
+	}
+	err = h.mfaSvc.Verify(ctx.Request.Context(), uid, req.Code)
+	if err == service.ErrInvalidMFACode {
+		lg.Code = errs.UserLoginLocked
+		if h.guard.fail(ctx, loginMethod2FA, account) {
+			lg.Code = errs.UserInvalidInput
+			ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "验证码错误"})
+		}
+		return
+	}
+	if err != nil {
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("两步验证失败", zap.Error(err), zap.Int64("uid", uid))
+		return
+	}
+	// 凭证只能用一次，并发的请求只有一个能拿到
+	n, err := h.cmd.Del(ctx, mfaPendingKey(req.MFAToken)).Result()
+	if err != nil {
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	if n == 0 {
+		lg.Code = errs.UserInvalidInput
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "凭证已过期，请重新登录"})
+		return
+	}
+	h.guard.success(ctx, loginMethod2FA, account)
+	lg.Ssid, err = h.setJWT(ctx, uid)
+	if err != nil {
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	lg.Code = errs.Success
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "登录成功"})
+}
+
+func (h *UserHandler) EnrollTOTP(ctx *gin.Context, uc *UserClaims) (Result, error) {
+	u, err := h.svc.Profile(ctx.Request.Context(), uc.Uid)
+	if err != nil {
+		return errUserInternal, err
+	}
+	// 两步验证只保护密码登录，没有邮箱的账号用不上
+	if u.Email == "" {
+		return Result{Code: errs.UserInvalidInput, Msg: "请先绑定邮箱和密码"}, nil
+	}
+	secret, uri, err := h.mfaSvc.EnrollTOTP(ctx.Request.Context(), uc.Uid, u.Email)
+	if err != nil {
+		return errUserInternal, err
+	}
+	return Result{Code: 200, Msg: "ok", Data: TOTPEnrollVO{Secret: secret, URI: uri}}, nil
+}
+
+type ConfirmTOTPReq struct {
+	Code string `json:"code"`
+}
+
+func (h *UserHandler) ConfirmTOTP(ctx *gin.Context, req ConfirmTOTPReq, uc *UserClaims) (Result, error) {
+	codes, err := h.mfaSvc.ConfirmTOTP(ctx.Request.Context(), uc.Uid, req.Code)
+	if err == service.ErrMFANotEnrolled {
+		// 登记的文案是给关闭的时候用的
+		return Result{Code: errs.UserInvalidInput, Msg: "请先获取密钥"}, nil
+	}
+	if err != nil {
+		return errUserInternal, err
+	}
+	// 恢复码只在这里返回一次
+	return Result{Code: 200, Msg: "开启成功，请妥善保存恢复码", Data: codes}, nil
+}
+
+type DisableTOTPReq struct {
+	Code string `json:"code"`
+}
+
+func (h *UserHandler) DisableTOTP(ctx *gin.Context) {
+	var req DisableTOTPReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("claims").(*UserClaims)
+	account := strconv.FormatInt(uc.Uid, 10)
+	if !h.guard.check(ctx, loginMethod2FA, account) {
+		return
+	}
+	err := h.mfaSvc.DisableTOTP(ctx.Request.Context(), uc.Uid, req.Code)
+	switch err {
+	case nil:
+		h.guard.success(ctx, loginMethod2FA, account)
+		ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "已关闭两步验证"})
+	case service.ErrInvalidMFACode:
+		if h.guard.fail(ctx, loginMethod2FA, account) {
+			ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "验证码错误"})
+		}
+	case service.ErrMFANotEnrolled:
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInvalidInput, Msg: "没有开启两步验证"})
+	default:
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("关闭两步验证失败", zap.Error(err), zap.Int64("uid", uc.Uid))
+	}
+}
@@ -0,0 +1,108 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/errs"
+	"github.com/jym0818/webook/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type stubUserSvc struct {
+	service.UserService
+	u domain.User
+}
+
+func (s *stubUserSvc) FindOrCreateByEmail(ctx context.Context, email string) (domain.User, error) {
+	return s.u, nil
+}
+
+func (s *stubUserSvc) ActivateByEmail(ctx context.Context, email string, password string) (domain.User, error) {
+	return s.u, nil
+}
+
+type stubLinkSvc struct {
+	service.MagicLinkService
+}
+
+func (stubLinkSvc) Verify(ctx context.Context, token string) (string, error) {
+	return "123@qq.com", nil
+}
+
+type stubCodeSvc struct {
+	service.CodeService
+}
+
+func (stubCodeSvc) Verify(ctx context.Context, biz string, phone string, code string) (bool, error) {
+	return true, nil
+}
+
+type stubMFASvc struct {
+	service.MFAService
+}
+
+func (stubMFASvc) Enabled(ctx context.Context, uid int64) (bool, error) {
+	return true, nil
+}
+
+type stubLogSvc struct {
+	service.LoginLogService
+	logs []domain.LoginLog
+}
+
+func (s *stubLogSvc) Record(ctx context.Context, l domain.LoginLog) {
+	s.logs = append(s.logs, l)
+}
+
+// 开启了两步验证的账号，能进邮箱也只能拿到临时凭证
+func TestUserHandler_EmailLoginRequiresMFA(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testCases := []struct {
+		name string
+		path string
+		body any
+	}{
+		{name: "邮件登录链接", path: "/user/login_email/verify", body: LoginEmailReq{Token: "token"}},
+		{
+			name: "注册验证",
+			path: "/user/signup/verify",
+			body: SignupVerifyReq{Email: "123@qq.com", InputCode: "123456",
+				Password: "hello#world123", RePassword: "hello#world123"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logSvc := &stubLogSvc{}
+			rdb := &memRedis{vals: map[string]string{}}
+			h := NewUserHandler(&stubUserSvc{u: domain.User{Id: 1, Status: domain.UserStatusActive}},
+				stubCodeSvc{}, stubMFASvc{}, stubLinkSvc{}, nil, logSvc, nil, rdb, JWTKeyrings{}, nil, nil, nil)
+			server := gin.New()
+			h.RegisterRoutes(server)
+
+			body, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, tc.path, bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+
+			var res Result
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+			assert.Equal(t, errs.UserMFARequired, res.Code)
+			assert.Empty(t, recorder.Header().Get("x-jwt-token"))
+			token, ok := res.Data.(string)
+			require.True(t, ok)
+			assert.Equal(t, "1", rdb.vals[mfaPendingKey(token)])
+			require.Len(t, logSvc.logs, 1)
+			assert.Equal(t, errs.UserMFARequired, logSvc.logs[0].Code)
+			assert.Empty(t, logSvc.logs[0].Ssid)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jym0818/webook/internal/errs"
+	"time"
+)
+
+type SessionVO struct {
+	Ssid      string `json:"ssid"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+	Ctime     string `json:"ctime"`
+	Utime     string `json:"utime"`
+	// Current 是不是发起这次请求的会话
+	Current bool `json:"current"`
+}
+
+func (h *UserHandler) Sessions(ctx *gin.Context, uc *UserClaims) (Result, error) {
+	sessions, err := h.listSessions(ctx, uc.Uid)
+	if err != nil {
+		return errUserInternal, err
+	}
+	res := make([]SessionVO, 0, len(sessions))
+	for _, s := range sessions {
+		res = append(res, SessionVO{
+			Ssid:      s.Ssid,
+			UserAgent: s.UserAgent,
+			IP:        s.IP,
+			Ctime:     time.UnixMilli(s.Ctime).Format(time.DateTime),
+			Utime:     time.UnixMilli(s.Utime).Format(time.DateTime),
+			Current:   s.Ssid == uc.Ssid,
+		})
+	}
+	return Result{Code: 200, Msg: "ok", Data: res}, nil
+}
+
+type RevokeSessionReq struct {
+	Ssid string `json:"ssid"`
+}
+
+func (h *UserHandler) RevokeSession(ctx *gin.Context, req RevokeSessionReq, uc *UserClaims) (Result, error) {
+	err := h.revokeSession(ctx, uc.Uid, req.Ssid)
+	if err == errSessionNotFound {
+		return Result{Code: errs.UserInvalidInput, Msg: "会话不存在"}, nil
+	}
+	if err != nil {
+		return errUserInternal, err
+	}
+	return Result{Code: 200, Msg: "ok"}, nil
+}
+
+// RevokeAllSessions 退出所有设备，包括当前这个
+func (h *UserHandler) RevokeAllSessions(ctx *gin.Context, uc *UserClaims) (Result, error) {
+	err := h.clearAllTokens(ctx, uc.Uid)
+	if err != nil {
+		return errUserInternal, err
+	}
+	ctx.Header("x-jwt-token", "")
+	ctx.Header("x-refresh-token", "")
+	return Result{Code: 200, Msg: "ok"}, nil
+}
@@ -0,0 +1,43 @@
+package web
+
+import (
+	"github.com/jym0818/webook/internal/domain"
+	"time"
+)
+
+// UserProfileVO 个人资料，注意不要把密码之类的敏感信息返回给前端
+type UserProfileVO struct {
+	Id       int64  `json:"id"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Nickname string `json:"nickname"`
+	// Birthday 格式是 2006-01-02，没有设置的时候是空字符串
+	Birthday string `json:"birthday"`
+	AboutMe  string `json:"about_me"`
+	Avatar   string `json:"avatar"`
+	Ctime    string `json:"ctime"`
+}
+
+func newUserProfileVO(u domain.User) UserProfileVO {
+	vo := UserProfileVO{
+		Id:       u.Id,
+		Email:    u.Email,
+		Phone:    u.Phone,
+		Nickname: u.Nickname,
+		AboutMe:  u.AboutMe,
+		Avatar:   u.Avatar,
+		Ctime:    u.Ctime.Format(time.DateTime),
+	}
+	if !u.Birthday.IsZero() {
+		vo.Birthday = u.Birthday.Format(time.DateOnly)
+	}
+	return vo
+}
+
+type UserEditReq struct {
+	Nickname string `json:"nickname"`
+	// Birthday 格式是 2006-01-02
+	Birthday string `json:"birthday"`
+	AboutMe  string `json:"about_me"`
+	Avatar   string `json:"avatar"`
+}
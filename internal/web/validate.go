@@ -0,0 +1,53 @@
+package web
+
+import (
+	regexp "github.com/dlclark/regexp2"
+	"github.com/go-playground/validator/v10"
+	"github.com/jym0818/webook/internal/errs"
+	"github.com/jym0818/webook/pkg/ginx"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const emailRegexPattern = "^\\w+([-+.]\\w+)*@\\w+([-.]\\w+)*\\.\\w+([-.]\\w+)*$"
+
+const passwordRegexPattern = `^(?=.*[A-Za-z])(?=.*\d)(?=.*[$@$!%*#?&])[A-Za-z\d$@$!%*#?&]{8,}$`
+
+// phoneRegexPattern 只是粗略地检查一下字符，区号和号码规则在 phonex 里面
+const phoneRegexPattern = `^\+?[\d\s\-().]{5,24}$`
+
+// maxTitleLen 标题最多多少个字
+const maxTitleLen = 256
+
+// 请求体在 binding 标签里面声明校验规则，gin 自带的 required、max 这些之外，
+// 这里注册业务上的规则。email 会覆盖 validator 自带的，和以前注册用的正则保持一致
+func init() {
+	ginx.SetInvalidInputError(ginx.NewError(errs.InvalidFields, "参数错误"))
+
+	ginx.RegisterValidation("email", regexpRule(emailRegexPattern), "邮箱格式不正确")
+	ginx.RegisterValidation("password", regexpRule(passwordRegexPattern),
+		"密码格式不正确，至少 8 位，包含字母、数字和特殊字符")
+	ginx.RegisterValidation("phone", regexpRule(phoneRegexPattern), "手机号格式不正确")
+	ginx.RegisterValidation("title", func(fl validator.FieldLevel) bool {
+		title := strings.TrimSpace(fl.Field().String())
+		return title != "" && utf8.RuneCountInString(title) <= maxTitleLen
+	}, "标题不能为空，最多 "+strconv.Itoa(maxTitleLen)+" 个字")
+	// maxbytes 按字节算长度，比如存到 BLOB 里面的内容
+	ginx.RegisterValidation("maxbytes", func(fl validator.FieldLevel) bool {
+		n, err := strconv.Atoi(fl.Param())
+		if err != nil {
+			panic("maxbytes 的参数必须是数字")
+		}
+		return len(fl.Field().String()) <= n
+	}, "不能超过 %s 字节")
+}
+
+func regexpRule(pattern string) validator.Func {
+	exp := regexp.MustCompile(pattern, regexp.None)
+	return func(fl validator.FieldLevel) bool {
+		// regexp2 只有超时才会返回 error
+		ok, err := exp.MatchString(fl.Field().String())
+		return err == nil && ok
+	}
+}
@@ -2,32 +2,37 @@ package web
 
 import (
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/jym0818/webook/internal/domain"
+	"github.com/jym0818/webook/internal/errs"
 	"github.com/jym0818/webook/internal/service"
 	"github.com/jym0818/webook/internal/service/oauth2/wechat"
-	uuid "github.com/lithammer/shortuuid/v4"
+	"github.com/jym0818/webook/pkg/openapi"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 	"net/http"
-	"time"
 )
 
 type OAuth2WechatHandler struct {
 	svc     wechat.Service
 	userSvc service.UserService
 	jwtHandler
-	stateKey []byte
-	cfg      Config
+	states *OAuth2StateStore
 }
+
+const wechatCallbackPath = "/oauth2/wechat/callback"
+
 type Config struct {
 	Secure bool
 }
 
-func NewOAuth2WechatHandler(svc wechat.Service, userSvc service.UserService, cfg Config) *OAuth2WechatHandler {
+func NewOAuth2WechatHandler(svc wechat.Service, userSvc service.UserService, roleSvc service.RoleService,
+	logSvc service.LoginLogService, states *OAuth2StateStore, cmd redis.Cmdable, keys JWTKeyrings,
+	binder *SessionBinder) *OAuth2WechatHandler {
 	return &OAuth2WechatHandler{
 		svc:        svc,
 		userSvc:    userSvc,
-		jwtHandler: jwtHandler{},
-		stateKey:   []byte("12345678912345678912345678912345"),
-		cfg:        cfg,
+		jwtHandler: newJWTHandler(cmd, keys, roleSvc, logSvc, binder),
+		states:     states,
 	}
 }
 
@@ -35,104 +40,144 @@ func (h *OAuth2WechatHandler) RegisterRoutes(s *gin.Engine) {
 	g := s.Group("/oauth2/wechat")
 	g.GET("/authurl", h.AuthURL)
 	g.Any("/callback", h.Callback)
+	// 已经登录的用户绑定微信
+	g.GET("/bind/authurl", h.BindAuthURL)
 }
 
-func (h *OAuth2WechatHandler) AuthURL(ctx *gin.Context) {
-	state := uuid.New()
-	url, err := h.svc.AuthURL(ctx.Request.Context(), state)
-	if err != nil {
-		ctx.JSON(http.StatusOK, Result{Code: 500, Msg: "构造扫码登录URL失败"})
-		return
+func (h *OAuth2WechatHandler) Docs() []openapi.Operation {
+	const tag = "微信登录"
+	return []openapi.Operation{
+		{Method: http.MethodGet, Path: "/oauth2/wechat/authurl", Summary: "微信扫码登录的地址", Tag: tag, Response: "", Public: true},
+		{Method: openapi.Any, Path: "/oauth2/wechat/callback", Summary: "微信回调，登录成功之后 token 在响应头里面", Tag: tag, Public: true},
+		{Method: http.MethodGet, Path: "/oauth2/wechat/bind/authurl", Summary: "已经登录的用户绑定微信", Tag: tag, Response: ""},
 	}
+}
+
+func (h *OAuth2WechatHandler) AuthURL(ctx *gin.Context) {
+	h.authURL(ctx, 0)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, StateClaims{
-		State: state,
-		RegisteredClaims: jwt.RegisteredClaims{
+func (h *OAuth2WechatHandler) BindAuthURL(ctx *gin.Context) {
+	uc := ctx.MustGet("claims").(*UserClaims)
+	h.authURL(ctx, uc.Uid)
+}
 
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
-		},
-	})
-	tokenStr, err := token.SignedString(h.stateKey)
+// authURL uid 不为 0 的时候，回调里面走绑定的逻辑
+func (h *OAuth2WechatHandler) authURL(ctx *gin.Context, uid int64) {
+	state, err := h.states.Create(ctx, wechatCallbackPath, uid)
 	if err != nil {
 		ctx.JSON(http.StatusOK, Result{
-			Code: 5,
+			Code: errs.UserInternalServerError,
 			Msg:  "系统错误",
 		})
 		return
 	}
-	ctx.SetCookie("jwt-state", tokenStr, 60*10,
-		"/oauth2/wechat/callback", "",
-		h.cfg.Secure, true)
-
-	ctx.JSON(http.StatusOK, Result{Code: 500, Data: url})
-}
-
-func (h *OAuth2WechatHandler) Callback(ctx *gin.Context) {
-	code := ctx.Query("code")
-	state := ctx.Query("state")
-	ck, err := ctx.Cookie("jwt-state")
+	url, err := h.svc.AuthURL(ctx.Request.Context(), state)
 	if err != nil {
-		//正常不会走这里  做好监控
-		ctx.JSON(http.StatusOK, Result{
-			Code: 5,
-			Msg:  "系统错误",
-		})
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "构造扫码登录URL失败"})
 		return
 	}
+	ctx.JSON(http.StatusOK, Result{Code: 200, Msg: "ok", Data: url})
+}
 
-	var sc StateClaims
-	token, err := jwt.ParseWithClaims(ck, &sc, func(token *jwt.Token) (interface{}, error) {
-		return h.stateKey, nil
-	})
-	if err != nil || !token.Valid {
-		ctx.JSON(http.StatusOK, Result{
-			Code: 4,
-			Msg:  "登录失败",
-		})
+func (h *OAuth2WechatHandler) Callback(ctx *gin.Context) {
+	code := ctx.Query("code")
+	lg := h.newLoginLog(ctx, domain.LoginActionLogin, string(domain.LoginMethodWechat))
+	binding := false
+	defer func() {
+		// 绑定不算登录，不写审计日志
+		if !binding {
+			h.audit(ctx, lg)
+		}
+	}()
+	uid, err := h.states.Verify(ctx, wechatCallbackPath)
+	if err != nil && err != errInvalidState {
+		lg.Code = errs.UserInternalServerError
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		zap.L().Error("校验微信 state 失败", zap.Error(err))
 		return
 	}
-
-	if sc.State != state {
-		//记录日志
+	if err != nil {
+		//正常不会走这里  做好监控
+		lg.Code = errs.UserInvalidInput
 		ctx.JSON(http.StatusOK, Result{
-			Code: 4,
+			Code: errs.UserInvalidInput,
 			Msg:  "登录失败",
 		})
 		return
 	}
 
-	info, err := h.svc.VerifyCode(ctx.Request.Context(), code, state)
+	info, err := h.svc.VerifyCode(ctx.Request.Context(), code)
 	if err != nil {
+		lg.Code = errs.UserInternalServerError
 		ctx.JSON(http.StatusOK, Result{
-			Code: 5,
+			Code: errs.UserInternalServerError,
 			Msg:  "系统错误",
 		})
+		zap.L().Error("微信换 token 失败", zap.Error(err))
+		return
+	}
+	if uid > 0 {
+		binding = true
+		owner, er := h.userSvc.BindWechat(ctx.Request.Context(), uid, info)
+		handleBindErr(ctx, h.cmd, uid, owner, er)
 		return
 	}
 	//登录成功了
 	u, err := h.userSvc.FindOrCreateByWechat(ctx, info)
+	if err == service.ErrUserDeleted {
+		lg.Code = errs.UserDeleted
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserDeleted, Msg: "账号已注销"})
+		return
+	}
+	if err == service.ErrUserBanned {
+		lg.Code = errs.UserBanned
+		ctx.JSON(http.StatusOK, Result{Code: errs.UserBanned, Msg: "账号已被封禁"})
+		return
+	}
 	if err != nil {
+		lg.Code = errs.UserInternalServerError
 		ctx.JSON(http.StatusOK, Result{
-			Code: 5,
+			Code: errs.UserInternalServerError,
 			Msg:  "系统错误",
 		})
 		return
 	}
+	lg.Uid = u.Id
+	h.fillProfile(ctx, u)
 	//jwt提取出来
-	err = h.setJWT(ctx, u.Id)
+	lg.Ssid, err = h.setJWT(ctx, u.Id)
 	if err != nil {
+		lg.Code = errs.UserInternalServerError
 		ctx.JSON(http.StatusOK, Result{
-			Code: 5,
+			Code: errs.UserInternalServerError,
 			Msg:  "系统错误",
 		})
 		return
 	}
+	lg.Code = errs.Success
 	ctx.JSON(http.StatusOK, Result{
-		Msg: "ok",
+		Code: 200,
+		Msg:  "登录成功",
 	})
 }
 
-type StateClaims struct {
-	State string
-	jwt.RegisteredClaims
+// fillProfile 第一次登录的时候用微信的昵称和头像，失败了也不影响登录
+func (h *OAuth2WechatHandler) fillProfile(ctx *gin.Context, u domain.User) {
+	if u.Nickname != "" || u.Avatar != "" {
+		return
+	}
+	p, err := h.svc.Profile(ctx.Request.Context(), u.WechatInfo.OpenID)
+	if err != nil {
+		zap.L().Warn("拉取微信用户资料失败", zap.Error(err), zap.Int64("uid", u.Id))
+		return
+	}
+	err = h.userSvc.UpdateNonSensitiveInfo(ctx.Request.Context(), domain.User{
+		Id:       u.Id,
+		Nickname: p.Nickname,
+		Avatar:   p.Avatar,
+	})
+	if err != nil {
+		zap.L().Warn("保存微信用户资料失败", zap.Error(err), zap.Int64("uid", u.Id))
+	}
 }
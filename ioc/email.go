@@ -0,0 +1,48 @@
+package ioc
+
+import (
+	"github.com/jym0818/webook/internal/repository"
+	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/internal/service/email"
+	"github.com/jym0818/webook/internal/service/email/memory"
+	"github.com/jym0818/webook/internal/service/email/smtp"
+	"github.com/spf13/viper"
+)
+
+func InitEmail() email.Service {
+	type Config struct {
+		Host     string `yaml:"host"`
+		Port     int    `yaml:"port"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+		From     string `yaml:"from"`
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("email.smtp", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	// 没有配置 SMTP 的时候，开发环境直接用内存实现
+	if cfg.Host == "" {
+		return memory.NewService()
+	}
+	return smtp.NewService(cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.From)
+}
+
+func InitMagicLinkService(repo repository.MagicLinkRepository, emailSvc email.Service) service.MagicLinkService {
+	type Config struct {
+		// Secret 给登录链接签名用的，至少 32 个字符
+		Secret string `yaml:"secret"`
+		// URL 前端的邮件登录页面，页面从 query 里面取出 token 调用 /user/login_email/verify
+		URL string `yaml:"url"`
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("user.magicLink", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	if len(cfg.Secret) < 32 || cfg.URL == "" {
+		panic("user.magicLink 没有配置 secret 或者 url")
+	}
+	return service.NewmagicLinkService(repo, emailSvc, []byte(cfg.Secret), cfg.URL)
+}
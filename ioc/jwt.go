@@ -0,0 +1,87 @@
+package ioc
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jym0818/webook/internal/web"
+	"github.com/jym0818/webook/pkg/jwtx"
+	"github.com/spf13/viper"
+	"os"
+)
+
+func InitJWTKeyrings() web.JWTKeyrings {
+	return web.JWTKeyrings{
+		Access:  initKeyring("jwt.access", web.AtKey),
+		Refresh: initKeyring("jwt.refresh", web.RtKey),
+	}
+}
+
+// initKeyring 没有配置密钥的时候，退化成老的 HMAC 密钥
+func initKeyring(key string, legacy []byte) *jwtx.Keyring {
+	type KeyConfig struct {
+		Kid string `yaml:"kid"`
+		// Alg RS256 或者 EdDSA
+		Alg string `yaml:"alg"`
+		// PrivateKeyFile 当前用来签名的密钥必须有私钥
+		PrivateKeyFile string `yaml:"privateKeyFile"`
+		// PublicKeyFile 轮换下来的老密钥只需要公钥
+		PublicKeyFile string `yaml:"publicKeyFile"`
+	}
+	type Config struct {
+		// Current 用来签名的密钥的 kid，其它的只用来校验
+		Current string      `yaml:"current"`
+		Keys    []KeyConfig `yaml:"keys"`
+		// Legacy 是否继续接受没有 kid 的老 token，轮换期过了就关掉
+		Legacy bool `yaml:"legacy"`
+	}
+	var cfg Config
+	err := viper.UnmarshalKey(key, &cfg)
+	if err != nil {
+		panic(err)
+	}
+	legacyKey := jwtx.HMACKey("", jwt.SigningMethodHS512, legacy)
+	if len(cfg.Keys) == 0 {
+		res, err := jwtx.NewKeyring(legacyKey)
+		if err != nil {
+			panic(err)
+		}
+		return res
+	}
+
+	var (
+		current jwtx.Key
+		olds    []jwtx.Key
+		found   bool
+	)
+	for _, kc := range cfg.Keys {
+		var privatePEM, publicPEM []byte
+		if kc.PrivateKeyFile != "" {
+			privatePEM, err = os.ReadFile(kc.PrivateKeyFile)
+		} else {
+			publicPEM, err = os.ReadFile(kc.PublicKeyFile)
+		}
+		if err != nil {
+			panic(err)
+		}
+		k, err := jwtx.ParseKey(kc.Kid, kc.Alg, privatePEM, publicPEM)
+		if err != nil {
+			panic(err)
+		}
+		if kc.Kid == cfg.Current {
+			current = k
+			found = true
+			continue
+		}
+		olds = append(olds, k)
+	}
+	if !found {
+		panic("jwt 配置里面找不到当前密钥 " + cfg.Current)
+	}
+	if cfg.Legacy {
+		olds = append(olds, legacyKey)
+	}
+	res, err := jwtx.NewKeyring(current, olds...)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
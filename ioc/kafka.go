@@ -2,6 +2,8 @@ package ioc
 
 import (
 	"github.com/IBM/sarama"
+	"github.com/jym0818/webook/internal/events/user"
+	"github.com/jym0818/webook/pkg/saramax"
 	"github.com/spf13/viper"
 )
 
@@ -30,3 +32,7 @@ func InitKafkaProducer(client sarama.Client) sarama.SyncProducer {
 	}
 	return producer
 }
+
+func NewConsumers(loginLog *user.LoginLogConsumer) []saramax.Consumer {
+	return []saramax.Consumer{loginLog}
+}
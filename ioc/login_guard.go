@@ -0,0 +1,24 @@
+package ioc
+
+import (
+	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/internal/web"
+	"github.com/jym0818/webook/pkg/ratelimit"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+func InitLoginGuard(cmd redis.Cmdable) *web.LoginGuard {
+	// 同一个账号 15 分钟内错 5 次锁 15 分钟，一天之内再被锁就翻倍，最多锁一天
+	account := ratelimit.NewRedisLockout(cmd, time.Minute*15, 5, time.Minute*15, time.Hour*24)
+	// IP 后面可能是一整个公司，阈值要放宽很多
+	ip := ratelimit.NewRedisLockout(cmd, time.Minute*15, 100, time.Minute*15, time.Hour*24)
+	return web.NewLoginGuard(account, ip)
+}
+
+func InitRiskPolicy(cmd redis.Cmdable, captchaSvc service.CaptchaService) *web.RiskPolicy {
+	// 正常用户一个小时发不了几次验证码，IP 后面可能是一整个公司，阈值放宽一些
+	ip := ratelimit.NewRedisSlideWindow(cmd, time.Hour, 20)
+	device := ratelimit.NewRedisSlideWindow(cmd, time.Hour, 5)
+	return web.NewRiskPolicy(captchaSvc, ip, device)
+}
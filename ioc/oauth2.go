@@ -0,0 +1,37 @@
+package ioc
+
+import (
+	"github.com/jym0818/webook/internal/service/oauth2"
+	"github.com/jym0818/webook/internal/service/oauth2/github"
+	"github.com/jym0818/webook/internal/service/oauth2/oidc"
+	"github.com/spf13/viper"
+)
+
+// InitOAuth2Providers 没有配置 clientId 的平台不启用
+func InitOAuth2Providers() oauth2.Providers {
+	var ghCfg github.Config
+	err := viper.UnmarshalKey("oauth2.github", &ghCfg)
+	if err != nil {
+		panic(err)
+	}
+	var oidcCfgs []oidc.Config
+	err = viper.UnmarshalKey("oauth2.oidc", &oidcCfgs)
+	if err != nil {
+		panic(err)
+	}
+	var ps []oauth2.Provider
+	if ghCfg.ClientID != "" {
+		ps = append(ps, github.NewProvider(ghCfg))
+	}
+	for _, cfg := range oidcCfgs {
+		if cfg.ClientID == "" || cfg.Name == "" {
+			continue
+		}
+		// wechat 有自己的 handler
+		if cfg.Name == "wechat" {
+			panic("oauth2.oidc 不能使用 wechat 这个名字")
+		}
+		ps = append(ps, oidc.NewProvider(cfg))
+	}
+	return oauth2.NewProviders(ps...)
+}
@@ -11,7 +11,8 @@ func InitRankingJob(svc service.RankingService) job.Job {
 	return job.NewRankingJob(svc, time.Second*30)
 }
 
-func InitCronJob(ranking job.Job) *cron.Cron {
+func InitCronJob(ranking job.Job, purge *job.UserPurgeJob, phone *job.UserPhoneJob,
+	smsRetry *job.SMSRetryJob) *cron.Cron {
 	res := cron.New(cron.WithSeconds())
 	cbd := job.NewCronJobBuilder()
 	// 这里每三分钟一次
@@ -19,5 +20,20 @@ func InitCronJob(ranking job.Job) *cron.Cron {
 	if err != nil {
 		panic(err)
 	}
+	// 每天凌晨三点清理注销的账号
+	_, err = res.AddJob("0 0 3 * * ?", cbd.Build(purge))
+	if err != nil {
+		panic(err)
+	}
+	// 每天凌晨四点迁移老的手机号，迁移完了之后就是一次空查询
+	_, err = res.AddJob("0 0 4 * * ?", cbd.Build(phone))
+	if err != nil {
+		panic(err)
+	}
+	// 每十秒重试一次发送失败的短信，验证码等不了太久
+	_, err = res.AddJob("*/10 * * * * ?", cbd.Build(smsRetry))
+	if err != nil {
+		panic(err)
+	}
 	return res
 }
@@ -0,0 +1,42 @@
+package ioc
+
+import (
+	"fmt"
+	"github.com/jym0818/webook/internal/web"
+	"github.com/spf13/viper"
+)
+
+func InitSessionBinder() *web.SessionBinder {
+	type Config struct {
+		// Policy none、ua、device 或者 ip
+		Policy string `yaml:"policy"`
+		// Enforce 为 false 的时候对不上只记日志和打点，不拒绝请求
+		Enforce    bool `yaml:"enforce"`
+		IPv4Prefix int  `yaml:"ipv4Prefix"`
+		IPv6Prefix int  `yaml:"ipv6Prefix"`
+	}
+	cfg := Config{
+		Policy:     "ua",
+		Enforce:    true,
+		IPv4Prefix: 24,
+		IPv6Prefix: 64,
+	}
+	err := viper.UnmarshalKey("session.binding", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	var policy web.BindingPolicy
+	switch cfg.Policy {
+	case "none":
+		policy = web.NoneBinding{}
+	case "ua":
+		policy = web.UABinding{}
+	case "device":
+		policy = web.DeviceBinding{}
+	case "ip":
+		policy = web.NewIPBinding(cfg.IPv4Prefix, cfg.IPv6Prefix)
+	default:
+		panic(fmt.Errorf("不支持的会话绑定策略 %s", cfg.Policy))
+	}
+	return web.NewSessionBinder(policy, cfg.Enforce)
+}
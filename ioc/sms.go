@@ -1,20 +1,153 @@
 package ioc
 
 import (
+	"fmt"
+	"github.com/jym0818/webook/internal/repository"
 	"github.com/jym0818/webook/internal/service/sms"
+	"github.com/jym0818/webook/internal/service/sms/aliyun"
+	"github.com/jym0818/webook/internal/service/sms/async"
+	"github.com/jym0818/webook/internal/service/sms/failover"
 	"github.com/jym0818/webook/internal/service/sms/logger"
 	"github.com/jym0818/webook/internal/service/sms/memory"
 	"github.com/jym0818/webook/internal/service/sms/ratelimit"
+	"github.com/jym0818/webook/internal/service/sms/router"
+	"github.com/jym0818/webook/internal/service/sms/tencent"
+	"github.com/jym0818/webook/job"
+	"github.com/jym0818/webook/pkg/phonex"
 	ratelimit2 "github.com/jym0818/webook/pkg/ratelimit"
 	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
+	tencentsms "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/sms/v20210111"
+	"net/http"
 	"time"
 )
 
-func InitSMS(cmd redis.Cmdable) sms.Service {
-	smsSvc := memory.NewService()
+// SMSProviderConfig 一个短信服务商，Provider 不配置的时候使用内存实现
+type SMSProviderConfig struct {
+	Provider string
+	Tencent  struct {
+		SecretId  string
+		SecretKey string
+		Region    string
+		AppId     string
+		SignName  string
+	}
+	Aliyun struct {
+		AccessKeyId     string
+		AccessKeySecret string
+		SignName        string
+		// Endpoint 不配置的时候用阿里云的公网地址
+		Endpoint string
+		// Templates 默认模板 ID 到阿里云模板的映射，阿里云的模板参数要有名字
+		Templates map[string]aliyun.Template
+	}
+	// Backups 主服务商发送失败的时候，依次换成备用的服务商
+	Backups []SMSProviderConfig
+}
+
+func InitSMS(cmd redis.Cmdable, repo repository.AsyncSmsRepository) *async.Service {
+	type Config struct {
+		Default SMSProviderConfig
+		// Async 同步发送失败之后的重试，MaxAttempts 包括第一次发送，小于等于 1 的时候不重试
+		Async struct {
+			MaxAttempts  int
+			InitInterval time.Duration
+			MaxInterval  time.Duration
+			// TTL 过了这么久就不再重试，要和验证码的有效期一致
+			TTL time.Duration
+		}
+		// Routes 按国际区号路由，没有匹配上的走 Default
+		Routes []struct {
+			SMSProviderConfig `mapstructure:",squash"`
+			CallingCodes      []string
+			// Templates 默认模板 ID 到这个地区模板 ID 的映射
+			Templates map[string]string
+		}
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("sms", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	routes := make(map[string]router.Route)
+	for _, r := range cfg.Routes {
+		route := router.Route{Svc: newSMSProvider(r.SMSProviderConfig), Templates: r.Templates}
+		for _, code := range r.CallingCodes {
+			if _, ok := routes[code]; ok {
+				panic(fmt.Sprintf("短信路由重复配置了区号 %s", code))
+			}
+			routes[code] = route
+		}
+	}
+	smsSvc := router.NewService(newSMSProvider(cfg.Default), routes)
 
 	l := ratelimit2.NewRedisSlideWindow(cmd, time.Second, 2000)
 	ratelimitSvc := ratelimit.NewService(smsSvc, l)
 	loggerSvc := logger.NewService(ratelimitSvc)
-	return loggerSvc
+	a := cfg.Async
+	if a.InitInterval <= 0 {
+		a.InitInterval = time.Second * 10
+	}
+	if a.MaxInterval < a.InitInterval {
+		a.MaxInterval = time.Minute * 10
+	}
+	if a.TTL <= 0 {
+		// 验证码的有效期是 10 分钟，见 set_code.lua
+		a.TTL = time.Minute * 10
+	}
+	return async.NewService(loggerSvc, repo, a.MaxAttempts, a.InitInterval, a.MaxInterval, a.TTL)
+}
+
+func InitSMSRetryJob(svc *async.Service) *job.SMSRetryJob {
+	return job.NewSMSRetryJob(svc, time.Minute)
+}
+
+func newSMSProvider(cfg SMSProviderConfig) sms.Service {
+	svc := newSMSClient(cfg)
+	if len(cfg.Backups) == 0 {
+		return svc
+	}
+	svcs := []sms.Service{svc}
+	for _, b := range cfg.Backups {
+		svcs = append(svcs, newSMSProvider(b))
+	}
+	return failover.NewFailoverService(svcs)
+}
+
+func newSMSClient(cfg SMSProviderConfig) sms.Service {
+	switch cfg.Provider {
+	case "", "memory":
+		return memory.NewService()
+	case "tencent":
+		c := cfg.Tencent
+		client, err := tencentsms.NewClient(common.NewCredential(c.SecretId, c.SecretKey),
+			c.Region, profile.NewClientProfile())
+		if err != nil {
+			panic(err)
+		}
+		return tencent.NewService(client, c.AppId, c.SignName)
+	case "aliyun":
+		c := cfg.Aliyun
+		if c.AccessKeyId == "" || c.AccessKeySecret == "" || c.SignName == "" {
+			panic("阿里云短信没有配置 accessKeyId、accessKeySecret 或者 signName")
+		}
+		return aliyun.NewService(&http.Client{Timeout: 5 * time.Second}, c.Endpoint,
+			c.AccessKeyId, c.AccessKeySecret, c.SignName, c.Templates)
+	default:
+		panic(fmt.Sprintf("未知的短信服务商 %s", cfg.Provider))
+	}
+}
+
+func InitPhoneParser() *phonex.Parser {
+	region := viper.GetString("phone.defaultRegion")
+	if region == "" {
+		region = "CN"
+	}
+	p, err := phonex.NewParser(region)
+	if err != nil {
+		panic(err)
+	}
+	return p
 }
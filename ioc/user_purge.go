@@ -0,0 +1,26 @@
+package ioc
+
+import (
+	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/job"
+	"github.com/jym0818/webook/pkg/phonex"
+	"github.com/spf13/viper"
+	"time"
+)
+
+func InitUserPurgeJob(svc service.UserService) *job.UserPurgeJob {
+	type Config struct {
+		// WithdrawArticles 注销之后文章是下架，还是保留并显示成已注销用户
+		WithdrawArticles bool
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("user.deletion", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return job.NewUserPurgeJob(svc, time.Minute*10, cfg.WithdrawArticles)
+}
+
+func InitUserPhoneJob(svc service.UserService, phones *phonex.Parser) *job.UserPhoneJob {
+	return job.NewUserPhoneJob(svc, phones, time.Minute*10)
+}
@@ -6,22 +6,68 @@ import (
 	"github.com/jym0818/webook/internal/web"
 	"github.com/jym0818/webook/internal/web/middleware"
 	"github.com/jym0818/webook/pkg/ginx/metric"
+	"github.com/jym0818/webook/pkg/openapi"
 	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"strings"
 	"time"
 )
 
-func InitWeb(userHandler *web.UserHandler, mdls []gin.HandlerFunc, wechat *web.OAuth2WechatHandler, article *web.ArticleHandler) *gin.Engine {
+func InitWeb(userHandler *web.UserHandler, mdls []gin.HandlerFunc, wechat *web.OAuth2WechatHandler, article *web.ArticleHandler,
+	jwks *web.JWKSHandler, oauth2Hdl *web.OAuth2Handler, adminRole *web.AdminRoleHandler, adminUser *web.AdminUserHandler, captcha *web.CaptchaHandler) *gin.Engine {
+	server, _ := initWeb(userHandler, mdls, wechat, article, jwks, oauth2Hdl, adminRole, adminUser, captcha)
+	return server
+}
+
+// initWeb 返回文档是给测试用的，测试里面检查所有的路由都写了文档
+func initWeb(userHandler *web.UserHandler, mdls []gin.HandlerFunc, wechat *web.OAuth2WechatHandler, article *web.ArticleHandler,
+	jwks *web.JWKSHandler, oauth2Hdl *web.OAuth2Handler, adminRole *web.AdminRoleHandler, adminUser *web.AdminUserHandler, captcha *web.CaptchaHandler) (*gin.Engine, *openapi.Doc) {
 	server := gin.Default()
 	server.Use(mdls...)
 	userHandler.RegisterRoutes(server)
 	wechat.RegisterRoutes(server)
+	oauth2Hdl.RegisterRoutes(server)
 	article.RegisterRoutes(server)
-	return server
+	jwks.RegisterRoutes(server)
+	adminRole.RegisterRoutes(server)
+	adminUser.RegisterRoutes(server)
+	captcha.RegisterRoutes(server)
+
+	doc := openapi.NewDoc("webook", "1.0")
+	doc.Add(userHandler.Docs()...)
+	doc.Add(wechat.Docs()...)
+	doc.Add(oauth2Hdl.Docs()...)
+	doc.Add(article.Docs()...)
+	doc.Add(jwks.Docs()...)
+	doc.Add(adminRole.Docs()...)
+	doc.Add(adminUser.Docs()...)
+	doc.Add(captcha.Docs()...)
+	doc.RegisterRoutes(server)
+	return server, doc
 }
 
-func InitMiddlware(cmd redis.Cmdable) []gin.HandlerFunc {
+func InitMiddlware(cmd redis.Cmdable, keys web.JWTKeyrings, binder *web.SessionBinder) []gin.HandlerFunc {
+	login := middleware.NewLoginMiddlewareBuilder(cmd, keys.Access, binder).
+		IgnorePath("/user/login").
+		IgnorePath("/user/login/2fa").
+		IgnorePath("/user/signup").
+		IgnorePath("/user/signup/verify").
+		IgnorePath("/user/login_sms").
+		IgnorePath("/user/login_sms/send").
+		IgnorePath("/user/login_email/send").
+		IgnorePath("/user/login_email/verify").
+		IgnorePath("/user/refresh").
+		IgnorePath("/user/password/reset/send").
+		IgnorePath("/user/password/reset").
+		IgnorePath("/.well-known/jwks.json").
+		IgnorePath("/captcha").
+		IgnorePath("/openapi.json").
+		IgnorePath("/swagger").
+		// 微信和别的第三方登录都在这里
+		IgnorePattern("/oauth2/:provider/authurl").
+		IgnorePattern("/oauth2/:provider/callback").
+		// 点赞也在 /article/pub 下面，所以只匹配数字 id
+		OptionalPattern("/article/pub/[0-9]*")
 	return []gin.HandlerFunc{
 		corsHdl(),
 		otelgin.Middleware("webook"),
@@ -34,13 +80,7 @@ func InitMiddlware(cmd redis.Cmdable) []gin.HandlerFunc {
 		}).Build(),
 		////限流
 		//ratelimit.NewBuilder(cmd, time.Second, 100).Build(),
-		middleware.NewLoginMiddlewareBuilder(cmd).
-			IgnorePath("/user/login").
-			IgnorePath("/user/signup").
-			IgnorePath("/user/login_sms").
-			IgnorePath("/user/login_sms/send").
-			IgnorePath("/user/refresh").
-			Build(),
+		login.Build(),
 	}
 }
 func corsHdl() gin.HandlerFunc {
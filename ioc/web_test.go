@@ -0,0 +1,17 @@
+package ioc
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jym0818/webook/internal/web"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// 加了路由忘了写文档，或者删了路由没有删文档，这个测试会失败
+func TestInitWeb_Docs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// 注册路由不需要依赖，零值就可以
+	server, doc := initWeb(&web.UserHandler{}, nil, &web.OAuth2WechatHandler{}, &web.ArticleHandler{},
+		&web.JWKSHandler{}, &web.OAuth2Handler{}, &web.AdminRoleHandler{}, &web.AdminUserHandler{}, &web.CaptchaHandler{})
+	assert.NoError(t, doc.Check(server.Routes()))
+}
@@ -1,15 +1,29 @@
 package ioc
 
 import (
+	"github.com/jym0818/webook/internal/repository"
 	"github.com/jym0818/webook/internal/service/oauth2/wechat"
 	"github.com/jym0818/webook/internal/web"
+	"github.com/spf13/viper"
 )
 
-func InitWechat() wechat.Service {
-	service := wechat.Newservice("123456", "123456")
-	return service
+func InitWechat(repo repository.WechatTokenRepository) wechat.Service {
+	var cfg wechat.Config
+	err := viper.UnmarshalKey("wechat", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return wechat.Newservice(cfg, repo)
 }
 
 func InitWechatCfg() web.Config {
-	return web.Config{Secure: false}
+	type Config struct {
+		SecureCookie bool
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("wechat", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return web.Config{Secure: cfg.SecureCookie}
 }
@@ -0,0 +1,40 @@
+package job
+
+import (
+	"context"
+	"github.com/jym0818/webook/internal/service/sms/async"
+	"time"
+)
+
+// SMSRetryJob 重试同步发送失败的短信，多个实例同时跑也不会重复发送
+type SMSRetryJob struct {
+	svc       *async.Service
+	timeout   time.Duration
+	batchSize int
+}
+
+func NewSMSRetryJob(svc *async.Service, timeout time.Duration) *SMSRetryJob {
+	return &SMSRetryJob{
+		svc:       svc,
+		timeout:   timeout,
+		batchSize: 100,
+	}
+}
+
+func (s *SMSRetryJob) Name() string {
+	return "sms_retry"
+}
+
+func (s *SMSRetryJob) Run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	for {
+		n, err := s.svc.RetryWaiting(ctx, s.batchSize)
+		if err != nil {
+			return err
+		}
+		if n < s.batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package job
+
+import (
+	"context"
+	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/pkg/phonex"
+	"go.uber.org/zap"
+	"time"
+)
+
+// UserPhoneJob 把老数据里面的手机号迁移成 E.164 格式。
+// 已经迁移过的不会再查出来，所以可以反复执行
+type UserPhoneJob struct {
+	svc       service.UserService
+	phones    *phonex.Parser
+	timeout   time.Duration
+	batchSize int
+}
+
+func NewUserPhoneJob(svc service.UserService, phones *phonex.Parser, timeout time.Duration) *UserPhoneJob {
+	return &UserPhoneJob{
+		svc:       svc,
+		phones:    phones,
+		timeout:   timeout,
+		batchSize: 100,
+	}
+}
+
+func (u *UserPhoneJob) Name() string {
+	return "user_phone_e164"
+}
+
+func (u *UserPhoneJob) Run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), u.timeout)
+	defer cancel()
+	var startId int64
+	for {
+		us, err := u.svc.FindUnnormalizedPhones(ctx, startId, u.batchSize)
+		if err != nil {
+			return err
+		}
+		for _, usr := range us {
+			startId = usr.Id
+			phone, er := u.phones.Normalize(usr.Phone)
+			if er != nil {
+				// 格式不对的留着人工处理，不影响别的
+				zap.L().Warn("手机号格式不对，无法迁移", zap.Int64("uid", usr.Id), zap.String("phone", usr.Phone))
+				continue
+			}
+			owner, er := u.svc.BindPhone(ctx, usr.Id, phone)
+			if er == service.ErrIdentityConflict {
+				// 同一个号码注册了两个账号，要用户自己合并
+				zap.L().Warn("迁移之后手机号和别的账号重复", zap.Int64("uid", usr.Id),
+					zap.Int64("owner", owner.Id), zap.String("phone", phone))
+				// 记下来，不然下次运行还是一样，没人知道要合并哪两个账号
+				if er = u.svc.RecordPhoneConflict(ctx, usr.Id, owner.Id, phone); er != nil {
+					return er
+				}
+				continue
+			}
+			if er != nil {
+				return er
+			}
+		}
+		if len(us) < u.batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package job
+
+import (
+	"context"
+	"github.com/jym0818/webook/internal/service"
+	"time"
+)
+
+// UserPurgeJob 注销过了冷静期的账号，真正抹掉个人信息
+type UserPurgeJob struct {
+	svc     service.UserService
+	timeout time.Duration
+	// batchSize 一批处理多少个账号
+	batchSize int
+	// withdrawArticles 为 true 的时候文章改成仅自己可见，不然作者显示成已注销用户
+	withdrawArticles bool
+}
+
+func NewUserPurgeJob(svc service.UserService, timeout time.Duration, withdrawArticles bool) *UserPurgeJob {
+	return &UserPurgeJob{
+		svc:              svc,
+		timeout:          timeout,
+		batchSize:        100,
+		withdrawArticles: withdrawArticles,
+	}
+}
+
+func (u *UserPurgeJob) Name() string {
+	return "user_purge"
+}
+
+func (u *UserPurgeJob) Run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), u.timeout)
+	defer cancel()
+	// 先把上次没有发出去的注销消息补上
+	for {
+		n, err := u.svc.RetryDeletedEvents(ctx, u.batchSize)
+		if err != nil {
+			return err
+		}
+		if n < u.batchSize {
+			break
+		}
+	}
+	for {
+		n, err := u.svc.PurgeDeactivated(ctx, u.batchSize, u.withdrawArticles)
+		if err != nil {
+			return err
+		}
+		// 不满一批说明处理完了，剩下的下一次再来
+		if n < u.batchSize {
+			return nil
+		}
+	}
+}
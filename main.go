@@ -22,6 +22,12 @@ func main() {
 	initPrometheus()
 	fn := initOpentelemetry()
 	app := InitServer()
+	for _, c := range app.consumers {
+		err := c.Start()
+		if err != nil {
+			panic(err)
+		}
+	}
 
 	app.cron.Start()
 
@@ -0,0 +1,72 @@
+package ginx
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Error 带错误码的业务错误，handler 直接返回它，或者返回登记过的哨兵错误
+type Error struct {
+	// Status HTTP 状态码，0 的时候用 200
+	Status int
+	Code   int
+	Msg    string
+}
+
+func NewError(code int, msg string) *Error {
+	return &Error{Code: code, Msg: msg}
+}
+
+// WithStatus 返回一个新的 Error，不会修改原来的
+func (e *Error) WithStatus(status int) *Error {
+	res := *e
+	res.Status = status
+	return &res
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+func (e *Error) status() int {
+	if e.Status == 0 {
+		return http.StatusOK
+	}
+	return e.Status
+}
+
+type mapping struct {
+	target error
+	err    *Error
+}
+
+var (
+	mappings []mapping
+	// internalError 没有登记过的错误，一般是数据库、Redis 这些出问题了
+	internalError = &Error{Code: 500, Msg: "系统错误"}
+)
+
+// RegisterError 把 service 层的哨兵错误对应到错误码上，用 errors.Is 判断，
+// 所以包装过的错误也可以。只能在 init 或者启动的时候调用，不是并发安全的
+func RegisterError(target error, err *Error) {
+	mappings = append(mappings, mapping{target: target, err: err})
+}
+
+// SetInternalError 修改没有登记过的错误返回的错误码
+func SetInternalError(err *Error) {
+	internalError = err
+}
+
+// lookup 第二个返回值表示是不是预期之内的错误
+func lookup(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	for _, m := range mappings {
+		if errors.Is(err, m.target) {
+			return m.err, true
+		}
+	}
+	return internalError, false
+}
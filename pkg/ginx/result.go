@@ -0,0 +1,8 @@
+package ginx
+
+// Result 所有接口的响应格式，HTTP 状态码一般都是 200，前端看 Code
+type Result struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data any    `json:"data"`
+}
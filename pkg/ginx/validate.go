@@ -0,0 +1,128 @@
+package ginx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// FieldError 校验没有通过的字段，Field 是 json 里面的名字
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Msg   string `json:"msg"`
+}
+
+var (
+	// invalidInput 校验没有通过的时候用的错误码，Data 里面是 []FieldError
+	invalidInput = &Error{Code: 400, Msg: "参数错误"}
+	// messages 规则对应的提示，%s 是规则的参数，比如 max=100 里面的 100
+	messages = map[string]string{
+		"required": "不能为空",
+		"eqfield":  "两次输入不一致",
+		"oneof":    "只能是 %s 里面的一个",
+		"gt":       "必须大于 %s",
+		"lt":       "必须小于 %s",
+	}
+)
+
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	// 返回给前端的是 json 里面的字段名，不是 Go 的字段名
+	v.RegisterTagNameFunc(func(fld reflect.StructField) string {
+		name, _, _ := strings.Cut(fld.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return fld.Name
+		}
+		return name
+	})
+}
+
+// RegisterValidation 注册自定义的校验规则，在 binding 标签里面使用，比如 binding:"password"。
+// 和 RegisterError 一样只能在 init 或者启动的时候调用
+func RegisterValidation(tag string, fn validator.Func, msg string) {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		panic("ginx: gin 的校验器不是 go-playground/validator")
+	}
+	if err := v.RegisterValidation(tag, fn); err != nil {
+		panic(err)
+	}
+	messages[tag] = msg
+}
+
+// SetInvalidInputError 修改校验没有通过的时候返回的错误码
+func SetInvalidInputError(err *Error) {
+	invalidInput = err
+}
+
+// Bind 和 gin 的 Bind 一样，请求体格式不对的时候返回 400，
+// 区别是字段校验没有通过的时候返回 200，Data 里面是每个字段的错误。
+// 返回 false 的时候已经写好了响应
+func Bind(ctx *gin.Context, req any) bool {
+	err := ctx.ShouldBind(req)
+	if err == nil {
+		return true
+	}
+	var ves validator.ValidationErrors
+	if !errors.As(err, &ves) {
+		_ = ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypeBind)
+		return false
+	}
+	fields := make([]FieldError, 0, len(ves))
+	for _, fe := range ves {
+		fields = append(fields, FieldError{
+			Field: fe.Field(),
+			Rule:  fe.Tag(),
+			Msg:   message(fe),
+		})
+	}
+	ctx.JSON(invalidInput.status(), Result{
+		Code: invalidInput.Code,
+		// 前端不想逐个字段展示的时候，直接弹出第一个错误
+		Msg:  fields[0].Field + " " + fields[0].Msg,
+		Data: fields,
+	})
+	return false
+}
+
+func message(fe validator.FieldError) string {
+	if msg, ok := messages[fe.Tag()]; ok {
+		if strings.Contains(msg, "%s") {
+			return fmt.Sprintf(msg, fe.Param())
+		}
+		return msg
+	}
+	// 字符串和切片比较的是长度
+	var isLen bool
+	switch fe.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		isLen = true
+	}
+	switch fe.Tag() {
+	case "min", "gte":
+		if isLen {
+			return "长度不能小于 " + fe.Param()
+		}
+		return "不能小于 " + fe.Param()
+	case "max", "lte":
+		if isLen {
+			return "长度不能超过 " + fe.Param()
+		}
+		return "不能大于 " + fe.Param()
+	case "len":
+		return "长度必须是 " + fe.Param()
+	}
+	return "格式不正确"
+}
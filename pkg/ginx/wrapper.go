@@ -0,0 +1,103 @@
+package ginx
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// claimsKey 登录校验的中间件把 claims 放在这个 key 下面
+const claimsKey = "claims"
+
+// Wrap 不需要请求体，也不需要登录信息的接口，比如从路径里面取参数
+func Wrap(fn func(ctx *gin.Context) (Result, error)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		res, err := fn(ctx)
+		render(ctx, res, err)
+	}
+}
+
+// WrapBody 绑定请求体，绑定和校验失败的时候见 Bind
+func WrapBody[Req any](fn func(ctx *gin.Context, req Req) (Result, error)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req Req
+		if !Bind(ctx, &req) {
+			return
+		}
+		res, err := fn(ctx, req)
+		render(ctx, res, err)
+	}
+}
+
+// WrapClaims C 一般是 *web.UserClaims，拿不到的时候返回 401
+func WrapClaims[C any](fn func(ctx *gin.Context, uc C) (Result, error)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		uc, ok := claims[C](ctx)
+		if !ok {
+			return
+		}
+		res, err := fn(ctx, uc)
+		render(ctx, res, err)
+	}
+}
+
+func WrapBodyAndClaims[Req any, C any](fn func(ctx *gin.Context, req Req, uc C) (Result, error)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req Req
+		if !Bind(ctx, &req) {
+			return
+		}
+		uc, ok := claims[C](ctx)
+		if !ok {
+			return
+		}
+		res, err := fn(ctx, req, uc)
+		render(ctx, res, err)
+	}
+}
+
+func claims[C any](ctx *gin.Context) (C, bool) {
+	val, _ := ctx.Get(claimsKey)
+	uc, ok := val.(C)
+	if !ok {
+		// 路由没有经过登录校验，或者被配置成了游客也可以访问
+		zap.L().Error("没有拿到登录信息", zap.String("path", ctx.FullPath()))
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+	}
+	return uc, ok
+}
+
+// render 返回了 error 的时候，先按照 Error 或者登记过的哨兵错误转成错误码，
+// 都不是的话，Result 里面设置了 Code 就用 handler 自己的 Result，比如模块自己的系统错误码
+func render(ctx *gin.Context, res Result, err error) {
+	if err == nil {
+		ctx.JSON(http.StatusOK, res)
+		return
+	}
+	fields := []zap.Field{
+		zap.String("method", ctx.Request.Method),
+		zap.String("path", ctx.FullPath()),
+		zap.Error(err),
+	}
+	if sc := trace.SpanContextFromContext(ctx.Request.Context()); sc.HasTraceID() {
+		fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+	}
+	e, expected := lookup(err)
+	if !expected {
+		zap.L().Error("处理请求失败", fields...)
+		if res.Code != 0 {
+			ctx.JSON(http.StatusOK, res)
+			return
+		}
+		ctx.JSON(e.status(), Result{Code: e.Code, Msg: e.Msg})
+		return
+	}
+	if e.status() >= http.StatusInternalServerError {
+		zap.L().Error("处理请求失败", fields...)
+	} else {
+		// 输入不对、验证码错误这些是正常的业务分支
+		zap.L().Debug("请求没有通过", fields...)
+	}
+	ctx.JSON(e.status(), Result{Code: e.Code, Msg: e.Msg})
+}
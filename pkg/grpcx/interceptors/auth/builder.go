@@ -0,0 +1,94 @@
+// Package auth gRPC 服务端的权限校验，token 用 JWKS 里面的公钥校验，不需要共享密钥
+package auth
+
+import (
+	"context"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"slices"
+	"strings"
+)
+
+const headerAuthorization = "authorization"
+
+// Claims 只解析需要的字段，和 webook 签发的短 token 保持一致
+type Claims struct {
+	jwt.RegisteredClaims
+	Uid   int64
+	Perms []string
+}
+
+type claimsKey struct{}
+
+type InterceptorBuilder struct {
+	keyfunc jwt.Keyfunc
+	// perms 方法全名到需要的权限，没有配置的方法不校验
+	perms map[string]string
+}
+
+// NewInterceptorBuilder keyfunc 一般是 jwtx.RemoteKeyset 的 Keyfunc
+func NewInterceptorBuilder(keyfunc jwt.Keyfunc) *InterceptorBuilder {
+	return &InterceptorBuilder{
+		keyfunc: keyfunc,
+		perms:   map[string]string{},
+	}
+}
+
+// Require fullMethod 形如 /intr.v1.InteractiveService/Like
+func (b *InterceptorBuilder) Require(fullMethod string, perm string) *InterceptorBuilder {
+	b.perms[fullMethod] = perm
+	return b
+}
+
+func (b *InterceptorBuilder) BuildUnary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+		perm, ok := b.perms[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+		claims, err := b.parse(ctx)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "token 无效")
+		}
+		if !slices.Contains(claims.Perms, perm) {
+			zap.L().Warn("没有权限", zap.Int64("uid", claims.Uid),
+				zap.String("perm", perm), zap.String("method", info.FullMethod))
+			return nil, status.Error(codes.PermissionDenied, "没有权限")
+		}
+		return handler(context.WithValue(ctx, claimsKey{}, claims), req)
+	}
+}
+
+func (b *InterceptorBuilder) parse(ctx context.Context) (*Claims, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	vals := md.Get(headerAuthorization)
+	if len(vals) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "没有 token")
+	}
+	tokenStr, _ := strings.CutPrefix(vals[0], "Bearer ")
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, b.keyfunc)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.Uid == 0 {
+		return nil, status.Error(codes.Unauthenticated, "token 无效")
+	}
+	return claims, nil
+}
+
+// FromContext 校验过权限的方法里面才拿得到
+func FromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(*Claims)
+	return c, ok
+}
+
+// WithToken 客户端调用需要权限的方法时，把用户的短 token 带上
+func WithToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, headerAuthorization, "Bearer "+token)
+}
@@ -0,0 +1,164 @@
+package jwtx
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JWKSet 对应 RFC 7517 的 JWK Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+func toJWK(k *Key) (JWK, bool) {
+	jwk := JWK{Kid: k.Kid, Alg: k.Method.Alg(), Use: "sig"}
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+func (jwk JWK) publicKey() (any, jwt.SigningMethod, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, jwt.SigningMethodRS256, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, nil, fmt.Errorf("jwtx: 不支持的曲线 %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ed25519.PublicKey(x), jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, nil, fmt.Errorf("jwtx: 不支持的密钥类型 %s", jwk.Kty)
+	}
+}
+
+// RemoteKeyset 给别的服务用的，从 JWKS 地址拉公钥来校验 token，不需要共享密钥。
+// 碰到不认识的 kid 会重新拉一次，这样签名方轮换密钥之后不需要重启
+type RemoteKeyset struct {
+	url    string
+	client *http.Client
+	// minInterval 两次拉取之间的最短间隔，防止被不存在的 kid 打爆
+	minInterval time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]*Key
+	lastFetch time.Time
+}
+
+func NewRemoteKeyset(url string) *RemoteKeyset {
+	return &RemoteKeyset{
+		url:         url,
+		client:      &http.Client{Timeout: time.Second * 3},
+		minInterval: time.Minute,
+		keys:        map[string]*Key{},
+	}
+}
+
+func (r *RemoteKeyset) Keyfunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	k, ok := r.get(kid)
+	if !ok {
+		err := r.refresh(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		k, ok = r.get(kid)
+		if !ok {
+			return nil, ErrUnknownKid
+		}
+	}
+	if t.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("jwtx: kid %s 的算法是 %s，token 用的是 %s", kid, k.Method.Alg(), t.Method.Alg())
+	}
+	return k.Public, nil
+}
+
+func (r *RemoteKeyset) get(kid string) (*Key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	k, ok := r.keys[kid]
+	return k, ok
+}
+
+func (r *RemoteKeyset) refresh(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.lastFetch) < r.minInterval {
+		return nil
+	}
+	r.lastFetch = time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwtx: 拉取 JWKS 失败 %d", resp.StatusCode)
+	}
+	var set JWKSet
+	err = json.NewDecoder(resp.Body).Decode(&set)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]*Key, len(set.Keys))
+	for _, jwk := range set.Keys {
+		pub, method, er := jwk.publicKey()
+		if er != nil {
+			// 不认识的密钥跳过就可以
+			continue
+		}
+		keys[jwk.Kid] = &Key{Kid: jwk.Kid, Method: method, Public: pub}
+	}
+	r.keys = keys
+	return nil
+}
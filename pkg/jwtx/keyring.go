@@ -0,0 +1,151 @@
+package jwtx
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownKid = errors.New("jwtx: 未知的 kid")
+
+// Key 一把签名密钥。轮换的时候，老的密钥只保留公钥用来校验
+type Key struct {
+	Kid    string
+	Method jwt.SigningMethod
+	// Private 签名用的，RSA 是 *rsa.PrivateKey，EdDSA 是 ed25519.PrivateKey，
+	// HMAC 是 []byte。只用来校验的老密钥可以为 nil
+	Private any
+	// Public 校验用的，HMAC 和 Private 一样
+	Public any
+}
+
+// Keyring 用 current 签名，用所有的 key 校验，通过 token 头部的 kid 区分
+type Keyring struct {
+	current *Key
+	keys    map[string]*Key
+}
+
+// NewKeyring olds 是轮换下来的老密钥，在老 token 过期之前都要保留
+func NewKeyring(current Key, olds ...Key) (*Keyring, error) {
+	if current.Private == nil {
+		return nil, fmt.Errorf("jwtx: 当前密钥 %s 没有私钥", current.Kid)
+	}
+	r := &Keyring{
+		keys: make(map[string]*Key, len(olds)+1),
+	}
+	for _, k := range append([]Key{current}, olds...) {
+		if _, ok := r.keys[k.Kid]; ok {
+			return nil, fmt.Errorf("jwtx: 重复的 kid %s", k.Kid)
+		}
+		if k.Public == nil {
+			pub, err := publicKey(k.Private)
+			if err != nil {
+				return nil, err
+			}
+			k.Public = pub
+		}
+		r.keys[k.Kid] = &k
+	}
+	r.current = r.keys[current.Kid]
+	return r, nil
+}
+
+// Sign 用当前密钥签名，kid 放在头部
+func (r *Keyring) Sign(claims jwt.Claims) (string, error) {
+	t := jwt.NewWithClaims(r.current.Method, claims)
+	if r.current.Kid != "" {
+		t.Header["kid"] = r.current.Kid
+	}
+	return t.SignedString(r.current.Private)
+}
+
+// Keyfunc 传给 jwt.ParseWithClaims。没有 kid 的 token 会用 kid 为空的密钥校验，
+// 这是为了兼容引入 kid 之前签发的 token
+func (r *Keyring) Keyfunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	k, ok := r.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKid
+	}
+	// 防止拿公钥当 HMAC 的密钥这一类攻击
+	if t.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("jwtx: kid %s 的算法是 %s，token 用的是 %s", kid, k.Method.Alg(), t.Method.Alg())
+	}
+	return k.Public, nil
+}
+
+// JWKS 公开所有非对称密钥的公钥，HMAC 的密钥不能公开
+func (r *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	// 当前密钥放在最前面
+	if jwk, ok := toJWK(r.current); ok {
+		set.Keys = append(set.Keys, jwk)
+	}
+	for kid, k := range r.keys {
+		if kid == r.current.Kid {
+			continue
+		}
+		if jwk, ok := toJWK(k); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func publicKey(private any) (any, error) {
+	switch key := private.(type) {
+	case []byte:
+		return key, nil
+	case crypto.Signer:
+		return key.Public(), nil
+	default:
+		return nil, fmt.Errorf("jwtx: 不支持的密钥类型 %T", private)
+	}
+}
+
+// ParseKey 解析 PEM 格式的密钥，alg 支持 RS256 和 EdDSA。
+// 老密钥只有公钥的时候，privatePEM 传 nil
+func ParseKey(kid, alg string, privatePEM, publicPEM []byte) (Key, error) {
+	k := Key{Kid: kid}
+	var err error
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		k.Method = jwt.SigningMethodRS256
+		if privatePEM != nil {
+			var pk *rsa.PrivateKey
+			pk, err = jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+			k.Private = pk
+		} else {
+			var pub *rsa.PublicKey
+			pub, err = jwt.ParseRSAPublicKeyFromPEM(publicPEM)
+			k.Public = pub
+		}
+	case jwt.SigningMethodEdDSA.Alg():
+		k.Method = jwt.SigningMethodEdDSA
+		if privatePEM != nil {
+			var pk crypto.PrivateKey
+			pk, err = jwt.ParseEdPrivateKeyFromPEM(privatePEM)
+			k.Private = pk
+		} else {
+			var pub crypto.PublicKey
+			pub, err = jwt.ParseEdPublicKeyFromPEM(publicPEM)
+			k.Public = pub
+		}
+	default:
+		return Key{}, fmt.Errorf("jwtx: 不支持的算法 %s", alg)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("jwtx: 解析密钥 %s 失败 %w", kid, err)
+	}
+	if k.Private == nil && k.Public == nil {
+		return Key{}, fmt.Errorf("jwtx: 密钥 %s 没有私钥也没有公钥", kid)
+	}
+	return k, nil
+}
+
+// HMACKey 对称密钥，只适合单体应用内部使用
+func HMACKey(kid string, method *jwt.SigningMethodHMAC, secret []byte) Key {
+	return Key{Kid: kid, Method: method, Private: secret, Public: secret}
+}
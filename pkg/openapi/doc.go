@@ -0,0 +1,227 @@
+package openapi
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Any 对应 gin 的 Any，文档里面写成 GET
+const Any = "ANY"
+
+// Operation 一个接口的文档，和 RegisterRoutes 里面注册的路由一一对应
+type Operation struct {
+	Method string
+	// Path 和注册路由的时候一样，比如 /article/pub/:id
+	Path    string
+	Summary string
+	Tag     string
+	// Request 请求体，传一个零值就可以，比如 ArticleReq{}，没有请求体的时候是 nil
+	Request any
+	// Response Result 里面 Data 的类型，nil 表示没有 Data
+	Response any
+	// Public 不需要登录
+	Public bool
+}
+
+// Doc 收集所有接口的文档，生成 OpenAPI 3 的 JSON
+type Doc struct {
+	title   string
+	version string
+	ops     []Operation
+
+	once sync.Once
+	spec map[string]any
+}
+
+func NewDoc(title string, version string) *Doc {
+	return &Doc{title: title, version: version}
+}
+
+// Add 只能在注册路由之前调用
+func (d *Doc) Add(ops ...Operation) {
+	d.ops = append(d.ops, ops...)
+}
+
+func (d *Doc) RegisterRoutes(s *gin.Engine) {
+	s.GET("/openapi.json", d.JSON)
+	s.GET("/swagger", d.UI)
+}
+
+func (d *Doc) JSON(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, d.Spec())
+}
+
+func (d *Doc) UI(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUI))
+}
+
+// Check 对比注册了的路由和文档，注册了路由没有写文档，或者文档里面的路由已经不存在了，都会返回 error
+func (d *Doc) Check(routes gin.RoutesInfo) error {
+	documented := map[string]bool{}
+	for _, op := range d.ops {
+		documented[op.Method+" "+op.Path] = true
+	}
+	used := map[string]bool{}
+	var missing []string
+	for _, r := range routes {
+		if r.Path == "/openapi.json" || r.Path == "/swagger" {
+			continue
+		}
+		key := r.Method + " " + r.Path
+		if documented[key] {
+			used[key] = true
+			continue
+		}
+		// gin 的 Any 会注册所有的方法
+		if anyKey := Any + " " + r.Path; documented[anyKey] {
+			used[anyKey] = true
+			continue
+		}
+		missing = append(missing, key)
+	}
+	var stale []string
+	for key := range documented {
+		if !used[key] {
+			stale = append(stale, key)
+		}
+	}
+	if len(missing) == 0 && len(stale) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+	return fmt.Errorf("openapi: 没有文档的路由 %v，路由已经不存在的文档 %v", missing, stale)
+}
+
+// Spec 第一次调用的时候生成，之后不会再变
+func (d *Doc) Spec() map[string]any {
+	d.once.Do(func() {
+		d.spec = d.build()
+	})
+	return d.spec
+}
+
+func (d *Doc) build() map[string]any {
+	s := newSchemas()
+	paths := map[string]any{}
+	for _, op := range d.ops {
+		path, params := convertPath(op.Path)
+		item, ok := paths[path].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[path] = item
+		}
+		operation := map[string]any{
+			"summary":   op.Summary,
+			"responses": d.responses(s, op.Response),
+		}
+		if op.Tag != "" {
+			operation["tags"] = []string{op.Tag}
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if op.Request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": s.of(reflect.TypeOf(op.Request))},
+				},
+			}
+		}
+		if !op.Public {
+			operation["security"] = []any{map[string]any{"bearerAuth": []string{}}}
+		}
+		method := op.Method
+		if method == Any {
+			method = http.MethodGet
+		}
+		item[strings.ToLower(method)] = operation
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   d.title,
+			"version": d.version,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": s.defs,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+	}
+}
+
+// responses 所有接口都是 200 加上 Result，业务错误看 code
+func (d *Doc) responses(s *schemas, data any) map[string]any {
+	dataSchema := map[string]any{}
+	if data != nil {
+		dataSchema = s.of(reflect.TypeOf(data))
+	}
+	return map[string]any{
+		"200": map[string]any{
+			"description": "code 是 200 的时候表示成功，其他的见错误码",
+			"content": map[string]any{
+				"application/json": map[string]any{
+					"schema": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"code": map[string]any{"type": "integer"},
+							"msg":  map[string]any{"type": "string"},
+							"data": dataSchema,
+						},
+					},
+				},
+			},
+		},
+		"401": map[string]any{"description": "没有登录或者登录已经失效"},
+	}
+}
+
+// convertPath /article/pub/:id 转成 /article/pub/{id}
+func convertPath(path string) (string, []any) {
+	segs := strings.Split(path, "/")
+	var params []any
+	for i, seg := range segs {
+		if seg == "" || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		name := seg[1:]
+		segs[i] = "{" + name + "}"
+		params = append(params, map[string]any{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+	return strings.Join(segs, "/"), params
+}
+
+const swaggerUI = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8"/>
+  <title>API 文档</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css"/>
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+  window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,146 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemas 把 Go 的类型转成 JSON Schema，具名的结构体放到 components 里面，用 $ref 引用
+type schemas struct {
+	defs map[string]any
+	// names 同名的结构体在不同的包里面的时候，加上包名区分
+	names map[reflect.Type]string
+}
+
+func newSchemas() *schemas {
+	return &schemas{
+		defs:  map[string]any{},
+		names: map[reflect.Type]string{},
+	}
+}
+
+func (s *schemas) of(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + s.define(t)}
+	}
+	// interface 这些，什么都可以
+	return map[string]any{}
+}
+
+func (s *schemas) define(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, ok := s.defs[name]; ok {
+		name = strings.ReplaceAll(t.String(), ".", "_")
+	}
+	s.names[t] = name
+	// 先占位，结构体引用自己的时候不会死循环
+	s.defs[name] = nil
+	s.defs[name] = s.object(t)
+	return name
+}
+
+func (s *schemas) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	s.fields(t, props, &required)
+	res := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		res["required"] = required
+	}
+	return res
+}
+
+func (s *schemas) fields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		// 嵌入的结构体，字段展开到外面，比如 CaptchaReq
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			s.fields(f.Type, props, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		schema := s.of(f.Type)
+		if rules := f.Tag.Get("binding"); rules != "" {
+			if constrain(schema, f.Type, rules) {
+				*required = append(*required, name)
+			}
+		}
+		props[name] = schema
+	}
+}
+
+// constrain 把 binding 标签里面常用的规则写到 schema 上面，返回是不是必填
+func constrain(schema map[string]any, t reflect.Type, rules string) bool {
+	required := false
+	isLen := t.Kind() == reflect.String || t.Kind() == reflect.Slice
+	for _, rule := range strings.Split(rules, ",") {
+		tag, param, _ := strings.Cut(rule, "=")
+		n, err := strconv.ParseFloat(param, 64)
+		switch {
+		case tag == "required":
+			required = true
+		case tag == "oneof":
+			schema["enum"] = strings.Fields(param)
+		case err != nil:
+			// 自定义的规则，比如 password，只写到描述里面
+			if tag != "omitempty" {
+				schema["x-binding"] = rules
+			}
+		case (tag == "min" || tag == "gte") && isLen:
+			schema["minLength"] = n
+		case (tag == "max" || tag == "lte") && isLen:
+			schema["maxLength"] = n
+		case tag == "min" || tag == "gte":
+			schema["minimum"] = n
+		case tag == "max" || tag == "lte":
+			schema["maximum"] = n
+		case tag == "gt":
+			schema["minimum"] = n
+			schema["exclusiveMinimum"] = true
+		}
+	}
+	return required
+}
@@ -0,0 +1,128 @@
+package phonex
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidPhone = errors.New("phonex: 手机号格式不对")
+
+// regions 地区到国际电话区号，默认地区只能从这里面选
+var regions = map[string]string{
+	"CN": "86", "HK": "852", "MO": "853", "TW": "886",
+	"US": "1", "CA": "1", "JP": "81", "KR": "82",
+	"SG": "65", "MY": "60", "TH": "66", "VN": "84", "PH": "63", "ID": "62", "IN": "91",
+	"AU": "61", "NZ": "64", "GB": "44", "DE": "49", "FR": "33", "IT": "39", "ES": "34",
+	"NL": "31", "RU": "7", "BR": "55", "AE": "971",
+}
+
+// twoDigitCodes 两位数的国际区号，1 和 7 开头的是一位，剩下的都是三位，
+// 区号之间不会互为前缀，所以可以直接从号码里面切出来
+var twoDigitCodes = map[string]bool{
+	"20": true, "27": true,
+	"30": true, "31": true, "32": true, "33": true, "34": true, "36": true, "39": true,
+	"40": true, "41": true, "43": true, "44": true, "45": true, "46": true, "47": true, "48": true, "49": true,
+	"51": true, "52": true, "53": true, "54": true, "55": true, "56": true, "57": true, "58": true,
+	"60": true, "61": true, "62": true, "63": true, "64": true, "65": true, "66": true,
+	"81": true, "82": true, "84": true, "86": true,
+	"90": true, "91": true, "92": true, "93": true, "94": true, "95": true, "98": true,
+}
+
+// nationalRules 常用地区的号码规则，没有列出来的只校验长度
+var nationalRules = map[string]*regexp.Regexp{
+	// 大陆只支持手机号
+	"86":  regexp.MustCompile(`^1[3-9]\d{9}$`),
+	"852": regexp.MustCompile(`^[4-9]\d{7}$`),
+	"853": regexp.MustCompile(`^6\d{7}$`),
+	"886": regexp.MustCompile(`^9\d{8}$`),
+	"1":   regexp.MustCompile(`^[2-9]\d{2}[2-9]\d{6}$`),
+}
+
+// keepTrunkZero 意大利的固话号码开头的 0 是号码的一部分
+var keepTrunkZero = map[string]bool{"39": true}
+
+// separators 后面两个是网页上复制过来的不换行空格和中文输入法的全角空格
+var separators = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "", "\u00a0", "", "\u3000", "")
+
+// Parser 把用户输入的手机号统一成 E.164 格式，比如 +8613812345678
+type Parser struct {
+	// defaultCode 用户没有输入区号的时候用的区号
+	defaultCode string
+}
+
+func NewParser(defaultRegion string) (*Parser, error) {
+	code, ok := regions[strings.ToUpper(defaultRegion)]
+	if !ok {
+		return nil, fmt.Errorf("phonex: 不支持的地区 %s", defaultRegion)
+	}
+	return &Parser{defaultCode: code}, nil
+}
+
+// Normalize 支持 +86 138...、0086 138...、138-xxxx-xxxx 这些写法
+func (p *Parser) Normalize(raw string) (string, error) {
+	s := separators.Replace(strings.TrimSpace(raw))
+	var code, national string
+	switch {
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+		code = CallingCode("+" + s)
+		national = strings.TrimPrefix(s, code)
+	case strings.HasPrefix(s, "00"):
+		s = s[2:]
+		code = CallingCode("+" + s)
+		national = strings.TrimPrefix(s, code)
+	default:
+		code = p.defaultCode
+		national = s
+		if !keepTrunkZero[code] {
+			national = strings.TrimPrefix(national, "0")
+		}
+		// 北美习惯在前面加 1
+		if code == "1" && len(national) == 11 {
+			national = strings.TrimPrefix(national, "1")
+		}
+	}
+	if code == "" || !isDigits(national) {
+		return "", ErrInvalidPhone
+	}
+	// E.164 最长 15 位
+	if len(national) < 4 || len(code)+len(national) > 15 {
+		return "", ErrInvalidPhone
+	}
+	if rule, ok := nationalRules[code]; ok && !rule.MatchString(national) {
+		return "", ErrInvalidPhone
+	}
+	return "+" + code + national, nil
+}
+
+// CallingCode 从 E.164 格式的号码里面取出国际区号，不是 E.164 格式的返回空字符串
+func CallingCode(e164 string) string {
+	if !strings.HasPrefix(e164, "+") || len(e164) < 4 || !isDigits(e164[1:]) {
+		return ""
+	}
+	s := e164[1:]
+	switch {
+	case s[0] == '0':
+		return ""
+	case s[0] == '1' || s[0] == '7':
+		return s[:1]
+	case twoDigitCodes[s[:2]]:
+		return s[:2]
+	default:
+		return s[:3]
+	}
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
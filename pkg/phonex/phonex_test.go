@@ -0,0 +1,82 @@
+package phonex
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNewParser(t *testing.T) {
+	p, err := NewParser("cn")
+	require.NoError(t, err)
+	assert.Equal(t, "86", p.defaultCode)
+
+	_, err = NewParser("XX")
+	assert.Error(t, err)
+}
+
+func TestParser_Normalize(t *testing.T) {
+	testCases := []struct {
+		name    string
+		region  string
+		raw     string
+		want    string
+		wantErr error
+	}{
+		{name: "大陆手机号", region: "CN", raw: "13812345678", want: "+8613812345678"},
+		{name: "带加号的区号", region: "CN", raw: "+86 138 1234 5678", want: "+8613812345678"},
+		{name: "00 开头的区号", region: "CN", raw: "0086-138-1234-5678", want: "+8613812345678"},
+		{name: "00 开头的别的地区", region: "CN", raw: "0014155552671", want: "+14155552671"},
+		{name: "去掉开头的 0", region: "CN", raw: "013812345678", want: "+8613812345678"},
+		{name: "全角空格和不换行空格", region: "CN", raw: " 138　1234 5678 ", want: "+8613812345678"},
+		{name: "英国去掉开头的 0", region: "GB", raw: "07911 123456", want: "+447911123456"},
+		{name: "意大利保留开头的 0", region: "IT", raw: "06 1234 5678", want: "+390612345678"},
+		{name: "北美前面带 1", region: "US", raw: "1 (415) 555-2671", want: "+14155552671"},
+		{name: "北美不带 1", region: "US", raw: "415.555.2671", want: "+14155552671"},
+		{name: "北美带加号", region: "CN", raw: "+1 415 555 2671", want: "+14155552671"},
+		{name: "北美 10 位但是 1 开头", region: "US", raw: "1415555267", wantErr: ErrInvalidPhone},
+		{name: "北美位数不够", region: "US", raw: "415555267", wantErr: ErrInvalidPhone},
+		{name: "大陆少一位", region: "CN", raw: "1381234567", wantErr: ErrInvalidPhone},
+		{name: "大陆多一位", region: "CN", raw: "138123456789", wantErr: ErrInvalidPhone},
+		{name: "大陆不是手机号", region: "CN", raw: "12812345678", wantErr: ErrInvalidPhone},
+		{name: "有字母", region: "CN", raw: "138abcd5678", wantErr: ErrInvalidPhone},
+		{name: "只有加号", region: "CN", raw: "+", wantErr: ErrInvalidPhone},
+		{name: "只有 00", region: "CN", raw: "00", wantErr: ErrInvalidPhone},
+		{name: "空的", region: "CN", raw: "", wantErr: ErrInvalidPhone},
+		{name: "号码太短", region: "CN", raw: "+44123", wantErr: ErrInvalidPhone},
+		{name: "超过 15 位", region: "CN", raw: "+4412345678901234", wantErr: ErrInvalidPhone},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := NewParser(tc.region)
+			require.NoError(t, err)
+			phone, err := p.Normalize(tc.raw)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, phone)
+		})
+	}
+}
+
+func TestCallingCode(t *testing.T) {
+	testCases := []struct {
+		name string
+		e164 string
+		want string
+	}{
+		{name: "北美", e164: "+14155552671", want: "1"},
+		{name: "俄罗斯", e164: "+74951234567", want: "7"},
+		{name: "大陆两位", e164: "+8613812345678", want: "86"},
+		{name: "英国两位", e164: "+447911123456", want: "44"},
+		{name: "香港三位", e164: "+85291234567", want: "852"},
+		{name: "阿联酋三位", e164: "+971501234567", want: "971"},
+		{name: "没有加号", e164: "8613812345678"},
+		{name: "0 开头", e164: "+0123456789"},
+		{name: "太短", e164: "+86"},
+		{name: "有字母", e164: "+86abc12345"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, CallingCode(tc.e164))
+		})
+	}
+}
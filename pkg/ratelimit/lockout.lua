@@ -0,0 +1,34 @@
+local failKey = KEYS[1]..":fail"
+local lockKey = KEYS[1]..":lock"
+local levelKey = KEYS[1]..":level"
+
+local window = tonumber(ARGV[1])
+local threshold = tonumber(ARGV[2])
+local base = tonumber(ARGV[3])
+local max = tonumber(ARGV[4])
+local levelTTL = tonumber(ARGV[5])
+
+local cnt = redis.call("INCR", failKey)
+if cnt == 1 then
+    redis.call("PEXPIRE", failKey, window)
+end
+if cnt < threshold then
+    return 0
+end
+
+-- 达到阈值，锁定，每多锁一次时间翻倍
+redis.call("DEL", failKey)
+local level = redis.call("INCR", levelKey)
+redis.call("PEXPIRE", levelKey, levelTTL)
+local lock = base
+for i = 2, level do
+    lock = lock * 2
+    if lock >= max then
+        break
+    end
+end
+if lock > max then
+    lock = max
+end
+redis.call("SET", lockKey, 1, "PX", lock)
+return lock
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+//go:embed lockout.lua
+var luaLockout string
+
+// RedisLockout window 内失败 threshold 次就锁定，第一次锁 lock 这么久，
+// levelTTL 内再次被锁定的话时间翻倍，最多锁 maxLock
+type RedisLockout struct {
+	cmd redis.Cmdable
+
+	window    time.Duration
+	threshold int
+	lock      time.Duration
+	maxLock   time.Duration
+	levelTTL  time.Duration
+}
+
+func NewRedisLockout(cmd redis.Cmdable, window time.Duration, threshold int, lock time.Duration, maxLock time.Duration) *RedisLockout {
+	return &RedisLockout{
+		cmd:       cmd,
+		window:    window,
+		threshold: threshold,
+		lock:      lock,
+		maxLock:   maxLock,
+		levelTTL:  time.Hour * 24,
+	}
+}
+
+func (r *RedisLockout) Locked(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.cmd.PTTL(ctx, key+":lock").Result()
+	if err != nil {
+		return 0, err
+	}
+	// key 不存在的时候是负数
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (r *RedisLockout) Fail(ctx context.Context, key string) (time.Duration, error) {
+	ms, err := r.cmd.Eval(ctx, luaLockout, []string{key},
+		r.window.Milliseconds(), r.threshold, r.lock.Milliseconds(),
+		r.maxLock.Milliseconds(), r.levelTTL.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func (r *RedisLockout) Reset(ctx context.Context, key string) error {
+	// 锁定的等级不清，短时间内反复被锁还是要越锁越久
+	return r.cmd.Del(ctx, key+":fail").Err()
+}
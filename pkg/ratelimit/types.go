@@ -1,7 +1,20 @@
 package ratelimit
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Limiter interface {
 	Limit(ctx context.Context, key string) (bool, error)
 }
+
+// Lockout 失败次数太多就锁定，比如说登录密码错误
+type Lockout interface {
+	// Locked 返回剩余的锁定时间，0 代表没有锁定
+	Locked(ctx context.Context, key string) (time.Duration, error)
+	// Fail 记录一次失败，触发锁定的时候返回锁定时间，否则返回 0
+	Fail(ctx context.Context, key string) (time.Duration, error)
+	// Reset 成功之后清空失败次数
+	Reset(ctx context.Context, key string) error
+}
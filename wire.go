@@ -5,10 +5,13 @@ package main
 import (
 	"github.com/google/wire"
 	"github.com/jym0818/webook/internal/events/article"
+	"github.com/jym0818/webook/internal/events/user"
 	"github.com/jym0818/webook/internal/repository"
 	"github.com/jym0818/webook/internal/repository/cache"
 	"github.com/jym0818/webook/internal/repository/dao"
 	"github.com/jym0818/webook/internal/service"
+	"github.com/jym0818/webook/internal/service/sms"
+	"github.com/jym0818/webook/internal/service/sms/async"
 	"github.com/jym0818/webook/internal/web"
 	"github.com/jym0818/webook/ioc"
 )
@@ -16,14 +19,31 @@ import (
 var UserService = wire.NewSet(
 	cache.NewuserCache,
 	dao.NewuserDAO,
+	dao.NewmfaDAO,
+	dao.Newoauth2BindingDAO,
 	repository.NewuserRepository,
+	repository.NewmfaRepository,
+	repository.Newoauth2BindingRepository,
 	service.NewuserService,
+	service.NewmfaService,
+	dao.NewroleDAO,
+	repository.NewroleRepository,
+	service.NewroleService,
+	dao.NewloginLogDAO,
+	repository.NewloginLogRepository,
+	service.NewloginLogService,
 )
 
 var CodeService = wire.NewSet(
 	cache.NewcodeCache,
 	repository.NewcodeRepository,
 	service.NewcodeService,
+	cache.NewcaptchaCache,
+	repository.NewcaptchaRepository,
+	service.NewcaptchaService,
+	cache.NewmagicLinkCache,
+	repository.NewmagicLinkRepository,
+	ioc.InitMagicLinkService,
 )
 
 var ArticleService = wire.NewSet(
@@ -38,16 +58,34 @@ func InitServer() *App {
 		ioc.InitDB,
 		ioc.InitRedis,
 		ioc.InitSMS,
+		wire.Bind(new(sms.Service), new(*async.Service)),
+		dao.NewasyncSmsDAO,
+		repository.NewasyncSmsRepository,
+		ioc.InitPhoneParser,
+		ioc.InitEmail,
 
 		UserService,
 		CodeService,
 		web.NewUserHandler,
 		ioc.InitWeb,
 		ioc.InitMiddlware,
+		ioc.InitJWTKeyrings,
+		ioc.InitSessionBinder,
+		ioc.InitLoginGuard,
+		ioc.InitRiskPolicy,
+		web.NewCaptchaHandler,
+		web.NewJWKSHandler,
+		web.NewAdminRoleHandler,
+		web.NewAdminUserHandler,
 
 		web.NewOAuth2WechatHandler,
 		ioc.InitWechat,
+		dao.NewwechatTokenDAO,
+		repository.NewwechatTokenRepository,
 		ioc.InitWechatCfg,
+		web.NewOAuth2StateStore,
+		web.NewOAuth2Handler,
+		ioc.InitOAuth2Providers,
 
 		ArticleService,
 		web.NewArticleHandler,
@@ -55,9 +93,15 @@ func InitServer() *App {
 		ioc.InitKafka,
 		ioc.InitKafkaProducer,
 		article.NewKafkaProducer,
+		user.NewKafkaProducer,
+		user.NewLoginLogConsumer,
+		ioc.NewConsumers,
 
 		service.NewBatchRankingService,
 		ioc.InitRankingJob,
+		ioc.InitUserPurgeJob,
+		ioc.InitUserPhoneJob,
+		ioc.InitSMSRetryJob,
 		ioc.InitCronJob,
 		repository.NewCachedRankingRepository,
 		cache.NewRankingRedisCache,
@@ -9,6 +9,7 @@ package main
 import (
 	"github.com/google/wire"
 	"github.com/jym0818/webook/internal/events/article"
+	"github.com/jym0818/webook/internal/events/user"
 	"github.com/jym0818/webook/internal/repository"
 	"github.com/jym0818/webook/internal/repository/cache"
 	"github.com/jym0818/webook/internal/repository/dao"
@@ -25,44 +26,85 @@ func InitServer() *App {
 	cmdable := ioc.InitRedis()
 	userCache := cache.NewuserCache(cmdable)
 	userRepository := repository.NewuserRepository(userDAO, userCache)
-	userService := service.NewuserService(userRepository)
+	oAuth2BindingDAO := dao.Newoauth2BindingDAO(db)
+	oAuth2BindingRepository := repository.Newoauth2BindingRepository(oAuth2BindingDAO)
+	client := ioc.InitKafka()
+	syncProducer := ioc.InitKafkaProducer(client)
+	producer := user.NewKafkaProducer(syncProducer)
+	userService := service.NewuserService(userRepository, oAuth2BindingRepository, producer)
 	codeCache := cache.NewcodeCache(cmdable)
 	codeRepository := repository.NewcodeRepository(codeCache)
-	smsService := ioc.InitSMS(cmdable)
-	codeService := service.NewcodeService(codeRepository, smsService)
-	userHandler := web.NewUserHandler(userService, codeService, cmdable)
-	v := ioc.InitMiddlware(cmdable)
-	wechatService := ioc.InitWechat()
+	asyncSmsDAO := dao.NewasyncSmsDAO(db)
+	asyncSmsRepository := repository.NewasyncSmsRepository(asyncSmsDAO)
+	asyncService := ioc.InitSMS(cmdable, asyncSmsRepository)
+	emailService := ioc.InitEmail()
+	codeService := service.NewcodeService(codeRepository, asyncService, emailService)
+	mfadao := dao.NewmfaDAO(db)
+	mfaRepository := repository.NewmfaRepository(mfadao)
+	mfaService := service.NewmfaService(mfaRepository)
+	magicLinkCache := cache.NewmagicLinkCache(cmdable)
+	magicLinkRepository := repository.NewmagicLinkRepository(magicLinkCache)
+	magicLinkService := ioc.InitMagicLinkService(magicLinkRepository, emailService)
+	roleDAO := dao.NewroleDAO(db)
+	roleRepository := repository.NewroleRepository(roleDAO)
+	roleService := service.NewroleService(roleRepository)
+	loginLogDAO := dao.NewloginLogDAO(db)
+	loginLogRepository := repository.NewloginLogRepository(loginLogDAO)
+	loginLogService := service.NewloginLogService(loginLogRepository, producer)
+	parser := ioc.InitPhoneParser()
+	jwtKeyrings := ioc.InitJWTKeyrings()
+	sessionBinder := ioc.InitSessionBinder()
+	loginGuard := ioc.InitLoginGuard(cmdable)
+	captchaCache := cache.NewcaptchaCache(cmdable)
+	captchaRepository := repository.NewcaptchaRepository(captchaCache)
+	captchaService := service.NewcaptchaService(captchaRepository)
+	riskPolicy := ioc.InitRiskPolicy(cmdable, captchaService)
+	userHandler := web.NewUserHandler(userService, codeService, mfaService, magicLinkService, roleService, loginLogService, parser, cmdable, jwtKeyrings, sessionBinder, loginGuard, riskPolicy)
+	v := ioc.InitMiddlware(cmdable, jwtKeyrings, sessionBinder)
+	wechatTokenDAO := dao.NewwechatTokenDAO(db)
+	wechatTokenRepository := repository.NewwechatTokenRepository(wechatTokenDAO)
+	wechatService := ioc.InitWechat(wechatTokenRepository)
 	config := ioc.InitWechatCfg()
-	oAuth2WechatHandler := web.NewOAuth2WechatHandler(wechatService, userService, config)
+	oAuth2StateStore := web.NewOAuth2StateStore(cmdable, config)
+	oAuth2WechatHandler := web.NewOAuth2WechatHandler(wechatService, userService, roleService, loginLogService, oAuth2StateStore, cmdable, jwtKeyrings, sessionBinder)
 	articleDAO := dao.NewarticleDAO(db)
 	articleCache := cache.NewarticleCache(cmdable)
 	articleRepository := repository.NewarticleRepository(articleDAO, articleCache, userRepository)
-	client := ioc.InitKafka()
-	syncProducer := ioc.InitKafkaProducer(client)
-	producer := article.NewKafkaProducer(syncProducer)
-	articleService := service.NewarticleService(articleRepository, producer)
+	articleProducer := article.NewKafkaProducer(syncProducer)
+	articleService := service.NewarticleService(articleRepository, articleProducer)
 	clientv3Client := ioc.InitEtcd()
 	interactiveServiceClient := ioc.InitIntrGRPCClient(clientv3Client)
 	articleHandler := web.NewArticleHandler(articleService, interactiveServiceClient)
-	engine := ioc.InitWeb(userHandler, v, oAuth2WechatHandler, articleHandler)
+	jwksHandler := web.NewJWKSHandler(jwtKeyrings)
+	providers := ioc.InitOAuth2Providers()
+	oAuth2Handler := web.NewOAuth2Handler(providers, userService, roleService, loginLogService, oAuth2StateStore, cmdable, jwtKeyrings, sessionBinder)
+	adminRoleHandler := web.NewAdminRoleHandler(roleService)
+	adminUserHandler := web.NewAdminUserHandler(userService, roleService, loginLogService, parser, cmdable, jwtKeyrings, sessionBinder)
+	captchaHandler := web.NewCaptchaHandler(captchaService)
+	engine := ioc.InitWeb(userHandler, v, oAuth2WechatHandler, articleHandler, jwksHandler, oAuth2Handler, adminRoleHandler, adminUserHandler, captchaHandler)
 	rankingCache := cache.NewRankingRedisCache(cmdable)
 	rankingLocalCache := cache.NewRankingLocalCache()
 	rankingRepository := repository.NewCachedRankingRepository(rankingCache, rankingLocalCache)
 	rankingService := service.NewBatchRankingService(articleService, interactiveServiceClient, rankingRepository)
 	job := ioc.InitRankingJob(rankingService)
-	cron := ioc.InitCronJob(job)
+	userPurgeJob := ioc.InitUserPurgeJob(userService)
+	userPhoneJob := ioc.InitUserPhoneJob(userService, parser)
+	smsRetryJob := ioc.InitSMSRetryJob(asyncService)
+	cron := ioc.InitCronJob(job, userPurgeJob, userPhoneJob, smsRetryJob)
+	loginLogConsumer := user.NewLoginLogConsumer(loginLogRepository, client)
+	v2 := ioc.NewConsumers(loginLogConsumer)
 	app := &App{
-		web:  engine,
-		cron: cron,
+		web:       engine,
+		cron:      cron,
+		consumers: v2,
 	}
 	return app
 }
 
 // wire.go:
 
-var UserService = wire.NewSet(cache.NewuserCache, dao.NewuserDAO, repository.NewuserRepository, service.NewuserService)
+var UserService = wire.NewSet(cache.NewuserCache, dao.NewuserDAO, dao.NewmfaDAO, dao.Newoauth2BindingDAO, repository.NewuserRepository, repository.NewmfaRepository, repository.Newoauth2BindingRepository, service.NewuserService, service.NewmfaService, dao.NewroleDAO, repository.NewroleRepository, service.NewroleService, dao.NewloginLogDAO, repository.NewloginLogRepository, service.NewloginLogService)
 
-var CodeService = wire.NewSet(cache.NewcodeCache, repository.NewcodeRepository, service.NewcodeService)
+var CodeService = wire.NewSet(cache.NewcodeCache, repository.NewcodeRepository, service.NewcodeService, cache.NewcaptchaCache, repository.NewcaptchaRepository, service.NewcaptchaService, cache.NewmagicLinkCache, repository.NewmagicLinkRepository, ioc.InitMagicLinkService)
 
 var ArticleService = wire.NewSet(dao.NewarticleDAO, cache.NewarticleCache, repository.NewarticleRepository, service.NewarticleService)